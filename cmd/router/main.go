@@ -3,7 +3,8 @@ package main
 import (
     "flag"
     "fmt"
-    "log"
+    stdlog "log"
+    "net/http"
     "os"
     "os/signal"
     "syscall"
@@ -11,14 +12,23 @@ import (
     "github.com/spf13/viper"
     
     "github.com/hamzaKhattat/asterisk-router-production/internal/agi"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/api"
     "github.com/hamzaKhattat/asterisk-router-production/internal/ami"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
     "github.com/hamzaKhattat/asterisk-router-production/internal/cli"
     "github.com/hamzaKhattat/asterisk-router-production/internal/db"
- //   "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/fraud"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
     "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
     "github.com/hamzaKhattat/asterisk-router-production/internal/router"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/sipprobe"
 )
 
+var log = logger.Component("main")
+
 func main() {
     // Define base flags
     var (
@@ -43,13 +53,6 @@ func main() {
         return
     }
     
-    // Setup logging
-    if *verbose {
-        log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
-    } else {
-        log.SetFlags(log.Ldate | log.Ltime)
-    }
-    
     // Load configuration
     viper.SetConfigFile(*configFile)
     viper.SetDefault("database.host", "localhost")
@@ -62,11 +65,49 @@ func main() {
     viper.SetDefault("ami.port", 5038)
     viper.SetDefault("ami.username", "admin")
     viper.SetDefault("ami.password", "admin")
+    viper.SetDefault("cluster.enabled", false)
+    viper.SetDefault("api.enabled", false)
+    viper.SetDefault("api.listen", "127.0.0.1:8080")
+    viper.SetDefault("reload.poll_interval", "10s")
+    viper.SetDefault("metrics.enabled", false)
+    viper.SetDefault("metrics.listen", ":9102")
+    viper.SetDefault("loadbalancer.max_failures", loadbalancer.DefaultMaxFailures)
+    viper.SetDefault("loadbalancer.recovery_time", loadbalancer.DefaultRecoveryTime)
+    viper.SetDefault("loadbalancer.health_check_interval", loadbalancer.DefaultCheckInterval)
+    viper.SetDefault("loadbalancer.window", loadbalancer.DefaultWindow)
+    viper.SetDefault("loadbalancer.failure_ratio", loadbalancer.DefaultFailureRatio)
+    viper.SetDefault("loadbalancer.min_calls", loadbalancer.DefaultMinCalls)
+    viper.SetDefault("loadbalancer.half_open_probes", loadbalancer.DefaultHalfOpenProbes)
+    viper.SetDefault("loadbalancer.quality.window", loadbalancer.DefaultQualityWindow)
+    viper.SetDefault("loadbalancer.quality.min_share", loadbalancer.DefaultMinShare)
+    viper.SetDefault("loadbalancer.quality.target_acd", loadbalancer.DefaultTargetACD)
+    viper.SetDefault("loadbalancer.quality.max_pdd", loadbalancer.DefaultMaxPDD)
+    viper.SetDefault("loadbalancer.quality.asr_weight", loadbalancer.DefaultASRWeight)
+    viper.SetDefault("loadbalancer.quality.acd_weight", loadbalancer.DefaultACDWeight)
+    viper.SetDefault("loadbalancer.quality.pdd_weight", loadbalancer.DefaultPDDWeight)
+    viper.SetDefault("routing.max_attempts", router.DefaultMaxAttempts)
+    viper.SetDefault("limits.channel_limit_sip_code", router.DefaultRejectSIPCode)
+    viper.SetDefault("limits.cps_limit_sip_code", router.DefaultRejectSIPCode)
+    viper.SetDefault("fraud.enabled", false)
+    viper.SetDefault("fraud.block_sip_code", router.DefaultBlockSIPCode)
+    viper.SetDefault("probe.enabled", false)
+    viper.SetDefault("probe.interval", sipprobe.DefaultInterval)
+    viper.SetDefault("probe.timeout", sipprobe.DefaultTimeout)
+    viper.SetDefault("probe.transport", sipprobe.TransportUDP)
+    viper.SetDefault("probe.down_after", sipprobe.DefaultDownAfter)
+    viper.SetDefault("logging.level", "info")
+    viper.SetDefault("logging.format", "json")
+    viper.SetDefault("logging.max_size_mb", 100)
+    viper.SetDefault("logging.max_backups", 5)
     
-    if err := viper.ReadInConfig(); err != nil {
-        if !*initDB {
-            log.Printf("Warning: Could not read config file: %v", err)
-        }
+    configErr := viper.ReadInConfig()
+    
+    // Setup logging
+    setupLogging(*runAGI, *verbose)
+    defer logger.Close()
+    
+    if configErr != nil && !*initDB {
+        log.Warnf("Could not read config file: %v", configErr)
     }
     
     // Initialize database
@@ -105,7 +146,7 @@ func main() {
     
     // Handle AGI server mode
     if *runAGI {
-        runAGIServer(providerMgr, *verbose)
+        runAGIServer(providerMgr)
         return
     }
     
@@ -113,23 +154,129 @@ func main() {
     runCLI(providerMgr)
 }
 
-func runAGIServer(providerMgr *provider.Manager, verbose bool) {
-    // Create router
-    r := router.NewRouter(providerMgr)
+// setupLogging configures the logger from the logging section. The AGI server
+// writes structured logs to logging.file; CLI commands keep human readable
+// output on stderr and only report warnings unless -verbose is given.
+func setupLogging(agiMode, verbose bool) {
+    cfg := logger.Config{
+        Level:  "warn",
+        Format: "text",
+    }
+    
+    if agiMode {
+        cfg = logger.Config{
+            Level:      viper.GetString("logging.level"),
+            Format:     viper.GetString("logging.format"),
+            File:       viper.GetString("logging.file"),
+            MaxSizeMB:  viper.GetInt("logging.max_size_mb"),
+            MaxBackups: viper.GetInt("logging.max_backups"),
+        }
+    }
+    
+    if verbose {
+        cfg.Level = "debug"
+    }
+    
+    if err := logger.Init(cfg); err != nil {
+        // Keep going on stderr rather than refusing to route calls
+        cfg.File = ""
+        logger.Init(cfg)
+        log.Warnf("Logging to stderr: %v", err)
+    }
+    
+    // Route anything still using the standard logger through the same output
+    stdlog.SetFlags(0)
+    stdlog.SetOutput(logger.StdWriter("main"))
+}
+
+func runAGIServer(providerMgr *provider.Manager) {
+    // Create router. In cluster mode in-flight calls live in MySQL so any
+    // node can handle the return and final legs of a call another node started.
+    routerCfg := router.Config{
+        NodeID:              viper.GetString("cluster.node_id"),
+        MaxAttempts:         viper.GetInt("routing.max_attempts"),
+        ChannelLimitSIPCode: viper.GetInt("limits.channel_limit_sip_code"),
+        CPSLimitSIPCode:     viper.GetInt("limits.cps_limit_sip_code"),
+        BlockSIPCode:        viper.GetInt("fraud.block_sip_code"),
+    }
+    if viper.GetBool("fraud.enabled") {
+        var fraudCfg fraud.Config
+        if err := viper.UnmarshalKey("fraud", &fraudCfg); err != nil {
+            log.Fatalf("Invalid fraud configuration: %v", err)
+        }
+        detector, err := fraud.New(fraudCfg)
+        if err != nil {
+            log.Fatalf("Invalid fraud configuration: %v", err)
+        }
+        routerCfg.Fraud = detector
+    }
+    if viper.GetBool("cluster.enabled") {
+        routerCfg.Store = callstate.NewMySQLStore(db.DB)
+        routerCfg.Clustered = true
+    }
+    r := router.NewRouterWithConfig(providerMgr, routerCfg)
     
     // Start load balancer health monitor
+    r.GetLoadBalancer().Configure(loadbalancer.BreakerConfig{
+        MaxFailures:    viper.GetInt("loadbalancer.max_failures"),
+        Window:         viper.GetDuration("loadbalancer.window"),
+        FailureRatio:   viper.GetFloat64("loadbalancer.failure_ratio"),
+        MinCalls:       viper.GetInt("loadbalancer.min_calls"),
+        RecoveryTime:   viper.GetDuration("loadbalancer.recovery_time"),
+        HalfOpenProbes: viper.GetInt("loadbalancer.half_open_probes"),
+        CheckInterval:  viper.GetDuration("loadbalancer.health_check_interval"),
+    })
+    r.GetLoadBalancer().ConfigureQuality(loadbalancer.QualityConfig{
+        Window:    viper.GetDuration("loadbalancer.quality.window"),
+        MinShare:  viper.GetFloat64("loadbalancer.quality.min_share"),
+        TargetACD: viper.GetDuration("loadbalancer.quality.target_acd"),
+        MaxPDD:    viper.GetDuration("loadbalancer.quality.max_pdd"),
+        Weights: loadbalancer.QualityWeights{
+            ASR: viper.GetFloat64("loadbalancer.quality.asr_weight"),
+            ACD: viper.GetFloat64("loadbalancer.quality.acd_weight"),
+            PDD: viper.GetFloat64("loadbalancer.quality.pdd_weight"),
+        },
+    })
     r.GetLoadBalancer().StartHealthMonitor()
     
     // Create and start AGI server
     agiServer := agi.NewServer(r, viper.GetInt("agi.port"))
     
     go func() {
-        log.Printf("Starting AGI server on port %d...", viper.GetInt("agi.port"))
+        log.Infof("Starting AGI server on port %d...", viper.GetInt("agi.port"))
         if err := agiServer.Start(); err != nil {
             log.Fatalf("Failed to start AGI server: %v", err)
         }
     }()
     
+    // Start the management API next to the AGI server so changes made
+    // through it land in the live provider and route tables
+    var apiServer *api.Server
+    if viper.GetBool("api.enabled") {
+        token := viper.GetString("api.token")
+        if token == "" {
+            log.Fatalf("api.token must be set to enable the management API")
+        }
+        apiServer = api.NewServer(providerMgr, r, viper.GetString("api.listen"), token)
+        go func() {
+            if err := apiServer.Start(); err != nil {
+                log.Fatalf("Failed to start API server: %v", err)
+            }
+        }()
+    }
+    
+    // Expose Prometheus metrics
+    if viper.GetBool("metrics.enabled") {
+        mux := http.NewServeMux()
+        mux.Handle("/metrics", metrics.Handler(r, agiServer))
+        go func() {
+            log.Infof("Serving metrics on %s/metrics", viper.GetString("metrics.listen"))
+            if err := http.ListenAndServe(viper.GetString("metrics.listen"), mux); err != nil {
+                log.Warnf("Metrics server stopped: %v", err)
+            }
+        }()
+    }
+    
     // Connect to AMI if configured
     if viper.GetString("ami.username") != "" {
         amiManager := ami.NewManager(
@@ -140,29 +287,66 @@ func runAGIServer(providerMgr *provider.Manager, verbose bool) {
         )
         
         if err := amiManager.Connect(); err != nil {
-            log.Printf("Warning: Failed to connect to AMI: %v", err)
+            log.Warnf("Failed to connect to AMI: %v", err)
         } else {
             defer amiManager.Close()
             
             // Monitor AMI events
             go func() {
                 for event := range amiManager.Events() {
-                    if verbose {
-                        log.Printf("AMI Event: %s", event["Event"])
-                    }
+                    log.Debugf("AMI Event: %s", event["Event"])
                 }
             }()
         }
     }
     
+    // Pick up provider/route/DID changes made by the CLI or other nodes
+    stopWatch := make(chan struct{})
+    
+    // Actively check that intermediate and final providers answer SIP
+    if viper.GetBool("probe.enabled") {
+        prober := sipprobe.NewProber(r.GetLoadBalancer(), func() []*models.Provider {
+            providers, _ := providerMgr.ListProviders("")
+            var probed []*models.Provider
+            for _, p := range providers {
+                if p.Type != "inbound" {
+                    probed = append(probed, p)
+                }
+            }
+            return probed
+        }, sipprobe.Config{
+            Interval:  viper.GetDuration("probe.interval"),
+            Timeout:   viper.GetDuration("probe.timeout"),
+            Transport: viper.GetString("probe.transport"),
+            DownAfter: viper.GetInt("probe.down_after"),
+        })
+        go prober.Run(stopWatch)
+    }
+    if interval := viper.GetDuration("reload.poll_interval"); interval > 0 {
+        go providerMgr.WatchConfigVersion(interval, stopWatch)
+    }
+    
     fmt.Println("AGI Server running. Press Ctrl+C to stop.")
     
-    // Wait for interrupt signal
+    // Wait for interrupt signal, reload configuration on SIGHUP
     sigChan := make(chan os.Signal, 1)
-    signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-    <-sigChan
+    signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+    for sig := range sigChan {
+        if sig != syscall.SIGHUP {
+            break
+        }
+        
+        log.Infof("Received SIGHUP, reloading configuration...")
+        if err := providerMgr.Reload(); err != nil {
+            log.Errorf("Failed to reload configuration: %v", err)
+        }
+    }
     
-    log.Println("Shutting down...")
+    log.Infof("Shutting down...")
+    close(stopWatch)
+    if apiServer != nil {
+        apiServer.Stop()
+    }
     agiServer.Stop()
 }
 
@@ -190,10 +374,17 @@ FLAGS:
 COMMANDS:
     provider        Manage providers
     did             Manage DIDs
+    group           Manage provider groups
     route           Manage routes
+    rate            Manage provider rate decks
+    list            Manage ANI/DNIS blocklists and allowlists
+    translate       Manage per-provider ANI/DNIS translation rules
     stats           Show system statistics
+    margin          Show revenue, cost and margin of completed calls
     lb              Show load balancer status
     calls           Show active calls
+    blocked         Show calls blocked by fraud rules
+    verify          Show verification failures per provider
     monitor         Monitor system in real-time
 
 EXAMPLES:
@@ -203,6 +394,9 @@ EXAMPLES:
     # Add a provider
     ./router provider add s1 --type inbound --host 192.168.1.10
 
+    # Accept an IP-authenticated provider's calls from a range and a hostname
+    ./router provider add s3-1 --type intermediate --host 10.0.1.10 --allow 10.0.1.0/28,sbc.s3.example
+
     # Add DIDs
     ./router did add 18001234567 18001234568 --provider s3-1
     ./router did add --file dids.csv --provider s3-1
@@ -210,6 +404,31 @@ EXAMPLES:
     # Create a route
     ./router route add main-route s1 s3-1 s4-1 --mode round_robin
 
+    # Pool providers in groups and route through them
+    ./router group add s3-east s3-east-1 s3-east-2
+    ./router group member add s3-east s3-east-2 --weight 3
+    ./router route add east-route s1 s3-east s4-1 --mode weighted
+
+    # Import a rate deck and route by least cost
+    ./router rate import s4-1 s4-1-rates.csv
+    ./router route add lcr-route s1 s3-1 s4-1 --mode lcr
+
+    # Block premium-rate destinations, allow only UK callers on one route
+    ./router list add block dnis 1900* --note "premium rate"
+    ./router list add allow ani 44* --route uk-route
+    ./router list import block ani bad-callers.csv --provider s1
+
+    # Normalize an inbound provider's numbers to E.164
+    ./router translate add s1 inbound e164 GB
+    ./router translate test s1 inbound 02071234567 00447700900123
+
+    # Refuse calls whose numbers change on the way back, and review failures
+    ./router route add uk-route s1 s3-1 s4-1 --country GB --verify-policy reject
+    ./router verify report --days 30
+
+    # Margin per route and inbound provider for a month
+    ./router margin --by route,provider --from 2024-05-01 --to 2024-05-31
+
     # List providers
     ./router provider list
     ./router provider list --type intermediate
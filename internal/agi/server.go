@@ -2,13 +2,18 @@ package agi
 
 import (
     "bufio"
+    "errors"
     "fmt"
-    "log"
     "net"
+    "strconv"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
     
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
     "github.com/hamzaKhattat/asterisk-router-production/internal/router"
 )
 
@@ -19,6 +24,18 @@ const (
     AGI_ERROR   = "510 Invalid or unknown command"
 )
 
+// ROUTER_ERROR codes the dialplan can branch on
+const (
+    ROUTER_ERR_DID_POOL_EXHAUSTED  = "DID_POOL_EXHAUSTED"
+    ROUTER_ERR_NO_RETRY            = "NO_RETRY"
+    ROUTER_ERR_CHANNEL_LIMIT       = "CHANNEL_LIMIT"
+    ROUTER_ERR_CPS_LIMIT           = "CPS_LIMIT"
+    ROUTER_ERR_BLOCKED             = "BLOCKED"
+    ROUTER_ERR_VERIFICATION_FAILED = "VERIFICATION_FAILED"
+)
+
+var log = logger.Component("agi")
+
 // Server represents the AGI server
 type Server struct {
     router       *router.Router
@@ -27,6 +44,7 @@ type Server struct {
     connections  sync.WaitGroup
     shutdown     chan struct{}
     activeConns  sync.Map // Track active connections for monitoring
+    sessionsTotal uint64  // Sessions handled since start, updated atomically
 }
 
 // AGISession represents a single AGI session
@@ -38,6 +56,7 @@ type AGISession struct {
     server   *Server
     id       string
     startTime time.Time
+    log      *logger.Entry
 }
 
 // NewServer creates a new AGI server instance
@@ -57,14 +76,13 @@ func (s *Server) Start() error {
         return fmt.Errorf("failed to listen on port %d: %v", s.listenPort, err)
     }
     
-    log.Printf("[AGI] Server listening on port %d", s.listenPort)
-    log.Printf("[AGI] Ready to process calls...")
+    log.Infof("Server listening on port %d", s.listenPort)
     
     // Accept connections
     for {
         select {
         case <-s.shutdown:
-            log.Println("[AGI] Server shutting down...")
+            log.Infof("Server shutting down...")
             return nil
         default:
             // Set accept timeout to check shutdown periodically
@@ -74,7 +92,7 @@ func (s *Server) Start() error {
                 if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
                     continue
                 }
-                log.Printf("[AGI] Error accepting connection: %v", err)
+                log.Errorf("Error accepting connection: %v", err)
                 continue
             }
             
@@ -91,7 +109,7 @@ func (s *Server) Stop() {
         s.listener.Close()
     }
     s.connections.Wait()
-    log.Println("[AGI] Server stopped")
+    log.Infof("Server stopped")
 }
 
 // handleConnection handles a single AGI connection
@@ -107,20 +125,23 @@ func (s *Server) handleConnection(conn net.Conn) {
         id:        fmt.Sprintf("%s-%d", conn.RemoteAddr().String(), time.Now().UnixNano()),
         startTime: time.Now(),
     }
+    session.log = log.WithField("session_id", session.id)
     
     // Track active connection
     s.activeConns.Store(session.id, session)
     defer s.activeConns.Delete(session.id)
+    atomic.AddUint64(&s.sessionsTotal, 1)
     
     defer session.close()
     
-    log.Printf("[AGI] New connection from %s (ID: %s)", conn.RemoteAddr(), session.id)
+    session.log.Debugf("New connection from %s", conn.RemoteAddr())
     
     // Read AGI headers
     if err := session.readHeaders(); err != nil {
-        log.Printf("[AGI] Error reading headers: %v", err)
+        session.log.Errorf("Error reading headers: %v", err)
         return
     }
+    session.log = session.log.WithField("call_id", session.headers["agi_uniqueid"])
     
     // Log session details
     session.logSessionStart()
@@ -130,13 +151,11 @@ func (s *Server) handleConnection(conn net.Conn) {
     
     // Log session end
     duration := time.Since(session.startTime)
-    log.Printf("[AGI] Session %s completed (Duration: %v)", session.id, duration)
+    session.log.WithField("duration", duration.String()).Debugf("Session completed")
 }
 
 // readHeaders reads AGI headers from the connection
 func (s *AGISession) readHeaders() error {
-    log.Printf("[AGI] Reading headers for session %s", s.id)
-    
     for {
         line, err := s.reader.ReadString('\n')
         if err != nil {
@@ -156,11 +175,6 @@ func (s *AGISession) readHeaders() error {
             key := strings.TrimSpace(parts[0])
             value := strings.TrimSpace(parts[1])
             s.headers[key] = value
-            
-            // Log important headers
-            if strings.Contains(key, "agi_") {
-                log.Printf("[AGI]   %s: %s", key, value)
-            }
         }
     }
     
@@ -169,29 +183,25 @@ func (s *AGISession) readHeaders() error {
 
 // logSessionStart logs the start of an AGI session with details
 func (s *AGISession) logSessionStart() {
-    log.Printf("\n[AGI] ========== SESSION START ==========")
-    log.Printf("[AGI] Session ID: %s", s.id)
-    log.Printf("[AGI] Request: %s", s.headers["agi_request"])
-    log.Printf("[AGI] Channel: %s", s.headers["agi_channel"])
-    log.Printf("[AGI] CallerID: %s", s.headers["agi_callerid"])
-    log.Printf("[AGI] Extension: %s", s.headers["agi_extension"])
-    log.Printf("[AGI] Context: %s", s.headers["agi_context"])
-    log.Printf("[AGI] UniqueID: %s", s.headers["agi_uniqueid"])
-    log.Printf("[AGI] =====================================\n")
+    s.log.WithFields(logger.Fields{
+        "request":   s.headers["agi_request"],
+        "channel":   s.headers["agi_channel"],
+        "callerid":  s.headers["agi_callerid"],
+        "extension": s.headers["agi_extension"],
+        "context":   s.headers["agi_context"],
+    }).Infof("Session start")
 }
 
 // processRequest processes the AGI request based on the request type
 func (s *AGISession) processRequest() {
     request := s.headers["agi_request"]
     if request == "" {
-        log.Printf("[AGI] No request found in headers")
+        s.log.Errorf("No request found in headers")
         s.sendResponse(AGI_FAILURE)
         return
     }
     
     // Extract request type from AGI request
-    log.Printf("[AGI] Processing request: %s", request)
-    
     switch {
     case strings.Contains(request, "processIncoming"):
         s.handleIncomingCall()
@@ -199,18 +209,20 @@ func (s *AGISession) processRequest() {
         s.handleReturnCall()
     case strings.Contains(request, "processFinal"):
         s.handleFinalCall()
+    case strings.Contains(request, "dialResult"):
+        s.handleDialResult()
+    case strings.Contains(request, "processRetry"):
+        s.handleRetry()
     case strings.Contains(request, "hangup"):
         s.handleHangup()
     default:
-        log.Printf("[AGI] Unknown request type: %s", request)
+        s.log.Errorf("Unknown request type: %s", request)
         s.sendResponse(AGI_FAILURE)
     }
 }
 
 // handleIncomingCall handles incoming calls from S1
 func (s *AGISession) handleIncomingCall() {
-    log.Printf("[AGI] Processing incoming call from S1")
-    
     // Extract call information
     callID := s.headers["agi_uniqueid"]
     ani := s.headers["agi_callerid"]
@@ -220,31 +232,26 @@ func (s *AGISession) handleIncomingCall() {
     // Extract provider from channel
     inboundProvider := s.extractProviderFromChannel(channel)
     
-    log.Printf("[AGI] Incoming Call Details:")
-    log.Printf("[AGI]   CallID: %s", callID)
-    log.Printf("[AGI]   ANI-1: %s", ani)
-    log.Printf("[AGI]   DNIS-1: %s", dnis)
-    log.Printf("[AGI]   Inbound Provider: %s", inboundProvider)
+    clog := s.log.WithFields(logger.Fields{"step": "S1_TO_S2", "provider": inboundProvider})
     
     // Process through router
     response, err := s.server.router.ProcessIncomingCall(callID, ani, dnis, inboundProvider)
     
     if err != nil {
-        log.Printf("[AGI] ERROR: Failed to process incoming call: %v", err)
-        s.setVariable("ROUTER_STATUS", "failed")
-        s.setVariable("ROUTER_ERROR", err.Error())
+        clog.Errorf("Failed to process incoming call: %v", err)
+        if errors.Is(err, router.ErrCallBlocked) {
+            s.setVariable("ROUTER_STATUS", "blocked")
+        } else {
+            s.setVariable("ROUTER_STATUS", "failed")
+        }
+        s.setVariable("ROUTER_ERROR", routerErrorCode(err))
+        s.setRejectCause(err)
+        
         s.sendResponse(AGI_SUCCESS)
         return
     }
     
     // Set channel variables for dialplan
-    log.Printf("[AGI] Setting channel variables for routing:")
-    log.Printf("[AGI]   ROUTER_STATUS = success")
-    log.Printf("[AGI]   DID_ASSIGNED = %s", response.DIDAssigned)
-    log.Printf("[AGI]   NEXT_HOP = %s", response.NextHop)
-    log.Printf("[AGI]   ANI_TO_SEND = %s", response.ANIToSend)
-    log.Printf("[AGI]   DNIS_TO_SEND = %s", response.DNISToSend)
-    
     s.setVariable("ROUTER_STATUS", "success")
     s.setVariable("DID_ASSIGNED", response.DIDAssigned)
     s.setVariable("NEXT_HOP", response.NextHop)
@@ -253,13 +260,20 @@ func (s *AGISession) handleIncomingCall() {
     
     s.sendResponse(AGI_SUCCESS)
     
-    log.Printf("[AGI] Incoming call processed successfully")
+    clog.Debugf("Incoming call processed successfully")
+}
+
+// setRejectCause tells the dialplan which SIP response to refuse the
+// channel with, for router errors that carry one
+func (s *AGISession) setRejectCause(err error) {
+    if sipCode, hangupCause, ok := router.RejectCause(err); ok {
+        s.setVariable("ROUTER_SIP_CAUSE", strconv.Itoa(sipCode))
+        s.setVariable("ROUTER_HANGUP_CAUSE", strconv.Itoa(hangupCause))
+    }
 }
 
 // handleReturnCall handles calls returning from S3
 func (s *AGISession) handleReturnCall() {
-    log.Printf("[AGI] Processing return call from S3")
-    
     // Extract call information
     ani2 := s.headers["agi_callerid"]
     did := s.headers["agi_extension"]
@@ -271,30 +285,21 @@ func (s *AGISession) handleReturnCall() {
     // Extract provider from channel
     intermediateProvider := s.extractProviderFromChannel(channel)
     
-    log.Printf("[AGI] Return Call Details:")
-    log.Printf("[AGI]   ANI-2: %s", ani2)
-    log.Printf("[AGI]   DID: %s", did)
-    log.Printf("[AGI]   Intermediate Provider: %s", intermediateProvider)
-    log.Printf("[AGI]   Source IP: %s", sourceIP)
+    clog := s.log.WithFields(logger.Fields{"step": "S3_TO_S2", "provider": intermediateProvider, "did": did})
     
     // Process through router
     response, err := s.server.router.ProcessReturnCall(ani2, did, intermediateProvider, sourceIP)
     
     if err != nil {
-        log.Printf("[AGI] ERROR: Failed to process return call: %v", err)
+        clog.Errorf("Failed to process return call: %v", err)
         s.setVariable("ROUTER_STATUS", "failed")
-        s.setVariable("ROUTER_ERROR", err.Error())
+        s.setVariable("ROUTER_ERROR", routerErrorCode(err))
+        s.setRejectCause(err)
         s.sendResponse(AGI_SUCCESS)
         return
     }
     
     // Set channel variables for routing to S4
-    log.Printf("[AGI] Setting channel variables for S4 routing:")
-    log.Printf("[AGI]   ROUTER_STATUS = success")
-    log.Printf("[AGI]   NEXT_HOP = %s", response.NextHop)
-    log.Printf("[AGI]   ANI_TO_SEND = %s", response.ANIToSend)
-    log.Printf("[AGI]   DNIS_TO_SEND = %s", response.DNISToSend)
-    
     s.setVariable("ROUTER_STATUS", "success")
     s.setVariable("NEXT_HOP", response.NextHop)
     s.setVariable("ANI_TO_SEND", response.ANIToSend)
@@ -302,13 +307,11 @@ func (s *AGISession) handleReturnCall() {
     
     s.sendResponse(AGI_SUCCESS)
     
-    log.Printf("[AGI] Return call processed successfully")
+    clog.Debugf("Return call processed successfully")
 }
 
 // handleFinalCall handles the final call from S4
 func (s *AGISession) handleFinalCall() {
-    log.Printf("[AGI] Processing final call from S4")
-    
     // Extract call information
     callID := s.headers["agi_uniqueid"]
     ani := s.headers["agi_callerid"]
@@ -321,39 +324,159 @@ func (s *AGISession) handleFinalCall() {
     // Extract provider from channel
     finalProvider := s.extractProviderFromChannel(channel)
     
-    log.Printf("[AGI] Final Call Details:")
-    log.Printf("[AGI]   CallID: %s", callID)
-    log.Printf("[AGI]   ANI: %s", ani)
-    log.Printf("[AGI]   DNIS: %s", dnis)
-    log.Printf("[AGI]   Final Provider: %s", finalProvider)
-    log.Printf("[AGI]   Source IP: %s", sourceIP)
+    clog := s.log.WithFields(logger.Fields{"step": "S4_TO_S2", "provider": finalProvider})
     
     // Process through router
     err := s.server.router.ProcessFinalCall(callID, ani, dnis, finalProvider, sourceIP)
     
     if err != nil {
-        log.Printf("[AGI] ERROR: Failed to process final call: %v", err)
+        clog.Errorf("Failed to process final call: %v", err)
+        s.setRejectCause(err)
     } else {
-        log.Printf("[AGI] Final call processed successfully")
+        clog.Debugf("Final call processed successfully")
     }
     
     s.sendResponse(AGI_SUCCESS)
 }
 
-// handleHangup handles call hangup
+// handleDialResult reports the outcome of the Dial that just returned
+func (s *AGISession) handleDialResult() {
+    s.reportDialResult(s.getVariable("DIALSTATUS"), s.getVariable("HANGUPCAUSE"))
+    s.sendResponse(AGI_SUCCESS)
+}
+
+// reportDialResult sends the outcome of the channel's Dial towards NEXT_HOP
+// to the router once. An answered Dial never returns to the dialplan, so the
+// hangup handler reports whatever the dialplan has not.
+func (s *AGISession) reportDialResult(dialStatus, cause string) {
+    if dialStatus == "" || s.getVariable("DIAL_REPORTED") == "1" {
+        return
+    }
+    
+    provider := strings.TrimPrefix(s.getVariable("NEXT_HOP"), "endpoint-")
+    did := s.returnDID()
+    s.server.router.ProcessDialResult(s.headers["agi_uniqueid"], did, provider, dialStatus, cause, s.dialTiming())
+    s.setVariable("DIAL_REPORTED", "1")
+}
+
+// dialTiming reads how long the last Dial took. Post-dial delay is the time
+// to the first ringing or progress indication (Asterisk 16+); when neither is
+// set, an answered Dial falls back to the time until answer.
+func (s *AGISession) dialTiming() loadbalancer.DialTiming {
+    millis := func(name string) time.Duration {
+        ms, err := strconv.ParseInt(s.getVariable(name), 10, 64)
+        if err != nil || ms < 0 {
+            return 0
+        }
+        return time.Duration(ms) * time.Millisecond
+    }
+    
+    var timing loadbalancer.DialTiming
+    timing.Talk = millis("ANSWEREDTIME_MS")
+    
+    ring, progress := millis("RINGTIME_MS"), millis("PROGRESSTIME_MS")
+    switch {
+    case ring > 0 && (progress == 0 || ring < progress):
+        timing.PostDialDelay = ring
+    case progress > 0:
+        timing.PostDialDelay = progress
+    case timing.Talk > 0:
+        if dialed := millis("DIALEDTIME_MS"); dialed > timing.Talk {
+            timing.PostDialDelay = dialed - timing.Talk
+        }
+    }
+    return timing
+}
+
+// returnDID returns the DID the S3 return leg came in on, translated with
+// the intermediate provider's inbound rules as the router stored it. It is
+// empty on other channels.
+func (s *AGISession) returnDID() string {
+    did := s.getVariable("RETURN_DID")
+    if did == "" {
+        return ""
+    }
+    provider := s.extractProviderFromChannel(s.headers["agi_channel"])
+    return s.server.router.ReturnDID(provider, did)
+}
+
+// handleRetry asks the router for the next provider after a failed Dial.
+// On success the dialplan dials again with the new variables.
+func (s *AGISession) handleRetry() {
+    callID := s.headers["agi_uniqueid"]
+    did := s.returnDID()
+    dialStatus := s.getVariable("DIALSTATUS")
+    cause := s.getVariable("HANGUPCAUSE")
+    
+    response, err := s.server.router.ProcessRetry(callID, did, dialStatus, cause)
+    if err != nil {
+        s.log.WithField("dial_status", dialStatus).Infof("Not retrying: %v", err)
+        s.setVariable("ROUTER_STATUS", "failed")
+        s.setVariable("ROUTER_ERROR", routerErrorCode(err))
+        s.sendResponse(AGI_SUCCESS)
+        return
+    }
+    
+    s.setVariable("ROUTER_STATUS", "success")
+    if response.DIDAssigned != "" {
+        s.setVariable("DID_ASSIGNED", response.DIDAssigned)
+    }
+    s.setVariable("NEXT_HOP", response.NextHop)
+    s.setVariable("ANI_TO_SEND", response.ANIToSend)
+    s.setVariable("DNIS_TO_SEND", response.DNISToSend)
+    s.setVariable("DIAL_REPORTED", "")
+    
+    s.sendResponse(AGI_SUCCESS)
+}
+
+// handleHangup handles call hangup. It runs from the hangup handler of the
+// S1 leg and of the S3 return leg, which identifies the call by its DID.
 func (s *AGISession) handleHangup() {
     callID := s.headers["agi_uniqueid"]
-    log.Printf("[AGI] Processing hangup for call %s", callID)
+    did := s.returnDID()
+    cause := s.getVariable("HANGUPCAUSE")
+    dialStatus := s.getVariable("DIALSTATUS")
     
-    // Additional cleanup can be added here if needed
+    s.reportDialResult(dialStatus, cause)
+    
+    s.log.WithFields(logger.Fields{
+        "did":         did,
+        "cause":       cause,
+        "dial_status": dialStatus,
+    }).Infof("Processing hangup")
+    
+    if err := s.server.router.ProcessHangup(callID, did, cause, dialStatus, s.dialTiming().Talk); err != nil {
+        s.log.Errorf("Failed to process hangup: %v", err)
+    }
     
     s.sendResponse(AGI_SUCCESS)
 }
 
+// routerErrorCode maps a router error to the value reported in ROUTER_ERROR.
+// Known failures get a stable code, anything else is passed through as text.
+func routerErrorCode(err error) string {
+    switch {
+    case errors.Is(err, router.ErrDIDPoolExhausted):
+        return ROUTER_ERR_DID_POOL_EXHAUSTED
+    case errors.Is(err, router.ErrNoRetry):
+        return ROUTER_ERR_NO_RETRY
+    case errors.Is(err, router.ErrChannelLimit):
+        return ROUTER_ERR_CHANNEL_LIMIT
+    case errors.Is(err, router.ErrCPSLimit):
+        return ROUTER_ERR_CPS_LIMIT
+    case errors.Is(err, router.ErrCallBlocked):
+        return ROUTER_ERR_BLOCKED
+    case errors.Is(err, router.ErrVerificationFailed):
+        return ROUTER_ERR_VERIFICATION_FAILED
+    default:
+        return err.Error()
+    }
+}
+
 // setVariable sets a channel variable
 func (s *AGISession) setVariable(name, value string) error {
     cmd := fmt.Sprintf("SET VARIABLE %s \"%s\"", name, value)
-    log.Printf("[AGI] Executing: %s", cmd)
+    s.log.Debugf("Executing: %s", cmd)
     
     if err := s.sendCommand(cmd); err != nil {
         return err
@@ -364,14 +487,14 @@ func (s *AGISession) setVariable(name, value string) error {
         return err
     }
     
-    log.Printf("[AGI] Response: %s", response)
+    s.log.Debugf("Response: %s", response)
     return nil
 }
 
 // getVariable gets a channel variable
 func (s *AGISession) getVariable(name string) string {
     cmd := fmt.Sprintf("GET VARIABLE %s", name)
-    log.Printf("[AGI] Executing: %s", cmd)
+    s.log.Debugf("Executing: %s", cmd)
     
     if err := s.sendCommand(cmd); err != nil {
         return ""
@@ -382,7 +505,7 @@ func (s *AGISession) getVariable(name string) string {
         return ""
     }
     
-    log.Printf("[AGI] Response: %s", response)
+    s.log.Debugf("Response: %s", response)
     
     // Parse response: "200 result=1 (value)"
     if strings.Contains(response, "result=1") {
@@ -390,7 +513,7 @@ func (s *AGISession) getVariable(name string) string {
         end := strings.LastIndex(response, ")")
         if start > 0 && end > start {
             value := response[start+1 : end]
-            log.Printf("[AGI] Variable %s = %s", name, value)
+            s.log.Debugf("Variable %s = %s", name, value)
             return value
         }
     }
@@ -474,7 +597,19 @@ func (s *Server) GetStats() map[string]interface{} {
     })
     
     stats["active_connections"] = activeCount
+    stats["total_sessions"] = atomic.LoadUint64(&s.sessionsTotal)
     stats["port"] = s.listenPort
     
     return stats
 }
+
+// Collect exports AGI session metrics
+func (s *Server) Collect(w *metrics.Writer) {
+    stats := s.GetStats()
+    
+    w.Header("agi_active_sessions", "AGI sessions currently being handled", "gauge")
+    w.Sample("agi_active_sessions", float64(stats["active_connections"].(int)))
+    
+    w.Header("agi_sessions_total", "AGI sessions handled since the server started", "counter")
+    w.Sample("agi_sessions_total", float64(stats["total_sessions"].(uint64)))
+}
@@ -3,13 +3,16 @@ package ami
 import (
     "bufio"
     "fmt"
-    "log"
     "net"
     "strings"
     "sync"
     "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
 )
 
+var log = logger.Component("ami")
+
 type Manager struct {
     host     string
     port     int
@@ -58,7 +61,7 @@ func (m *Manager) Connect() error {
     // Start event reader
     go m.eventReader()
     
-    log.Println("AMI connected successfully")
+    log.Infof("AMI connected successfully")
     return nil
 }
 
@@ -0,0 +1,418 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
+)
+
+// providerView hides the SIP password in API responses
+func providerView(p *models.Provider) *models.Provider {
+    cp := *p
+    if cp.Password != "" {
+        cp.Password = "********"
+    }
+    return &cp
+}
+
+// GET /api/providers[?type=], POST /api/providers
+func (s *Server) handleProviders(w http.ResponseWriter, req *http.Request) {
+    switch req.Method {
+    case http.MethodGet:
+        providers, err := s.providerMgr.ListProviders(req.URL.Query().Get("type"))
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        views := make([]*models.Provider, 0, len(providers))
+        for _, p := range providers {
+            views = append(views, providerView(p))
+        }
+        writeJSON(w, http.StatusOK, views)
+        
+    case http.MethodPost:
+        p := &models.Provider{Port: 5060, Weight: 1, Active: true}
+        if err := decodeBody(req, p); err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        if err := s.providerMgr.AddProvider(p); err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusCreated, providerView(p))
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodPost)
+    }
+}
+
+// GET, DELETE /api/providers/{name}
+func (s *Server) handleProvider(w http.ResponseWriter, req *http.Request) {
+    params := pathParam(req, "/api/providers/")
+    if len(params) != 1 {
+        writeError(w, fmt.Errorf("provider name %w", provider.ErrNotFound))
+        return
+    }
+    name := params[0]
+    
+    switch req.Method {
+    case http.MethodGet:
+        p, err := s.providerMgr.GetProvider(name)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusOK, providerView(p))
+        
+    case http.MethodDelete:
+        if err := s.providerMgr.DeleteProvider(name); err != nil {
+            writeError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+    }
+}
+
+type addDIDsRequest struct {
+    Provider string   `json:"provider"`
+    Numbers  []string `json:"numbers"`
+    Country  string   `json:"country"`
+    City     string   `json:"city"`
+}
+
+// GET /api/dids[?provider=&in_use=&limit=], POST /api/dids
+func (s *Server) handleDIDs(w http.ResponseWriter, req *http.Request) {
+    switch req.Method {
+    case http.MethodGet:
+        query := req.URL.Query()
+        filter := provider.DIDFilter{ProviderName: query.Get("provider")}
+        
+        if v := query.Get("in_use"); v != "" {
+            inUse, err := strconv.ParseBool(v)
+            if err != nil {
+                writeError(w, fmt.Errorf("%w: in_use must be true or false", provider.ErrInvalid))
+                return
+            }
+            filter.InUse = &inUse
+        }
+        
+        if v := query.Get("limit"); v != "" {
+            limit, err := strconv.Atoi(v)
+            if err != nil || limit < 0 {
+                writeError(w, fmt.Errorf("%w: limit must be a positive number", provider.ErrInvalid))
+                return
+            }
+            filter.Limit = limit
+        }
+        
+        dids, err := s.providerMgr.ListDIDs(filter)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if dids == nil {
+            dids = []*models.DID{}
+        }
+        writeJSON(w, http.StatusOK, dids)
+        
+    case http.MethodPost:
+        var body addDIDsRequest
+        if err := decodeBody(req, &body); err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        if len(body.Numbers) == 0 {
+            writeError(w, fmt.Errorf("%w: at least one DID number is required", provider.ErrInvalid))
+            return
+        }
+        
+        added := []string{}
+        for _, number := range body.Numbers {
+            did := &models.DID{
+                Number:       number,
+                ProviderName: body.Provider,
+                Country:      body.Country,
+                City:         body.City,
+            }
+            if err := s.providerMgr.AddDID(did); err != nil {
+                writeError(w, err)
+                return
+            }
+            added = append(added, number)
+        }
+        writeJSON(w, http.StatusCreated, map[string]interface{}{"added": added})
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodPost)
+    }
+}
+
+// DELETE /api/dids/{number}, POST /api/dids/{number}/release
+func (s *Server) handleDID(w http.ResponseWriter, req *http.Request) {
+    params := pathParam(req, "/api/dids/")
+    
+    switch {
+    case len(params) == 1:
+        if req.Method != http.MethodDelete {
+            methodNotAllowed(w, http.MethodDelete)
+            return
+        }
+        if err := s.providerMgr.DeleteDID(params[0]); err != nil {
+            writeError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+        
+    case len(params) == 2 && params[1] == "release":
+        if req.Method != http.MethodPost {
+            methodNotAllowed(w, http.MethodPost)
+            return
+        }
+        if err := s.router.ReleaseDID(params[0]); err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusOK, map[string]string{"released": params[0]})
+        
+    default:
+        writeError(w, fmt.Errorf("DID endpoint %w", provider.ErrNotFound))
+    }
+}
+
+// GET /api/routes, POST /api/routes
+func (s *Server) handleRoutes(w http.ResponseWriter, req *http.Request) {
+    switch req.Method {
+    case http.MethodGet:
+        routes, err := s.providerMgr.ListRoutes()
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if routes == nil {
+            routes = []*models.ProviderRoute{}
+        }
+        writeJSON(w, http.StatusOK, routes)
+        
+    case http.MethodPost:
+        route := &models.ProviderRoute{LoadBalanceMode: "round_robin", Active: true}
+        if err := decodeBody(req, route); err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        if err := s.providerMgr.AddProviderRoute(route); err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusCreated, route)
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodPost)
+    }
+}
+
+// GET, DELETE /api/routes/{name}
+func (s *Server) handleRoute(w http.ResponseWriter, req *http.Request) {
+    params := pathParam(req, "/api/routes/")
+    if len(params) != 1 {
+        writeError(w, fmt.Errorf("route name %w", provider.ErrNotFound))
+        return
+    }
+    name := params[0]
+    
+    switch req.Method {
+    case http.MethodGet:
+        route, err := s.providerMgr.GetRoute(name)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusOK, route)
+        
+    case http.MethodDelete:
+        if err := s.providerMgr.DeleteProviderRoute(name); err != nil {
+            writeError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+    }
+}
+
+// GET /api/groups, POST /api/groups
+func (s *Server) handleGroups(w http.ResponseWriter, req *http.Request) {
+    switch req.Method {
+    case http.MethodGet:
+        writeJSON(w, http.StatusOK, s.providerMgr.ListGroups())
+        
+    case http.MethodPost:
+        group := &models.ProviderGroup{}
+        if err := decodeBody(req, group); err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        if err := s.providerMgr.AddGroup(group); err != nil {
+            writeError(w, err)
+            return
+        }
+        
+        saved, err := s.providerMgr.GetGroup(group.Name)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusCreated, saved)
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodPost)
+    }
+}
+
+// GET, DELETE /api/groups/{name}
+func (s *Server) handleGroup(w http.ResponseWriter, req *http.Request) {
+    params := pathParam(req, "/api/groups/")
+    if len(params) != 1 {
+        writeError(w, fmt.Errorf("group name %w", provider.ErrNotFound))
+        return
+    }
+    name := params[0]
+    
+    switch req.Method {
+    case http.MethodGet:
+        group, err := s.providerMgr.GetGroup(name)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusOK, group)
+        
+    case http.MethodDelete:
+        if err := s.providerMgr.DeleteGroup(name); err != nil {
+            writeError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+        
+    default:
+        methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+    }
+}
+
+// GET /api/stats
+func (s *Server) handleStats(w http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodGet {
+        methodNotAllowed(w, http.MethodGet)
+        return
+    }
+    
+    stats := s.router.GetStatistics()
+    for key, value := range s.providerMgr.GetRouterStats() {
+        if _, exists := stats[key]; !exists {
+            stats[key] = value
+        }
+    }
+    
+    lb := s.router.GetLoadBalancer()
+    providers, _ := s.providerMgr.ListProviders("")
+    lbStats := make([]models.LoadBalancerStats, 0, len(providers))
+    for _, p := range providers {
+        lbStats = append(lbStats, lb.GetProviderStats(p.Name))
+    }
+    stats["load_balancer"] = lbStats
+    
+    writeJSON(w, http.StatusOK, stats)
+}
+
+// GET /api/calls[?status=&limit=&active=true]
+func (s *Server) handleCalls(w http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodGet {
+        methodNotAllowed(w, http.MethodGet)
+        return
+    }
+    
+    query := req.URL.Query()
+    
+    if active, _ := strconv.ParseBool(query.Get("active")); active {
+        calls, err := s.router.ActiveCalls()
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if calls == nil {
+            calls = []*models.CallRecord{}
+        }
+        writeJSON(w, http.StatusOK, calls)
+        return
+    }
+    
+    limit := 20
+    if v := query.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            writeError(w, fmt.Errorf("%w: limit must be a positive number", provider.ErrInvalid))
+            return
+        }
+        limit = n
+    }
+    
+    calls, err := s.router.ListCallRecords(query.Get("status"), limit)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if calls == nil {
+        calls = []*models.CallRecord{}
+    }
+    writeJSON(w, http.StatusOK, calls)
+}
+
+// GET /api/calls/{call_id}/legs
+func (s *Server) handleCall(w http.ResponseWriter, req *http.Request) {
+    params := pathParam(req, "/api/calls/")
+    if len(params) != 2 || params[1] != "legs" {
+        writeError(w, fmt.Errorf("call endpoint %w", provider.ErrNotFound))
+        return
+    }
+    
+    if req.Method != http.MethodGet {
+        methodNotAllowed(w, http.MethodGet)
+        return
+    }
+    
+    legs, err := s.router.ListCallLegs(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if legs == nil {
+        legs = []*models.CallLeg{}
+    }
+    writeJSON(w, http.StatusOK, legs)
+}
+
+// POST /api/reload
+func (s *Server) handleReload(w http.ResponseWriter, req *http.Request) {
+    if req.Method != http.MethodPost {
+        methodNotAllowed(w, http.MethodPost)
+        return
+    }
+    
+    if err := s.providerMgr.Reload(); err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/router"
+)
+
+var log = logger.Component("api")
+
+// Server exposes the provider, DID and route management of the CLI as a
+// JSON HTTP API. It runs inside the AGI process, so every change goes through
+// the same provider.Manager and Router that route live calls.
+type Server struct {
+    providerMgr *provider.Manager
+    router      *router.Router
+    httpServer  *http.Server
+}
+
+// NewServer creates an API server listening on addr (e.g. "127.0.0.1:8080").
+// Every request must carry token as a bearer token; with an empty token all
+// requests are refused.
+func NewServer(providerMgr *provider.Manager, r *router.Router, addr, token string) *Server {
+    s := &Server{
+        providerMgr: providerMgr,
+        router:      r,
+    }
+    
+    mux := http.NewServeMux()
+    mux.HandleFunc("/api/providers", s.handleProviders)
+    mux.HandleFunc("/api/providers/", s.handleProvider)
+    mux.HandleFunc("/api/dids", s.handleDIDs)
+    mux.HandleFunc("/api/dids/", s.handleDID)
+    mux.HandleFunc("/api/routes", s.handleRoutes)
+    mux.HandleFunc("/api/routes/", s.handleRoute)
+    mux.HandleFunc("/api/groups", s.handleGroups)
+    mux.HandleFunc("/api/groups/", s.handleGroup)
+    mux.HandleFunc("/api/stats", s.handleStats)
+    mux.HandleFunc("/api/calls", s.handleCalls)
+    mux.HandleFunc("/api/calls/", s.handleCall)
+    mux.HandleFunc("/api/reload", s.handleReload)
+    
+    s.httpServer = &http.Server{
+        Addr:         addr,
+        Handler:      logRequests(requireToken(token, mux)),
+        ReadTimeout:  10 * time.Second,
+        WriteTimeout: 30 * time.Second,
+    }
+    
+    return s
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+    return s.httpServer.Handler
+}
+
+// Start serves the API until Stop is called
+func (s *Server) Start() error {
+    log.Infof("Server listening on %s", s.httpServer.Addr)
+    
+    if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        return err
+    }
+    return nil
+}
+
+// Stop gracefully stops the API server
+func (s *Server) Stop() {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    
+    if err := s.httpServer.Shutdown(ctx); err != nil {
+        log.Errorf("Error during shutdown: %v", err)
+    }
+    log.Infof("Server stopped")
+}
+
+func logRequests(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        start := time.Now()
+        next.ServeHTTP(w, req)
+        log.Debugf("%s %s (%v)", req.Method, req.URL.Path, time.Since(start))
+    })
+}
+
+// requireToken refuses requests that do not carry token in an
+// "Authorization: Bearer" header
+func requireToken(token string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        given, ok := bearerToken(req)
+        if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+            log.Warnf("Unauthorized %s %s from %s", req.Method, req.URL.Path, req.RemoteAddr)
+            w.Header().Set("WWW-Authenticate", `Bearer realm="router"`)
+            writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+            return
+        }
+        next.ServeHTTP(w, req)
+    })
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(req *http.Request) (string, bool) {
+    scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+    if !ok || !strings.EqualFold(scheme, "Bearer") {
+        return "", false
+    }
+    token = strings.TrimSpace(token)
+    return token, token != ""
+}
+
+// pathParam returns the part of the URL path after prefix, split on "/"
+func pathParam(req *http.Request, prefix string) []string {
+    rest := strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/")
+    if rest == "" {
+        return nil
+    }
+    return strings.Split(rest, "/")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        log.Errorf("Failed to encode response: %v", err)
+    }
+}
+
+// writeError maps manager and router errors to HTTP status codes
+func writeError(w http.ResponseWriter, err error) {
+    status := http.StatusInternalServerError
+    switch {
+    case errors.Is(err, provider.ErrInvalid):
+        status = http.StatusBadRequest
+    case errors.Is(err, provider.ErrNotFound), errors.Is(err, router.ErrDIDNotFound):
+        status = http.StatusNotFound
+    case errors.Is(err, provider.ErrConflict):
+        status = http.StatusConflict
+    }
+    
+    writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+    w.Header().Set("Allow", strings.Join(allowed, ", "))
+    writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+}
+
+// decodeBody decodes a JSON request body, rejecting unknown fields
+func decodeBody(req *http.Request, v interface{}) error {
+    dec := json.NewDecoder(req.Body)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(v); err != nil {
+        return fmt.Errorf("%w: invalid JSON body: %v", provider.ErrInvalid, err)
+    }
+    return nil
+}
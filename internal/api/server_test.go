@@ -0,0 +1,54 @@
+package api
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestRequireToken(t *testing.T) {
+    ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        w.WriteHeader(http.StatusNoContent)
+    })
+    
+    tests := []struct {
+        name          string
+        token, header string
+        want          int
+    }{
+        {"no header", "secret", "", http.StatusUnauthorized},
+        {"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+        {"token prefix", "secret", "Bearer secre", http.StatusUnauthorized},
+        {"other scheme", "secret", "Basic secret", http.StatusUnauthorized},
+        {"empty bearer", "secret", "Bearer ", http.StatusUnauthorized},
+        {"no token configured", "", "Bearer ", http.StatusUnauthorized},
+        {"right token", "secret", "Bearer secret", http.StatusNoContent},
+        {"scheme in lower case", "secret", "bearer secret", http.StatusNoContent},
+    }
+    
+    for _, tt := range tests {
+        req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+        if tt.header != "" {
+            req.Header.Set("Authorization", tt.header)
+        }
+        rec := httptest.NewRecorder()
+        requireToken(tt.token, ok).ServeHTTP(rec, req)
+        
+        if rec.Code != tt.want {
+            t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+        }
+        if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+            t.Errorf("%s: 401 without WWW-Authenticate", tt.name)
+        }
+    }
+}
+
+func TestServerRequiresToken(t *testing.T) {
+    handler := NewServer(nil, nil, "127.0.0.1:0", "secret").Handler()
+    
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/providers", nil))
+    if rec.Code != http.StatusUnauthorized {
+        t.Errorf("request without a token got %d, want 401", rec.Code)
+    }
+}
@@ -4,13 +4,15 @@ import (
     "database/sql"
 //    "encoding/json"
     "fmt"
-    "log"
     "strings"
     
     "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
     "github.com/hamzaKhattat/asterisk-router-production/internal/models"
 )
 
+var log = logger.Component("ara")
+
 // ARA Manager handles all Asterisk Realtime Architecture operations
 type Manager struct {
     db *sql.DB
@@ -192,25 +194,56 @@ func (m *Manager) CreateEndpoint(provider *models.Provider) error {
     }
     
     // Create IP-based authentication if needed
-    if provider.AuthType == "ip" || provider.AuthType == "both" {
-        // Using backticks for the match column
-        ipQuery := `
-            INSERT INTO ps_endpoint_id_ips (id, endpoint, ` + "`match`" + `)
-            VALUES (?, ?, ?)
-            ON DUPLICATE KEY UPDATE
-                endpoint = VALUES(endpoint),
-                ` + "`match`" + ` = VALUES(` + "`match`" + `)`
-        
+    if err := m.identifyByIP(provider, endpointID); err != nil {
+        return err
+    }
+    
+    log.Infof("Created ARA endpoint for provider %s (auth: %s)", provider.Name, provider.AuthType)
+    return nil
+}
+
+// identifyByIP writes one ps_endpoint_id_ips row per allowed address of an
+// IP-authenticated provider (its host if it has no list) and removes the
+// rows it no longer needs. Addresses, CIDRs and hostnames are all valid
+// match values; Asterisk resolves the hostnames itself.
+func (m *Manager) identifyByIP(provider *models.Provider, endpointID string) error {
+    if provider.AuthType != "ip" && provider.AuthType != "both" {
+        _, err := m.db.Exec("DELETE FROM ps_endpoint_id_ips WHERE endpoint = ?", endpointID)
+        return err
+    }
+    
+    addresses := provider.AllowedIPs
+    if len(addresses) == 0 {
+        addresses = []string{provider.Host}
+    }
+    
+    // Using backticks for the match column
+    ipQuery := `
+        INSERT INTO ps_endpoint_id_ips (id, endpoint, ` + "`match`" + `)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            endpoint = VALUES(endpoint),
+            ` + "`match`" + ` = VALUES(` + "`match`" + `)`
+    
+    var keep []string
+    args := []interface{}{endpointID}
+    for i, match := range addresses {
         ipID := fmt.Sprintf("ip-%s", provider.Name)
-        match := fmt.Sprintf("%s/32", provider.Host)
-        
+        if i > 0 {
+            ipID = fmt.Sprintf("ip-%s-%d", provider.Name, i+1)
+        }
         if _, err := m.db.Exec(ipQuery, ipID, endpointID, match); err != nil {
             return err
         }
+        keep = append(keep, "?")
+        args = append(args, ipID)
     }
     
-    log.Printf("Created ARA endpoint for provider %s (auth: %s)", provider.Name, provider.AuthType)
-    return nil
+    // Drop the rows of addresses taken off the list, after the new ones are
+    // in so the provider is never left unidentified
+    _, err := m.db.Exec("DELETE FROM ps_endpoint_id_ips WHERE endpoint = ? AND id NOT IN ("+
+        strings.Join(keep, ", ")+")", args...)
+    return err
 }
 
 // DeleteEndpoint removes a PJSIP endpoint from ARA
@@ -218,10 +251,9 @@ func (m *Manager) DeleteEndpoint(providerName string) error {
     endpointID := fmt.Sprintf("endpoint-%s", providerName)
     authID := fmt.Sprintf("auth-%s", providerName)
     aorID := fmt.Sprintf("aor-%s", providerName)
-    ipID := fmt.Sprintf("ip-%s", providerName)
     
     // Delete in reverse order of creation
-    m.db.Exec("DELETE FROM ps_endpoint_id_ips WHERE id = ?", ipID)
+    m.db.Exec("DELETE FROM ps_endpoint_id_ips WHERE endpoint = ?", endpointID)
     m.db.Exec("DELETE FROM ps_endpoints WHERE id = ?", endpointID)
     m.db.Exec("DELETE FROM ps_auths WHERE id = ?", authID)
     m.db.Exec("DELETE FROM ps_aors WHERE id = ?", aorID)
@@ -261,9 +293,12 @@ func (m *Manager) CreateDialplan() error {
         {"_X.", 9, "GotoIf", "$[\"${ROUTER_STATUS}\" = \"success\"]?10:99"},
         {"_X.", 10, "Set", "CALLERID(num)=${ANI_TO_SEND}"},
         {"_X.", 11, "Dial", "PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180,U(subrecord^${UNIQUEID})"},
-        {"_X.", 12, "Goto", "99"},
-        {"_X.", 99, "Congestion", "5"},
-        {"_X.", 100, "Hangup", ""},
+        {"_X.", 12, "AGI", "agi://localhost:8002/dialResult"},
+        {"_X.", 13, "AGI", "agi://localhost:8002/processRetry"},
+        {"_X.", 14, "GotoIf", "$[\"${ROUTER_STATUS}\" = \"success\"]?10:99"},
+        {"_X.", 99, "ExecIf", "$[\"${ROUTER_HANGUP_CAUSE}\" != \"\"]?Hangup(${ROUTER_HANGUP_CAUSE})"},
+        {"_X.", 100, "Congestion", "5"},
+        {"_X.", 101, "Hangup", ""},
     }
     
     for _, ext := range inboundExtensions {
@@ -278,15 +313,20 @@ func (m *Manager) CreateDialplan() error {
         appdata  string
     }{
         {"_X.", 1, "NoOp", "Return call from S3: ${CALLERID(num)} -> ${EXTEN}"},
-        {"_X.", 2, "Set", "__INTERMEDIATE_PROVIDER=${CHANNEL(endpoint)}"},
-        {"_X.", 3, "Set", "__SOURCE_IP=${CHANNEL(pjsip,remote_addr)}"},
-        {"_X.", 4, "AGI", "agi://localhost:8002/processReturn"},
-        {"_X.", 5, "GotoIf", "$[\"${ROUTER_STATUS}\" = \"success\"]?6:99"},
-        {"_X.", 6, "Set", "CALLERID(num)=${ANI_TO_SEND}"},
-        {"_X.", 7, "Dial", "PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180"},
-        {"_X.", 8, "Goto", "99"},
-        {"_X.", 99, "Congestion", "5"},
-        {"_X.", 100, "Hangup", ""},
+        {"_X.", 2, "Set", "CHANNEL(hangup_handler_push)=hangup-handler,s,1"},
+        {"_X.", 3, "Set", "RETURN_DID=${EXTEN}"},
+        {"_X.", 4, "Set", "__INTERMEDIATE_PROVIDER=${CHANNEL(endpoint)}"},
+        {"_X.", 5, "Set", "__SOURCE_IP=${CHANNEL(pjsip,remote_addr)}"},
+        {"_X.", 6, "AGI", "agi://localhost:8002/processReturn"},
+        {"_X.", 7, "GotoIf", "$[\"${ROUTER_STATUS}\" = \"success\"]?8:99"},
+        {"_X.", 8, "Set", "CALLERID(num)=${ANI_TO_SEND}"},
+        {"_X.", 9, "Dial", "PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180"},
+        {"_X.", 10, "AGI", "agi://localhost:8002/dialResult"},
+        {"_X.", 11, "AGI", "agi://localhost:8002/processRetry"},
+        {"_X.", 12, "GotoIf", "$[\"${ROUTER_STATUS}\" = \"success\"]?8:99"},
+        {"_X.", 99, "ExecIf", "$[\"${ROUTER_HANGUP_CAUSE}\" != \"\"]?Hangup(${ROUTER_HANGUP_CAUSE})"},
+        {"_X.", 100, "Congestion", "5"},
+        {"_X.", 101, "Hangup", ""},
     }
     
     for _, ext := range intermediateExtensions {
@@ -304,8 +344,9 @@ func (m *Manager) CreateDialplan() error {
         {"_X.", 2, "Set", "__FINAL_PROVIDER=${CHANNEL(endpoint)}"},
         {"_X.", 3, "Set", "__SOURCE_IP=${CHANNEL(pjsip,remote_addr)}"},
         {"_X.", 4, "AGI", "agi://localhost:8002/processFinal"},
-        {"_X.", 5, "Congestion", "5"},
-        {"_X.", 6, "Hangup", ""},
+        {"_X.", 5, "ExecIf", "$[\"${ROUTER_HANGUP_CAUSE}\" != \"\"]?Hangup(${ROUTER_HANGUP_CAUSE})"},
+        {"_X.", 6, "Congestion", "5"},
+        {"_X.", 7, "Hangup", ""},
     }
     
     for _, ext := range finalExtensions {
@@ -344,7 +385,7 @@ func (m *Manager) CreateDialplan() error {
         m.insertExtension("subrecord", ext.exten, ext.priority, ext.app, ext.appdata)
     }
     
-    log.Println("Dialplan created successfully in ARA")
+    log.Infof("Dialplan created successfully in ARA")
     return nil
 }
 
@@ -364,6 +405,6 @@ func (m *Manager) insertExtension(context, exten string, priority int, app, appd
 func (m *Manager) ReloadDialplan() error {
     // This would use AMI to trigger reload
     // For now, log the action
-    log.Println("Dialplan reload triggered")
+    log.Infof("Dialplan reload triggered")
     return nil
 }
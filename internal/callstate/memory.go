@@ -0,0 +1,124 @@
+package callstate
+
+import (
+    "sync"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// MemoryStore keeps call state in process memory. It is the default for a
+// single router instance and is handy for tests.
+type MemoryStore struct {
+    mu        sync.RWMutex
+    calls     map[string]*models.CallRecord
+    didToCall map[string]string // DID -> CallID mapping
+}
+
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        calls:     make(map[string]*models.CallRecord),
+        didToCall: make(map[string]string),
+    }
+}
+
+func (s *MemoryStore) Put(record *models.CallRecord) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    // Drop the DID index of the previous version if the DID changed
+    if old, exists := s.calls[record.CallID]; exists && old.AssignedDID != record.AssignedDID {
+        delete(s.didToCall, old.AssignedDID)
+    }
+    
+    cp := *record
+    s.calls[record.CallID] = &cp
+    if record.AssignedDID != "" {
+        s.didToCall[record.AssignedDID] = record.CallID
+    }
+    
+    return nil
+}
+
+func (s *MemoryStore) Get(callID string) (*models.CallRecord, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    record, exists := s.calls[callID]
+    if !exists {
+        return nil, ErrNotFound
+    }
+    
+    cp := *record
+    return &cp, nil
+}
+
+func (s *MemoryStore) GetByDID(did string) (*models.CallRecord, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    callID, exists := s.didToCall[did]
+    if !exists {
+        return nil, ErrNotFound
+    }
+    
+    cp := *s.calls[callID]
+    return &cp, nil
+}
+
+func (s *MemoryStore) FindByNumbers(ani, dnis string) (*models.CallRecord, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    for _, record := range s.calls {
+        if record.OriginalANI == ani && record.OriginalDNIS == dnis {
+            cp := *record
+            return &cp, nil
+        }
+    }
+    
+    return nil, ErrNotFound
+}
+
+func (s *MemoryStore) Delete(callID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    
+    record, exists := s.calls[callID]
+    if !exists {
+        return ErrNotFound
+    }
+    
+    delete(s.calls, callID)
+    if s.didToCall[record.AssignedDID] == callID {
+        delete(s.didToCall, record.AssignedDID)
+    }
+    
+    return nil
+}
+
+func (s *MemoryStore) List() ([]*models.CallRecord, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    records := make([]*models.CallRecord, 0, len(s.calls))
+    for _, record := range s.calls {
+        cp := *record
+        records = append(records, &cp)
+    }
+    
+    return records, nil
+}
+
+func (s *MemoryStore) CountByInbound(provider string) (int, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    
+    count := 0
+    for _, record := range s.calls {
+        if record.InboundProvider == provider {
+            count++
+        }
+    }
+    
+    return count, nil
+}
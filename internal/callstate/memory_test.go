@@ -0,0 +1,114 @@
+package callstate
+
+import (
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestMemoryStoreCopies(t *testing.T) {
+    s := NewMemoryStore()
+    record := &models.CallRecord{CallID: "c1", AssignedDID: "100", Status: "ACTIVE"}
+    if err := s.Put(record); err != nil {
+        t.Fatal(err)
+    }
+    
+    // Changes are only visible once Put again
+    record.Status = "RETURNED_FROM_S3"
+    got, err := s.Get("c1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.Status != "ACTIVE" {
+        t.Errorf("status %s before Put, want ACTIVE", got.Status)
+    }
+    
+    got.Status = "COMPLETED"
+    if again, _ := s.Get("c1"); again.Status != "ACTIVE" {
+        t.Errorf("changing a returned record changed the store to %s", again.Status)
+    }
+    
+    records, _ := s.List()
+    records[0].Status = "COMPLETED"
+    if again, _ := s.Get("c1"); again.Status != "ACTIVE" {
+        t.Errorf("changing a listed record changed the store to %s", again.Status)
+    }
+}
+
+func TestMemoryStoreLookups(t *testing.T) {
+    s := NewMemoryStore()
+    s.Put(&models.CallRecord{CallID: "c1", AssignedDID: "100", OriginalANI: "1555", OriginalDNIS: "4420"})
+    s.Put(&models.CallRecord{CallID: "c2", AssignedDID: "200", OriginalANI: "1666", OriginalDNIS: "4421"})
+    
+    tests := []struct {
+        name   string
+        lookup func() (*models.CallRecord, error)
+        want   string // CallID, "" for ErrNotFound
+    }{
+        {"get", func() (*models.CallRecord, error) { return s.Get("c2") }, "c2"},
+        {"get unknown", func() (*models.CallRecord, error) { return s.Get("c3") }, ""},
+        {"by DID", func() (*models.CallRecord, error) { return s.GetByDID("100") }, "c1"},
+        {"by unknown DID", func() (*models.CallRecord, error) { return s.GetByDID("300") }, ""},
+        {"by numbers", func() (*models.CallRecord, error) { return s.FindByNumbers("1666", "4421") }, "c2"},
+        {"by swapped numbers", func() (*models.CallRecord, error) { return s.FindByNumbers("1555", "4421") }, ""},
+    }
+    
+    for _, tt := range tests {
+        record, err := tt.lookup()
+        switch {
+        case tt.want == "" && err != ErrNotFound:
+            t.Errorf("%s: got %v, %v; want ErrNotFound", tt.name, record, err)
+        case tt.want != "" && (err != nil || record.CallID != tt.want):
+            t.Errorf("%s: got %v, %v; want %s", tt.name, record, err, tt.want)
+        }
+    }
+}
+
+func TestMemoryStoreDIDChange(t *testing.T) {
+    s := NewMemoryStore()
+    s.Put(&models.CallRecord{CallID: "c1", AssignedDID: "100"})
+    s.Put(&models.CallRecord{CallID: "c1", AssignedDID: "101"})
+    
+    if _, err := s.GetByDID("100"); err != ErrNotFound {
+        t.Errorf("old DID still finds the call: %v", err)
+    }
+    if record, err := s.GetByDID("101"); err != nil || record.CallID != "c1" {
+        t.Errorf("new DID got %v, %v; want c1", record, err)
+    }
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+    s := NewMemoryStore()
+    s.Put(&models.CallRecord{CallID: "c1", AssignedDID: "100"})
+    // c2 takes over the DID before c1 is deleted
+    s.Put(&models.CallRecord{CallID: "c2", AssignedDID: "100"})
+    
+    if err := s.Delete("c1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Delete("c1"); err != ErrNotFound {
+        t.Errorf("second delete got %v, want ErrNotFound", err)
+    }
+    if record, err := s.GetByDID("100"); err != nil || record.CallID != "c2" {
+        t.Errorf("DID of c2 got %v, %v after deleting c1; want c2", record, err)
+    }
+    
+    s.Delete("c2")
+    if records, _ := s.List(); len(records) != 0 {
+        t.Errorf("%d calls left, want none", len(records))
+    }
+}
+
+func TestMemoryStoreCountByInbound(t *testing.T) {
+    s := NewMemoryStore()
+    s.Put(&models.CallRecord{CallID: "c1", InboundProvider: "s1a"})
+    s.Put(&models.CallRecord{CallID: "c2", InboundProvider: "s1a"})
+    s.Put(&models.CallRecord{CallID: "c3", InboundProvider: "s1b"})
+    s.Delete("c2")
+    
+    for provider, want := range map[string]int{"s1a": 1, "s1b": 1, "s1c": 0} {
+        if n, err := s.CountByInbound(provider); err != nil || n != want {
+            t.Errorf("%s has %d calls (%v), want %d", provider, n, err, want)
+        }
+    }
+}
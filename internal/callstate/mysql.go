@@ -0,0 +1,114 @@
+package callstate
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// MySQLStore keeps call state in the active_calls table so that every router
+// node in a cluster sees the same in-flight calls
+type MySQLStore struct {
+    db *sql.DB
+}
+
+func NewMySQLStore(db *sql.DB) *MySQLStore {
+    return &MySQLStore{db: db}
+}
+
+func (s *MySQLStore) Put(record *models.CallRecord) error {
+    state, err := json.Marshal(record)
+    if err != nil {
+        return fmt.Errorf("failed to encode call state: %v", err)
+    }
+    
+    query := `
+        INSERT INTO active_calls (call_id, assigned_did, original_ani, original_dnis, inbound_provider, node_id, state)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            assigned_did = VALUES(assigned_did),
+            original_ani = VALUES(original_ani),
+            original_dnis = VALUES(original_dnis),
+            inbound_provider = VALUES(inbound_provider),
+            node_id = VALUES(node_id),
+            state = VALUES(state)`
+    
+    _, err = s.db.Exec(query, record.CallID, record.AssignedDID, record.OriginalANI,
+        record.OriginalDNIS, record.InboundProvider, record.NodeID, state)
+    return err
+}
+
+func (s *MySQLStore) Get(callID string) (*models.CallRecord, error) {
+    return s.queryOne("SELECT state FROM active_calls WHERE call_id = ?", callID)
+}
+
+func (s *MySQLStore) GetByDID(did string) (*models.CallRecord, error) {
+    return s.queryOne("SELECT state FROM active_calls WHERE assigned_did = ? ORDER BY updated_at DESC LIMIT 1", did)
+}
+
+func (s *MySQLStore) FindByNumbers(ani, dnis string) (*models.CallRecord, error) {
+    return s.queryOne("SELECT state FROM active_calls WHERE original_ani = ? AND original_dnis = ? ORDER BY updated_at DESC LIMIT 1", ani, dnis)
+}
+
+func (s *MySQLStore) Delete(callID string) error {
+    result, err := s.db.Exec("DELETE FROM active_calls WHERE call_id = ?", callID)
+    if err != nil {
+        return err
+    }
+    
+    if affected, _ := result.RowsAffected(); affected == 0 {
+        return ErrNotFound
+    }
+    
+    return nil
+}
+
+func (s *MySQLStore) List() ([]*models.CallRecord, error) {
+    rows, err := s.db.Query("SELECT state FROM active_calls")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var records []*models.CallRecord
+    for rows.Next() {
+        var state []byte
+        if err := rows.Scan(&state); err != nil {
+            return nil, err
+        }
+        
+        record := &models.CallRecord{}
+        if err := json.Unmarshal(state, record); err != nil {
+            return nil, fmt.Errorf("failed to decode call state: %v", err)
+        }
+        records = append(records, record)
+    }
+    
+    return records, rows.Err()
+}
+
+func (s *MySQLStore) CountByInbound(provider string) (int, error) {
+    var count int
+    err := s.db.QueryRow("SELECT COUNT(*) FROM active_calls WHERE inbound_provider = ?", provider).Scan(&count)
+    return count, err
+}
+
+func (s *MySQLStore) queryOne(query string, args ...interface{}) (*models.CallRecord, error) {
+    var state []byte
+    err := s.db.QueryRow(query, args...).Scan(&state)
+    if err == sql.ErrNoRows {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    
+    record := &models.CallRecord{}
+    if err := json.Unmarshal(state, record); err != nil {
+        return nil, fmt.Errorf("failed to decode call state: %v", err)
+    }
+    
+    return record, nil
+}
@@ -0,0 +1,40 @@
+package callstate
+
+import (
+    "errors"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// ErrNotFound is returned when no in-flight call matches the lookup
+var ErrNotFound = errors.New("call not found")
+
+// Store holds the state of in-flight calls. The router only talks to a Store,
+// so several router instances can share calls by sharing a Store backend.
+//
+// Records are copied in and out: callers must Put a record again after
+// changing it for the change to become visible to other nodes.
+type Store interface {
+    // Put creates or replaces the state of a call
+    Put(record *models.CallRecord) error
+    
+    // Get returns the call with the given CallID
+    Get(callID string) (*models.CallRecord, error)
+    
+    // GetByDID returns the call currently holding the given DID
+    GetByDID(did string) (*models.CallRecord, error)
+    
+    // FindByNumbers returns a call by its original ANI/DNIS pair
+    FindByNumbers(ani, dnis string) (*models.CallRecord, error)
+    
+    // Delete removes a call. It returns ErrNotFound if the call was already
+    // removed, which lets concurrent nodes race safely to finish a call.
+    Delete(callID string) error
+    
+    // List returns every in-flight call
+    List() ([]*models.CallRecord, error)
+    
+    // CountByInbound returns the number of in-flight calls received from
+    // the given inbound provider
+    CountByInbound(provider string) (int, error)
+}
@@ -3,8 +3,10 @@ package cli
 import (
     "bufio"
     "database/sql"
+    "errors"
     "fmt"
     "os"
+    "sort"
     "strconv"
     "strings"
     "time"
@@ -13,6 +15,7 @@ import (
     "github.com/olekukonko/tablewriter"
     "github.com/fatih/color"
     
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
     "github.com/hamzaKhattat/asterisk-router-production/internal/models"
     "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
     "github.com/hamzaKhattat/asterisk-router-production/internal/db"
@@ -47,11 +50,13 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     // Provider add flags
     providerAddCmd.Flags().StringP("type", "t", "", "Provider type: inbound, intermediate, final (required)")
     providerAddCmd.Flags().StringP("host", "H", "", "Provider host/IP (required)")
+    providerAddCmd.Flags().StringSlice("allow", nil, "Source IP, CIDR or hostname calls may come from (repeatable, default host)")
     providerAddCmd.Flags().IntP("port", "p", 5060, "Provider port")
     providerAddCmd.Flags().StringP("username", "u", "", "Provider username")
     providerAddCmd.Flags().StringP("password", "P", "", "Provider password")
     providerAddCmd.Flags().StringP("codecs", "c", "ulaw,alaw", "Codecs (comma-separated)")
     providerAddCmd.Flags().IntP("max-channels", "m", 0, "Max concurrent channels (0=unlimited)")
+    providerAddCmd.Flags().Int("max-cps", 0, "Max calls per second from an inbound provider (0=unlimited)")
     providerAddCmd.Flags().IntP("priority", "r", 0, "Provider priority")
     providerAddCmd.Flags().IntP("weight", "w", 1, "Provider weight for load balancing")
     
@@ -127,6 +132,64 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     
     didCmd.AddCommand(didAddCmd, didListCmd, didDeleteCmd, didReleaseCmd)
     
+    // Provider group commands
+    groupCmd := &cobra.Command{
+        Use:   "group",
+        Short: "Manage provider groups",
+    }
+    
+    groupAddCmd := &cobra.Command{
+        Use:   "add <name> [providers...]",
+        Short: "Add a provider group, optionally with members",
+        Args:  cobra.MinimumNArgs(1),
+        Run:   addGroup,
+    }
+    groupAddCmd.Flags().StringP("description", "d", "", "Group description")
+    
+    groupListCmd := &cobra.Command{
+        Use:   "list",
+        Short: "List provider groups",
+        Run:   listGroups,
+    }
+    
+    groupShowCmd := &cobra.Command{
+        Use:   "show <name>",
+        Short: "Show a provider group and its members",
+        Args:  cobra.ExactArgs(1),
+        Run:   showGroup,
+    }
+    
+    groupDeleteCmd := &cobra.Command{
+        Use:   "delete <name>",
+        Short: "Delete a provider group",
+        Args:  cobra.ExactArgs(1),
+        Run:   deleteGroup,
+    }
+    
+    groupMemberCmd := &cobra.Command{
+        Use:   "member",
+        Short: "Manage the members of a provider group",
+    }
+    
+    groupMemberAddCmd := &cobra.Command{
+        Use:   "add <group> <provider>",
+        Short: "Add a provider to a group or change its overrides",
+        Args:  cobra.ExactArgs(2),
+        Run:   addGroupMember,
+    }
+    groupMemberAddCmd.Flags().IntP("weight", "w", 0, "Weight within the group (default: the provider's)")
+    groupMemberAddCmd.Flags().IntP("priority", "r", 0, "Priority within the group (default: the provider's)")
+    
+    groupMemberRemoveCmd := &cobra.Command{
+        Use:   "remove <group> <provider>",
+        Short: "Remove a provider from a group",
+        Args:  cobra.ExactArgs(2),
+        Run:   removeGroupMember,
+    }
+    
+    groupMemberCmd.AddCommand(groupMemberAddCmd, groupMemberRemoveCmd)
+    groupCmd.AddCommand(groupAddCmd, groupListCmd, groupShowCmd, groupDeleteCmd, groupMemberCmd)
+    
     // Route commands
     routeCmd := &cobra.Command{
         Use:   "route",
@@ -136,12 +199,24 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     routeAddCmd := &cobra.Command{
         Use:   "add <name> <inbound> <intermediate> <final>",
         Short: "Add a new route",
+        Long:  "Add a new route. Intermediate and final name a provider or a provider group.",
         Args:  cobra.ExactArgs(4),
         Run:   addRoute,
     }
     
-    routeAddCmd.Flags().StringP("mode", "m", "round_robin", "Load balance mode: round_robin, weighted, priority, failover")
+    routeAddCmd.Flags().StringP("mode", "m", "round_robin", "Load balance mode: "+strings.Join(loadbalancer.Modes, ", "))
     routeAddCmd.Flags().IntP("priority", "p", 0, "Route priority")
+    routeAddCmd.Flags().Float64("asr-weight", 0, "Quality mode: weight of the answer-seizure ratio (0=default)")
+    routeAddCmd.Flags().Float64("acd-weight", 0, "Quality mode: weight of the average call duration (0=default)")
+    routeAddCmd.Flags().Float64("pdd-weight", 0, "Quality mode: weight of the post-dial delay (0=default)")
+    routeAddCmd.Flags().String("dnis-prefix", "", "Only match DNIS starting with this prefix")
+    routeAddCmd.Flags().String("dnis-regex", "", "Only match DNIS matching this regular expression")
+    routeAddCmd.Flags().String("ani-prefix", "", "Only match ANI starting with this prefix")
+    routeAddCmd.Flags().String("country", "", "Only match DNIS of this country (ISO code, e.g. GB)")
+    routeAddCmd.Flags().StringArray("schedule", nil, "Active window, e.g. \"mon-fri 08:00-18:00\" (repeatable, default always)")
+    routeAddCmd.Flags().String("timezone", "", "Timezone of the schedule (default UTC)")
+    routeAddCmd.Flags().StringSlice("holiday", nil, "Date the route is inactive, YYYY-MM-DD (repeatable)")
+    routeAddCmd.Flags().String("verify-policy", provider.VerifyLog, "On ANI/DNIS mismatch of a return leg: "+strings.Join(provider.VerifyPolicies, ", "))
     
     routeListCmd := &cobra.Command{
         Use:   "list",
@@ -165,6 +240,130 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     
     routeCmd.AddCommand(routeAddCmd, routeListCmd, routeDeleteCmd, routeShowCmd)
     
+    // Rate deck commands
+    rateCmd := &cobra.Command{
+        Use:   "rate",
+        Short: "Manage provider rate decks",
+    }
+    
+    rateImportCmd := &cobra.Command{
+        Use:   "import <provider> <file>",
+        Short: "Import a rate deck from CSV",
+        Long:  "Import a rate deck from CSV: prefix,rate_per_minute,billing_increment,effective_date,currency",
+        Args:  cobra.ExactArgs(2),
+        Run:   importRates,
+    }
+    rateImportCmd.Flags().Bool("replace", false, "Replace the provider's whole rate deck")
+    
+    rateListCmd := &cobra.Command{
+        Use:   "list <provider>",
+        Short: "List the rate deck of a provider",
+        Args:  cobra.ExactArgs(1),
+        Run:   listRates,
+    }
+    rateListCmd.Flags().String("prefix", "", "Only prefixes starting with this")
+    
+    rateLookupCmd := &cobra.Command{
+        Use:   "lookup <provider> <number>",
+        Short: "Show the rate a provider charges for a number",
+        Args:  cobra.ExactArgs(2),
+        Run:   lookupRate,
+    }
+    
+    rateCmd.AddCommand(rateImportCmd, rateListCmd, rateLookupCmd)
+    
+    // Number list commands
+    listCmd := &cobra.Command{
+        Use:   "list",
+        Short: "Manage ANI/DNIS blocklists and allowlists",
+        Long:  "Manage ANI/DNIS blocklists and allowlists. A number ending in * is a prefix, e.g. 1900*.",
+    }
+    
+    listAddCmd := &cobra.Command{
+        Use:   "add <block|allow> <ani|dnis> <number>",
+        Short: "Add a number or prefix to a list",
+        Args:  cobra.ExactArgs(3),
+        Run:   addListEntry,
+    }
+    listAddCmd.Flags().String("note", "", "Why the number is listed")
+    
+    listRemoveCmd := &cobra.Command{
+        Use:   "remove <block|allow> <ani|dnis> <number>",
+        Short: "Remove a number or prefix from a list",
+        Args:  cobra.ExactArgs(3),
+        Run:   removeListEntry,
+    }
+    
+    listImportCmd := &cobra.Command{
+        Use:   "import <block|allow> <ani|dnis> <file>",
+        Short: "Import numbers from CSV",
+        Long:  "Import numbers from CSV, one per line: number,note",
+        Args:  cobra.ExactArgs(3),
+        Run:   importListEntries,
+    }
+    listImportCmd.Flags().Bool("replace", false, "Replace the entries of the list, field and scope")
+    
+    listShowCmd := &cobra.Command{
+        Use:   "show [block|allow]",
+        Short: "Show list entries",
+        Args:  cobra.MaximumNArgs(1),
+        Run:   showListEntries,
+    }
+    listShowCmd.Flags().String("field", "", "Only ani or dnis entries")
+    
+    for _, c := range []*cobra.Command{listAddCmd, listRemoveCmd, listImportCmd, listShowCmd} {
+        c.Flags().StringP("provider", "p", "", "Only for calls from this inbound provider")
+        c.Flags().StringP("route", "r", "", "Only for calls on this route")
+    }
+    
+    listCmd.AddCommand(listAddCmd, listRemoveCmd, listImportCmd, listShowCmd)
+    
+    // Number translation commands
+    translateCmd := &cobra.Command{
+        Use:   "translate",
+        Short: "Manage per-provider ANI/DNIS translation rules",
+        Long: `Manage per-provider ANI/DNIS translation rules. Inbound rules rewrite the
+numbers of calls received from a provider, outbound rules those of calls sent
+to it. Actions:
+  strip <prefix>      remove a leading prefix
+  add <prefix>        prepend a prefix
+  regex <replacement> replace the --pattern expression
+  e164 <country>      normalize national and 00/011 numbers to E.164`,
+    }
+    
+    translateAddCmd := &cobra.Command{
+        Use:   "add <provider> <inbound|outbound> <strip|add|regex|e164> [value]",
+        Short: "Add a translation rule",
+        Args:  cobra.RangeArgs(3, 4),
+        Run:   addNumberRule,
+    }
+    translateAddCmd.Flags().StringP("field", "f", provider.FieldBoth, "Number to rewrite: ani, dnis or both")
+    translateAddCmd.Flags().String("pattern", "", "Only rewrite numbers matching this regex (the expression replaced for regex)")
+    translateAddCmd.Flags().Int("position", 0, "Order among the provider's rules (default: last)")
+    
+    translateListCmd := &cobra.Command{
+        Use:   "list [provider]",
+        Short: "List translation rules",
+        Args:  cobra.MaximumNArgs(1),
+        Run:   listNumberRules,
+    }
+    
+    translateDeleteCmd := &cobra.Command{
+        Use:   "delete <id>",
+        Short: "Delete a translation rule",
+        Args:  cobra.ExactArgs(1),
+        Run:   deleteNumberRule,
+    }
+    
+    translateTestCmd := &cobra.Command{
+        Use:   "test <provider> <inbound|outbound> <ani> <dnis>",
+        Short: "Show how a provider's rules rewrite a call's numbers",
+        Args:  cobra.ExactArgs(4),
+        Run:   testNumberRules,
+    }
+    
+    translateCmd.AddCommand(translateAddCmd, translateListCmd, translateDeleteCmd, translateTestCmd)
+    
     // Stats commands
     statsCmd := &cobra.Command{
         Use:   "stats",
@@ -176,6 +375,17 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     statsCmd.Flags().BoolP("calls", "c", false, "Show call statistics")
     statsCmd.Flags().BoolP("dids", "d", false, "Show DID statistics")
     
+    // Margin report command
+    marginCmd := &cobra.Command{
+        Use:   "margin",
+        Short: "Show revenue, cost and margin of completed calls",
+        Run:   showMargin,
+    }
+    
+    marginCmd.Flags().StringP("by", "b", "day,route,provider", "Group by (comma-separated): "+strings.Join(marginGroupNames, ", "))
+    marginCmd.Flags().StringP("from", "f", "", "First day (YYYY-MM-DD, default 7 days ago)")
+    marginCmd.Flags().StringP("to", "t", "", "Last day (YYYY-MM-DD, default today)")
+    
     // Load balancer command
     lbCmd := &cobra.Command{
         Use:   "lb",
@@ -193,6 +403,34 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
     callsCmd.Flags().IntP("limit", "l", 20, "Number of records to show")
     callsCmd.Flags().StringP("status", "s", "", "Filter by status")
     
+    // Blocked calls command
+    blockedCmd := &cobra.Command{
+        Use:   "blocked",
+        Short: "Show calls blocked by fraud rules",
+        Run:   showBlockedCalls,
+    }
+    
+    blockedCmd.Flags().IntP("limit", "l", 20, "Number of records to show")
+    blockedCmd.Flags().StringP("rule", "r", "", "Filter by rule")
+    blockedCmd.Flags().StringP("provider", "p", "", "Filter by inbound provider")
+    
+    // Verification commands
+    verifyCmd := &cobra.Command{
+        Use:   "verify",
+        Short: "Inspect ANI/DNIS and source IP verification of return legs",
+    }
+    
+    verifyReportCmd := &cobra.Command{
+        Use:   "report",
+        Short: "Summarize verification failures per provider",
+        Run:   showVerifyReport,
+    }
+    
+    verifyReportCmd.Flags().IntP("days", "d", 7, "Number of days to cover")
+    verifyReportCmd.Flags().StringP("provider", "p", "", "Filter by provider")
+    
+    verifyCmd.AddCommand(verifyReportCmd)
+    
     // Monitor command
     monitorCmd := &cobra.Command{
         Use:   "monitor",
@@ -200,7 +438,14 @@ Manage providers, DIDs, and routes for the Asterisk routing system.`,
         Run:   monitorSystem,
     }
     
-    rootCmd.AddCommand(providerCmd, didCmd, routeCmd, statsCmd, lbCmd, callsCmd, monitorCmd)
+    // Reload command
+    reloadCmd := &cobra.Command{
+        Use:   "reload",
+        Short: "Make running AGI servers reload providers and routes",
+        Run:   requestReload,
+    }
+    
+    rootCmd.AddCommand(providerCmd, didCmd, groupCmd, routeCmd, rateCmd, listCmd, translateCmd, statsCmd, marginCmd, lbCmd, callsCmd, blockedCmd, verifyCmd, monitorCmd, reloadCmd)
     
     return rootCmd
 }
@@ -211,11 +456,13 @@ func addProvider(cmd *cobra.Command, args []string) {
     
     providerType, _ := cmd.Flags().GetString("type")
     host, _ := cmd.Flags().GetString("host")
+    allowed, _ := cmd.Flags().GetStringSlice("allow")
     port, _ := cmd.Flags().GetInt("port")
     username, _ := cmd.Flags().GetString("username")
     password, _ := cmd.Flags().GetString("password")
     codecsStr, _ := cmd.Flags().GetString("codecs")
     maxChannels, _ := cmd.Flags().GetInt("max-channels")
+    maxCPS, _ := cmd.Flags().GetInt("max-cps")
     priority, _ := cmd.Flags().GetInt("priority")
     weight, _ := cmd.Flags().GetInt("weight")
     
@@ -244,11 +491,13 @@ func addProvider(cmd *cobra.Command, args []string) {
         Name:        name,
         Type:        providerType,
         Host:        host,
+        AllowedIPs:  allowed,
         Port:        port,
         Username:    username,
         Password:    password,
         Codecs:      codecs,
         MaxChannels: maxChannels,
+        MaxCPS:      maxCPS,
         Priority:    priority,
         Weight:      weight,
         Active:      true,
@@ -272,6 +521,10 @@ func addProvider(cmd *cobra.Command, args []string) {
         fmt.Printf("  Auth: IP-based\n")
     }
     
+    if len(provider.AllowedIPs) > 0 {
+        fmt.Printf("  Allowed Sources: %s\n", strings.Join(provider.AllowedIPs, ", "))
+    }
+    
     fmt.Printf("  Codecs: %s\n", strings.Join(codecs, ", "))
     
     if maxChannels > 0 {
@@ -280,6 +533,10 @@ func addProvider(cmd *cobra.Command, args []string) {
         fmt.Printf("  Max Channels: Unlimited\n")
     }
     
+    if maxCPS > 0 {
+        fmt.Printf("  Max CPS: %d\n", maxCPS)
+    }
+    
     fmt.Printf("  Priority: %d\n", priority)
     fmt.Printf("  Weight: %d\n", weight)
 }
@@ -373,6 +630,9 @@ func showProvider(cmd *cobra.Command, args []string) {
     fmt.Printf("Type: %s\n", provider.Type)
     fmt.Printf("Host: %s\n", provider.Host)
     fmt.Printf("Port: %d\n", provider.Port)
+    if len(provider.AllowedIPs) > 0 {
+        fmt.Printf("Allowed Sources: %s\n", strings.Join(provider.AllowedIPs, ", "))
+    }
     
     if provider.Username != "" {
         fmt.Printf("Authentication: Username/Password\n")
@@ -390,6 +650,12 @@ func showProvider(cmd *cobra.Command, args []string) {
         fmt.Printf("Max Channels: Unlimited\n")
     }
     
+    if provider.MaxCPS > 0 {
+        fmt.Printf("Max CPS: %d\n", provider.MaxCPS)
+    } else {
+        fmt.Printf("Max CPS: Unlimited\n")
+    }
+    
     fmt.Printf("Priority: %d\n", provider.Priority)
     fmt.Printf("Weight: %d\n", provider.Weight)
     
@@ -491,17 +757,9 @@ func addDIDs(cmd *cobra.Command, args []string) {
     // Add DIDs to database
     success := 0
     failed := 0
-    for _, did := range didsToAdd {
-        query := `
-            INSERT INTO dids (number, provider_name, country, city, in_use, created_at, updated_at)
-            VALUES (?, ?, ?, ?, 0, NOW(), NOW())
-            ON DUPLICATE KEY UPDATE
-                provider_name = VALUES(provider_name),
-                country = VALUES(country),
-                city = VALUES(city),
-                updated_at = NOW()`
-        
-        if _, err := db.DB.Exec(query, did.Number, did.ProviderName, did.Country, did.City); err != nil {
+    for i := range didsToAdd {
+        did := &didsToAdd[i]
+        if err := providerMgr.AddDID(did); err != nil {
             color.Red("Failed to add DID %s: %v", did.Number, err)
             failed++
         } else {
@@ -598,20 +856,7 @@ func listDIDs(cmd *cobra.Command, args []string) {
 func deleteDID(cmd *cobra.Command, args []string) {
     number := args[0]
     
-    // Check if DID is in use
-    var inUse bool
-    err := db.DB.QueryRow("SELECT in_use FROM dids WHERE number = ?", number).Scan(&inUse)
-    if err == sql.ErrNoRows {
-        color.Red("Error: DID not found")
-        os.Exit(1)
-    }
-    
-    if inUse {
-        color.Red("Error: Cannot delete DID %s - currently in use", number)
-        os.Exit(1)
-    }
-    
-    if _, err := db.DB.Exec("DELETE FROM dids WHERE number = ?", number); err != nil {
+    if err := providerMgr.DeleteDID(number); err != nil {
         color.Red("Error: Failed to delete DID: %v", err)
         os.Exit(1)
     }
@@ -647,19 +892,21 @@ func addRoute(cmd *cobra.Command, args []string) {
     
     mode, _ := cmd.Flags().GetString("mode")
     priority, _ := cmd.Flags().GetInt("priority")
+    asrWeight, _ := cmd.Flags().GetFloat64("asr-weight")
+    acdWeight, _ := cmd.Flags().GetFloat64("acd-weight")
+    pddWeight, _ := cmd.Flags().GetFloat64("pdd-weight")
+    dnisPrefix, _ := cmd.Flags().GetString("dnis-prefix")
+    dnisPattern, _ := cmd.Flags().GetString("dnis-regex")
+    aniPrefix, _ := cmd.Flags().GetString("ani-prefix")
+    country, _ := cmd.Flags().GetString("country")
+    windows, _ := cmd.Flags().GetStringArray("schedule")
+    timezone, _ := cmd.Flags().GetString("timezone")
+    holidays, _ := cmd.Flags().GetStringSlice("holiday")
+    verifyPolicy, _ := cmd.Flags().GetString("verify-policy")
     
     // Validate load balance mode
-    validModes := []string{"round_robin", "weighted", "priority", "failover"}
-    isValidMode := false
-    for _, m := range validModes {
-        if mode == m {
-            isValidMode = true
-            break
-        }
-    }
-    
-    if !isValidMode {
-        color.Red("Error: Invalid load balance mode. Must be: round_robin, weighted, priority, or failover")
+    if !loadbalancer.IsValidMode(mode) {
+        color.Red("Error: Invalid load balance mode. Must be one of: %s", strings.Join(loadbalancer.Modes, ", "))
         os.Exit(1)
     }
     
@@ -671,6 +918,26 @@ func addRoute(cmd *cobra.Command, args []string) {
         LoadBalanceMode:      mode,
         Priority:             priority,
         Active:               true,
+        ASRWeight:            asrWeight,
+        ACDWeight:            acdWeight,
+        PDDWeight:            pddWeight,
+        DNISPrefix:           dnisPrefix,
+        DNISPattern:          dnisPattern,
+        ANIPrefix:            aniPrefix,
+        Country:              country,
+        VerifyPolicy:         verifyPolicy,
+    }
+    
+    if len(windows) > 0 || timezone != "" || len(holidays) > 0 {
+        route.Schedule = &models.RouteSchedule{Timezone: timezone, Holidays: holidays}
+        for _, spec := range windows {
+            window, err := provider.ParseScheduleWindow(spec)
+            if err != nil {
+                color.Red("Error: %v", err)
+                os.Exit(1)
+            }
+            route.Schedule.Windows = append(route.Schedule.Windows, window)
+        }
     }
     
     if err := providerMgr.AddProviderRoute(route); err != nil {
@@ -684,13 +951,49 @@ func addRoute(cmd *cobra.Command, args []string) {
     fmt.Println("\nRoute Details:")
     fmt.Printf("  Path: %s → %s → %s\n", inbound, intermediate, final)
     fmt.Printf("  Load Balance Mode: %s\n", mode)
+    fmt.Printf("  Match: %s\n", routeMatch(route))
+    fmt.Printf("  Schedule: %s\n", provider.DescribeSchedule(route.Schedule))
+    fmt.Printf("  Verify Policy: %s\n", route.VerifyPolicy)
     fmt.Printf("  Priority: %d\n", priority)
+    if mode == "quality" {
+        fmt.Printf("  Quality Weights: %s\n", qualityWeights(route))
+    }
+}
+
+// routeMatch describes the match criteria of a route
+func routeMatch(route *models.ProviderRoute) string {
+    var criteria []string
+    if route.DNISPrefix != "" {
+        criteria = append(criteria, "DNIS "+route.DNISPrefix+"*")
+    }
+    if route.DNISPattern != "" {
+        criteria = append(criteria, "DNIS /"+route.DNISPattern+"/")
+    }
+    if route.Country != "" {
+        criteria = append(criteria, "country "+route.Country)
+    }
+    if route.ANIPrefix != "" {
+        criteria = append(criteria, "ANI "+route.ANIPrefix+"*")
+    }
+    if len(criteria) == 0 {
+        return "any"
+    }
+    return strings.Join(criteria, ", ")
+}
+
+// qualityWeights describes the quality mode weights of a route
+func qualityWeights(route *models.ProviderRoute) string {
+    if route.ASRWeight == 0 && route.ACDWeight == 0 && route.PDDWeight == 0 {
+        return "default"
+    }
+    return fmt.Sprintf("ASR %.2f, ACD %.2f, PDD %.2f", route.ASRWeight, route.ACDWeight, route.PDDWeight)
 }
 
 func listRoutes(cmd *cobra.Command, args []string) {
     query := `
         SELECT name, inbound_provider, intermediate_provider, final_provider, 
-               load_balance_mode, priority, active
+               load_balance_mode, priority, active,
+               dnis_prefix, dnis_pattern, ani_prefix, country
         FROM provider_routes
         ORDER BY priority DESC, name`
     
@@ -702,7 +1005,7 @@ func listRoutes(cmd *cobra.Command, args []string) {
     defer rows.Close()
     
     table := tablewriter.NewWriter(os.Stdout)
-    table.SetHeader([]string{"Name", "Inbound", "Intermediate", "Final", "Mode", "Priority", "Status"})
+    table.SetHeader([]string{"Name", "Inbound", "Intermediate", "Final", "Match", "Mode", "Priority", "Status"})
     table.SetBorder(true)
     table.SetRowLine(false)
     table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
@@ -712,7 +1015,8 @@ func listRoutes(cmd *cobra.Command, args []string) {
     for rows.Next() {
         var route models.ProviderRoute
         err := rows.Scan(&route.Name, &route.InboundProvider, &route.IntermediateProvider,
-            &route.FinalProvider, &route.LoadBalanceMode, &route.Priority, &route.Active)
+            &route.FinalProvider, &route.LoadBalanceMode, &route.Priority, &route.Active,
+            &route.DNISPrefix, &route.DNISPattern, &route.ANIPrefix, &route.Country)
         if err != nil {
             continue
         }
@@ -727,6 +1031,7 @@ func listRoutes(cmd *cobra.Command, args []string) {
             route.InboundProvider,
             route.IntermediateProvider,
             route.FinalProvider,
+            routeMatch(&route),
             route.LoadBalanceMode,
             strconv.Itoa(route.Priority),
             status,
@@ -752,7 +1057,7 @@ func deleteRoute(cmd *cobra.Command, args []string) {
         return
     }
     
-    if _, err := db.DB.Exec("DELETE FROM provider_routes WHERE name = ?", name); err != nil {
+    if err := providerMgr.DeleteProviderRoute(name); err != nil {
         color.Red("Error: Failed to delete route: %v", err)
         os.Exit(1)
     }
@@ -763,19 +1068,8 @@ func deleteRoute(cmd *cobra.Command, args []string) {
 func showRoute(cmd *cobra.Command, args []string) {
     name := args[0]
     
-    var route models.ProviderRoute
-    query := `
-        SELECT name, inbound_provider, intermediate_provider, final_provider, 
-               load_balance_mode, priority, active, created_at
-        FROM provider_routes
-        WHERE name = ?`
-    
-    err := db.DB.QueryRow(query, name).Scan(
-        &route.Name, &route.InboundProvider, &route.IntermediateProvider,
-        &route.FinalProvider, &route.LoadBalanceMode, &route.Priority,
-        &route.Active, &route.CreatedAt)
-    
-    if err == sql.ErrNoRows {
+    route, err := providerMgr.GetRoute(name)
+    if errors.Is(err, provider.ErrNotFound) {
         color.Red("Error: Route not found")
         os.Exit(1)
     } else if err != nil {
@@ -787,8 +1081,14 @@ func showRoute(cmd *cobra.Command, args []string) {
     fmt.Println(strings.Repeat("-", 40))
     fmt.Printf("Path: %s → %s → %s\n", 
         route.InboundProvider, route.IntermediateProvider, route.FinalProvider)
+    fmt.Printf("Match: %s\n", routeMatch(route))
     fmt.Printf("Load Balance Mode: %s\n", route.LoadBalanceMode)
+    if route.LoadBalanceMode == "quality" {
+        fmt.Printf("Quality Weights: %s\n", qualityWeights(route))
+    }
     fmt.Printf("Priority: %d\n", route.Priority)
+    fmt.Printf("Schedule: %s\n", provider.DescribeSchedule(route.Schedule))
+    fmt.Printf("Verify Policy: %s\n", route.VerifyPolicy)
     
     if route.Active {
         fmt.Printf("Status: %s\n", color.GreenString("Active"))
@@ -796,9 +1096,597 @@ func showRoute(cmd *cobra.Command, args []string) {
         fmt.Printf("Status: %s\n", color.RedString("Inactive"))
     }
     
+    now := time.Now()
+    next, ok, err := provider.NextActive(route, now)
+    switch {
+    case err != nil:
+        fmt.Printf("Next Active: %s\n", color.RedString("invalid schedule: %v", err))
+    case !ok:
+        fmt.Printf("Next Active: %s\n", color.RedString("never"))
+    case !next.After(now):
+        fmt.Printf("Next Active: %s\n", color.GreenString("now"))
+    default:
+        fmt.Printf("Next Active: %s (in %s)\n", next.Format("2006-01-02 15:04 MST"),
+            next.Sub(now).Round(time.Minute))
+    }
+    
     fmt.Printf("Created: %s\n", route.CreatedAt.Format("2006-01-02 15:04:05"))
 }
 
+// Provider group command handlers
+func addGroup(cmd *cobra.Command, args []string) {
+    description, _ := cmd.Flags().GetString("description")
+    
+    group := &models.ProviderGroup{
+        Name:        args[0],
+        Description: description,
+    }
+    for _, providerName := range args[1:] {
+        group.Members = append(group.Members, models.GroupMember{ProviderName: providerName})
+    }
+    
+    if err := providerMgr.AddGroup(group); err != nil {
+        color.Red("Error: Failed to add group: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Group '%s' saved", group.Name)
+}
+
+func listGroups(cmd *cobra.Command, args []string) {
+    groups := providerMgr.ListGroups()
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Name", "Members", "Description"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    for _, group := range groups {
+        var members []string
+        for _, member := range group.Members {
+            members = append(members, member.ProviderName)
+        }
+        table.Append([]string{
+            group.Name,
+            strings.Join(members, ", "),
+            group.Description,
+        })
+    }
+    
+    table.Render()
+    fmt.Printf("\nTotal: %d groups\n", len(groups))
+}
+
+func showGroup(cmd *cobra.Command, args []string) {
+    group, err := providerMgr.GetGroup(args[0])
+    if err != nil {
+        color.Red("Error: %v", err)
+        os.Exit(1)
+    }
+    
+    fmt.Printf("\nGroup: %s\n", group.Name)
+    fmt.Println(strings.Repeat("-", 40))
+    if group.Description != "" {
+        fmt.Printf("Description: %s\n", group.Description)
+    }
+    fmt.Printf("Created: %s\n\n", group.CreatedAt.Format("2006-01-02 15:04:05"))
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Provider", "Type", "Weight", "Priority", "Status"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    for _, member := range group.Members {
+        p, err := providerMgr.GetProvider(member.ProviderName)
+        if err != nil {
+            table.Append([]string{member.ProviderName, "-", "-", "-", color.RedString("Missing")})
+            continue
+        }
+        
+        weight := strconv.Itoa(p.Weight)
+        if member.Weight != nil {
+            weight = fmt.Sprintf("%d (provider %d)", *member.Weight, p.Weight)
+        }
+        priority := strconv.Itoa(p.Priority)
+        if member.Priority != nil {
+            priority = fmt.Sprintf("%d (provider %d)", *member.Priority, p.Priority)
+        }
+        status := color.GreenString("Active")
+        if !p.Active {
+            status = color.RedString("Inactive")
+        }
+        
+        table.Append([]string{p.Name, p.Type, weight, priority, status})
+    }
+    
+    table.Render()
+}
+
+func deleteGroup(cmd *cobra.Command, args []string) {
+    if err := providerMgr.DeleteGroup(args[0]); err != nil {
+        color.Red("Error: Failed to delete group: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Group '%s' deleted successfully", args[0])
+}
+
+func addGroupMember(cmd *cobra.Command, args []string) {
+    member := models.GroupMember{ProviderName: args[1]}
+    if cmd.Flags().Changed("weight") {
+        weight, _ := cmd.Flags().GetInt("weight")
+        member.Weight = &weight
+    }
+    if cmd.Flags().Changed("priority") {
+        priority, _ := cmd.Flags().GetInt("priority")
+        member.Priority = &priority
+    }
+    
+    if err := providerMgr.AddGroupMember(args[0], member); err != nil {
+        color.Red("Error: Failed to add member: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Provider '%s' is a member of group '%s'", args[1], args[0])
+}
+
+func removeGroupMember(cmd *cobra.Command, args []string) {
+    if err := providerMgr.RemoveGroupMember(args[0], args[1]); err != nil {
+        color.Red("Error: Failed to remove member: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Provider '%s' removed from group '%s'", args[1], args[0])
+}
+
+// Rate command handlers
+func importRates(cmd *cobra.Command, args []string) {
+    providerName, file := args[0], args[1]
+    replace, _ := cmd.Flags().GetBool("replace")
+    
+    f, err := os.Open(file)
+    if err != nil {
+        color.Red("Error: Failed to open file: %v", err)
+        os.Exit(1)
+    }
+    defer f.Close()
+    
+    rates, err := provider.ParseRateDeck(f, providerName)
+    if err != nil {
+        color.Red("Error: %v", err)
+        os.Exit(1)
+    }
+    
+    if err := providerMgr.ImportRates(providerName, rates, replace); err != nil {
+        color.Red("Error: Failed to import rates: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Imported %d rates for provider '%s'", len(rates), providerName)
+}
+
+func listRates(cmd *cobra.Command, args []string) {
+    prefix, _ := cmd.Flags().GetString("prefix")
+    
+    rates, err := providerMgr.ListRates(args[0], prefix)
+    if err != nil {
+        color.Red("Error: Failed to query rates: %v", err)
+        os.Exit(1)
+    }
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Prefix", "Rate/Min", "Increment", "Effective", "Currency"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    for _, rate := range rates {
+        table.Append([]string{
+            rate.Prefix,
+            fmt.Sprintf("%.6f", rate.RatePerMinute),
+            fmt.Sprintf("%ds", rate.BillingIncrement),
+            rate.EffectiveDate.Format("2006-01-02"),
+            rate.Currency,
+        })
+    }
+    
+    table.Render()
+    fmt.Printf("\nTotal: %d rates\n", len(rates))
+}
+
+func lookupRate(cmd *cobra.Command, args []string) {
+    rate, err := providerMgr.LookupRate(args[0], args[1])
+    if err != nil {
+        color.Red("Error: %v", err)
+        os.Exit(1)
+    }
+    
+    fmt.Printf("\nProvider: %s\n", rate.ProviderName)
+    fmt.Println(strings.Repeat("-", 40))
+    fmt.Printf("Prefix: %s\n", rate.Prefix)
+    fmt.Printf("Rate: %.6f %s/min\n", rate.RatePerMinute, rate.Currency)
+    fmt.Printf("Billing Increment: %ds\n", rate.BillingIncrement)
+    fmt.Printf("Effective: %s\n", rate.EffectiveDate.Format("2006-01-02"))
+}
+
+// Number list handlers
+
+// listEntryFromArgs builds a list entry from <list> <field> <number> and the
+// scope flags
+func listEntryFromArgs(cmd *cobra.Command, args []string) *models.ListEntry {
+    entry := &models.ListEntry{List: args[0], Field: args[1]}
+    entry.InboundProvider, _ = cmd.Flags().GetString("provider")
+    entry.RouteName, _ = cmd.Flags().GetString("route")
+    
+    if len(args) > 2 {
+        number, prefix, err := provider.ParseListNumber(args[2])
+        if err != nil {
+            color.Red("Error: %v", err)
+            os.Exit(1)
+        }
+        entry.Number, entry.Prefix = number, prefix
+    }
+    return entry
+}
+
+// listScopeString describes the scope of a list entry
+func listScopeString(entry *models.ListEntry) string {
+    var parts []string
+    if entry.InboundProvider != "" {
+        parts = append(parts, "provider "+entry.InboundProvider)
+    }
+    if entry.RouteName != "" {
+        parts = append(parts, "route "+entry.RouteName)
+    }
+    if len(parts) == 0 {
+        return "all calls"
+    }
+    return strings.Join(parts, ", ")
+}
+
+func addListEntry(cmd *cobra.Command, args []string) {
+    entry := listEntryFromArgs(cmd, args)
+    entry.Note, _ = cmd.Flags().GetString("note")
+    
+    if err := providerMgr.AddListEntry(entry); err != nil {
+        color.Red("Error: Failed to add list entry: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Added %s to the %s %slist (%s)", provider.FormatListNumber(entry), entry.Field, entry.List, listScopeString(entry))
+}
+
+func removeListEntry(cmd *cobra.Command, args []string) {
+    entry := listEntryFromArgs(cmd, args)
+    
+    if err := providerMgr.RemoveListEntry(entry); err != nil {
+        color.Red("Error: Failed to remove list entry: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Removed %s from the %s %slist (%s)", provider.FormatListNumber(entry), entry.Field, entry.List, listScopeString(entry))
+}
+
+func importListEntries(cmd *cobra.Command, args []string) {
+    scope := listEntryFromArgs(cmd, args[:2])
+    replace, _ := cmd.Flags().GetBool("replace")
+    
+    f, err := os.Open(args[2])
+    if err != nil {
+        color.Red("Error: Failed to open file: %v", err)
+        os.Exit(1)
+    }
+    defer f.Close()
+    
+    entries, err := provider.ParseNumberList(f)
+    if err != nil {
+        color.Red("Error: %v", err)
+        os.Exit(1)
+    }
+    
+    for _, entry := range entries {
+        entry.List, entry.Field = scope.List, scope.Field
+        entry.InboundProvider, entry.RouteName = scope.InboundProvider, scope.RouteName
+    }
+    
+    if err := providerMgr.ImportListEntries(entries, replace); err != nil {
+        color.Red("Error: Failed to import list entries: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Imported %d entries into the %s %slist (%s)", len(entries), scope.Field, scope.List, listScopeString(scope))
+}
+
+func showListEntries(cmd *cobra.Command, args []string) {
+    filter := models.ListEntry{}
+    if len(args) > 0 {
+        filter.List = args[0]
+    }
+    filter.Field, _ = cmd.Flags().GetString("field")
+    filter.InboundProvider, _ = cmd.Flags().GetString("provider")
+    filter.RouteName, _ = cmd.Flags().GetString("route")
+    
+    entries, err := providerMgr.ListEntries(filter)
+    if err != nil {
+        color.Red("Error: Failed to query list entries: %v", err)
+        os.Exit(1)
+    }
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"List", "Field", "Number", "Provider", "Route", "Note", "Added"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    for _, entry := range entries {
+        list := color.RedString(entry.List)
+        if entry.List == provider.ListAllow {
+            list = color.GreenString(entry.List)
+        }
+        table.Append([]string{
+            list,
+            entry.Field,
+            provider.FormatListNumber(entry),
+            entry.InboundProvider,
+            entry.RouteName,
+            entry.Note,
+            entry.CreatedAt.Format("2006-01-02"),
+        })
+    }
+    
+    table.Render()
+    fmt.Printf("\nTotal: %d entries\n", len(entries))
+}
+
+// Number translation handlers
+func addNumberRule(cmd *cobra.Command, args []string) {
+    rule := &models.NumberRule{
+        ProviderName: args[0],
+        Direction:    args[1],
+        Action:       args[2],
+    }
+    if len(args) > 3 {
+        rule.Value = args[3]
+    }
+    rule.Field, _ = cmd.Flags().GetString("field")
+    rule.Pattern, _ = cmd.Flags().GetString("pattern")
+    rule.Position, _ = cmd.Flags().GetInt("position")
+    
+    if err := providerMgr.AddNumberRule(rule); err != nil {
+        color.Red("Error: Failed to add translation rule: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Added %s %s rule %d for provider '%s'", rule.Direction, rule.Action, rule.ID, rule.ProviderName)
+}
+
+func listNumberRules(cmd *cobra.Command, args []string) {
+    providerName := ""
+    if len(args) > 0 {
+        providerName = args[0]
+    }
+    
+    rules, err := providerMgr.ListNumberRules(providerName)
+    if err != nil {
+        color.Red("Error: Failed to query translation rules: %v", err)
+        os.Exit(1)
+    }
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"ID", "Provider", "Direction", "Pos", "Field", "Action", "Pattern", "Value"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    for _, rule := range rules {
+        table.Append([]string{
+            strconv.Itoa(rule.ID),
+            rule.ProviderName,
+            rule.Direction,
+            strconv.Itoa(rule.Position),
+            rule.Field,
+            rule.Action,
+            rule.Pattern,
+            rule.Value,
+        })
+    }
+    
+    table.Render()
+    fmt.Printf("\nTotal: %d rules\n", len(rules))
+}
+
+func deleteNumberRule(cmd *cobra.Command, args []string) {
+    id, err := strconv.Atoi(args[0])
+    if err != nil {
+        color.Red("Error: Invalid rule ID: %s", args[0])
+        os.Exit(1)
+    }
+    
+    if err := providerMgr.DeleteNumberRule(id); err != nil {
+        color.Red("Error: Failed to delete translation rule: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Translation rule %d deleted", id)
+}
+
+func testNumberRules(cmd *cobra.Command, args []string) {
+    providerName, direction := args[0], args[1]
+    if direction != provider.DirectionInbound && direction != provider.DirectionOutbound {
+        color.Red("Error: Direction must be inbound or outbound")
+        os.Exit(1)
+    }
+    
+    ani, dnis := providerMgr.Translate(providerName, direction, args[2], args[3])
+    
+    fmt.Printf("\nProvider: %s (%s rules)\n", providerName, direction)
+    fmt.Println(strings.Repeat("-", 40))
+    fmt.Printf("ANI:  %s -> %s\n", args[2], ani)
+    fmt.Printf("DNIS: %s -> %s\n", args[3], dnis)
+}
+
+// Margin report handlers
+
+// marginGroups maps the --by names of the margin report to call_records columns
+var marginGroups = map[string]string{
+    "day":          "DATE_FORMAT(start_time, '%Y-%m-%d')",
+    "route":        "COALESCE(route_name, '')",
+    "provider":     "inbound_provider",
+    "intermediate": "intermediate_provider",
+    "final":        "final_provider",
+}
+
+var marginGroupNames = []string{"day", "route", "provider", "intermediate", "final"}
+
+func showMargin(cmd *cobra.Command, args []string) {
+    by, _ := cmd.Flags().GetString("by")
+    fromStr, _ := cmd.Flags().GetString("from")
+    toStr, _ := cmd.Flags().GetString("to")
+    
+    to := time.Now().Truncate(24 * time.Hour)
+    if toStr != "" {
+        t, err := time.Parse("2006-01-02", toStr)
+        if err != nil {
+            color.Red("Error: Invalid --to date: %s", toStr)
+            os.Exit(1)
+        }
+        to = t
+    }
+    from := to.AddDate(0, 0, -7)
+    if fromStr != "" {
+        t, err := time.Parse("2006-01-02", fromStr)
+        if err != nil {
+            color.Red("Error: Invalid --from date: %s", fromStr)
+            os.Exit(1)
+        }
+        from = t
+    }
+    
+    var columns, header []string
+    for _, name := range strings.Split(by, ",") {
+        name = strings.TrimSpace(name)
+        column, ok := marginGroups[name]
+        if !ok {
+            color.Red("Error: Invalid group '%s', must be one of: %s", name, strings.Join(marginGroupNames, ", "))
+            os.Exit(1)
+        }
+        columns = append(columns, column)
+        header = append(header, name)
+    }
+    
+    // Amounts in different currencies are never added up. Calls that could
+    // not be rated in one currency are reported without one.
+    columns = append(columns, "COALESCE(currency, '')")
+    header = append(header, "currency")
+    
+    query := fmt.Sprintf(`
+        SELECT %s, COUNT(*), COALESCE(SUM(duration), 0),
+               COALESCE(SUM(revenue), 0), COALESCE(SUM(cost), 0), COALESCE(SUM(margin), 0)
+        FROM call_records
+        WHERE status = 'COMPLETED' AND start_time >= ? AND start_time < ?
+        GROUP BY %s
+        ORDER BY %s`,
+        strings.Join(columns, ", "), strings.Join(columns, ", "), strings.Join(columns, ", "))
+    
+    rows, err := db.DB.Query(query, from.Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02"))
+    if err != nil {
+        color.Red("Error: Failed to query call records: %v", err)
+        os.Exit(1)
+    }
+    defer rows.Close()
+    
+    fmt.Printf("\nMargin from %s to %s\n\n", from.Format("2006-01-02"), to.Format("2006-01-02"))
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader(append(header, "Calls", "Minutes", "Revenue", "Cost", "Margin", "Margin %"))
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    type marginTotal struct {
+        calls, seconds        int64
+        revenue, cost, margin float64
+    }
+    totals := make(map[string]*marginTotal)
+    var currencies []string
+    
+    for rows.Next() {
+        keys := make([]sql.NullString, len(columns))
+        dest := make([]interface{}, 0, len(columns)+5)
+        for i := range keys {
+            dest = append(dest, &keys[i])
+        }
+        var calls, seconds int64
+        var revenue, cost, margin float64
+        dest = append(dest, &calls, &seconds, &revenue, &cost, &margin)
+        
+        if err := rows.Scan(dest...); err != nil {
+            color.Red("Error: Failed to read call records: %v", err)
+            os.Exit(1)
+        }
+        
+        row := make([]string, 0, len(columns)+6)
+        for _, key := range keys {
+            value := key.String
+            if value == "" {
+                value = "-"
+            }
+            row = append(row, value)
+        }
+        row = append(row,
+            strconv.FormatInt(calls, 10),
+            fmt.Sprintf("%.1f", float64(seconds)/60),
+            fmt.Sprintf("%.4f", revenue),
+            fmt.Sprintf("%.4f", cost),
+            fmt.Sprintf("%.4f", margin),
+            marginPercent(margin, revenue))
+        table.Append(row)
+        
+        currency := keys[len(keys)-1].String
+        total, ok := totals[currency]
+        if !ok {
+            total = &marginTotal{}
+            totals[currency] = total
+            currencies = append(currencies, currency)
+        }
+        total.calls += calls
+        total.seconds += seconds
+        total.revenue += revenue
+        total.cost += cost
+        total.margin += margin
+    }
+    
+    table.Render()
+    
+    fmt.Println()
+    sort.Strings(currencies)
+    for _, currency := range currencies {
+        total := totals[currency]
+        if currency == "" {
+            fmt.Printf("Unrated: %d calls, %.1f minutes\n", total.calls, float64(total.seconds)/60)
+            continue
+        }
+        fmt.Printf("Total %s: %d calls, %.1f minutes, revenue %.4f, cost %.4f, margin %.4f (%s)\n",
+            currency, total.calls, float64(total.seconds)/60, total.revenue, total.cost, total.margin,
+            marginPercent(total.margin, total.revenue))
+    }
+}
+
+func marginPercent(margin, revenue float64) string {
+    if revenue == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%.1f%%", margin/revenue*100)
+}
+
 // Stats command handlers
 func showStats(cmd *cobra.Command, args []string) {
     showProviders, _ := cmd.Flags().GetBool("providers")
@@ -857,7 +1745,7 @@ func showStats(cmd *cobra.Command, args []string) {
         
         query := `
             SELECT provider_name, total_calls, active_calls, failed_calls, 
-                   success_rate, avg_call_duration, is_healthy
+                   success_rate, avg_call_duration, is_healthy, rejected_calls
             FROM provider_stats
             ORDER BY provider_name`
         
@@ -866,16 +1754,16 @@ func showStats(cmd *cobra.Command, args []string) {
             defer rows.Close()
             
             table := tablewriter.NewWriter(os.Stdout)
-            table.SetHeader([]string{"Provider", "Total", "Active", "Failed", "Success%", "Avg Duration", "Health"})
+            table.SetHeader([]string{"Provider", "Total", "Active", "Failed", "Rejected", "Success%", "Avg Duration", "Health"})
             table.SetBorder(true)
             
             for rows.Next() {
                 var name string
-                var total, active, failed int64
+                var total, active, failed, rejected int64
                 var successRate, avgDuration float64
                 var isHealthy bool
                 
-                err := rows.Scan(&name, &total, &active, &failed, &successRate, &avgDuration, &isHealthy)
+                err := rows.Scan(&name, &total, &active, &failed, &successRate, &avgDuration, &isHealthy, &rejected)
                 if err != nil {
                     continue
                 }
@@ -890,6 +1778,7 @@ func showStats(cmd *cobra.Command, args []string) {
                     strconv.FormatInt(total, 10),
                     strconv.FormatInt(active, 10),
                     strconv.FormatInt(failed, 10),
+                    strconv.FormatInt(rejected, 10),
                     fmt.Sprintf("%.1f%%", successRate),
                     fmt.Sprintf("%.1fs", avgDuration),
                     health,
@@ -937,18 +1826,32 @@ func showLoadBalancer(cmd *cobra.Command, args []string) {
         for _, provider := range []string{route.InboundProvider, route.IntermediateProvider, route.FinalProvider} {
             var isHealthy bool
             var activeCalls int
+            var asr float64
+            var circuit string
+            var reachable bool
+            var score float64
+            var pddMs int
             err := db.DB.QueryRow(`
-                SELECT is_healthy, active_calls 
+                SELECT is_healthy, active_calls, asr, circuit_state, reachable, quality_score, post_dial_delay_ms
                 FROM provider_stats 
                 WHERE provider_name = ?
-            `, provider).Scan(&isHealthy, &activeCalls)
+            `, provider).Scan(&isHealthy, &activeCalls, &asr, &circuit, &reachable, &score, &pddMs)
             
             if err == nil {
                 health := color.GreenString("Healthy")
-                if !isHealthy {
+                if !reachable {
+                    health = color.RedString("Unreachable")
+                } else if circuit == "half_open" {
+                    health = color.YellowString("Recovering")
+                } else if !isHealthy {
                     health = color.RedString("Unhealthy")
                 }
-                fmt.Printf("    %s: %s (Active: %d)\n", provider, health, activeCalls)
+                if route.LoadBalanceMode == "quality" {
+                    fmt.Printf("    %s: %s (Active: %d, ASR: %.1f%%, PDD: %.1fs, Score: %.2f)\n",
+                        provider, health, activeCalls, asr, float64(pddMs)/1000, score)
+                } else {
+                    fmt.Printf("    %s: %s (Active: %d, ASR: %.1f%%)\n", provider, health, activeCalls, asr)
+                }
             } else {
                 fmt.Printf("    %s: No data\n", provider)
             }
@@ -1014,6 +1917,8 @@ func showCalls(cmd *cobra.Command, args []string) {
             statusColor = color.YellowString(record.Status)
         case "FAILED", "ABANDONED":
             statusColor = color.RedString(record.Status)
+        case "BUSY", "NO_ANSWER", "CANCELLED":
+            statusColor = color.MagentaString(record.Status)
         }
         
         table.Append([]string{
@@ -1031,6 +1936,149 @@ func showCalls(cmd *cobra.Command, args []string) {
     table.Render()
 }
 
+func showBlockedCalls(cmd *cobra.Command, args []string) {
+    limit, _ := cmd.Flags().GetInt("limit")
+    rule, _ := cmd.Flags().GetString("rule")
+    providerName, _ := cmd.Flags().GetString("provider")
+    
+    query := `
+        SELECT COALESCE(ani, ''), COALESCE(dnis, ''), COALESCE(inbound_provider, ''),
+               rule_name, COALESCE(reason, ''), blocked_at
+        FROM blocked_calls
+        WHERE 1=1`
+    
+    queryArgs := []interface{}{}
+    
+    if rule != "" {
+        query += " AND rule_name = ?"
+        queryArgs = append(queryArgs, rule)
+    }
+    if providerName != "" {
+        query += " AND inbound_provider = ?"
+        queryArgs = append(queryArgs, providerName)
+    }
+    
+    query += " ORDER BY blocked_at DESC LIMIT ?"
+    queryArgs = append(queryArgs, limit)
+    
+    rows, err := db.DB.Query(query, queryArgs...)
+    if err != nil {
+        color.Red("Error: Failed to query blocked calls: %v", err)
+        return
+    }
+    defer rows.Close()
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Time", "ANI", "DNIS", "Provider", "Rule", "Reason"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    
+    for rows.Next() {
+        var ani, dnis, inbound, ruleName, reason string
+        var blockedAt time.Time
+        if err := rows.Scan(&ani, &dnis, &inbound, &ruleName, &reason, &blockedAt); err != nil {
+            continue
+        }
+        
+        table.Append([]string{
+            blockedAt.Format("2006-01-02 15:04:05"),
+            ani,
+            dnis,
+            inbound,
+            ruleName,
+            reason,
+        })
+    }
+    
+    table.Render()
+}
+
+func showVerifyReport(cmd *cobra.Command, args []string) {
+    days, _ := cmd.Flags().GetInt("days")
+    providerName, _ := cmd.Flags().GetString("provider")
+    
+    // The S1 leg is recorded for completeness but never fails
+    query := `
+        SELECT COALESCE(provider_name, ''), verification_step,
+               COUNT(*),
+               SUM(NOT verified),
+               SUM(failure_reason = 'ip_mismatch'),
+               SUM(failure_reason IN ('ani_mismatch', 'ani_dnis_mismatch')),
+               SUM(failure_reason IN ('dnis_mismatch', 'ani_dnis_mismatch')),
+               SUM(policy_action = 'log'),
+               SUM(policy_action = 'reject'),
+               SUM(policy_action = 'quarantine')
+        FROM call_verifications
+        WHERE created_at >= NOW() - INTERVAL ? DAY
+          AND verification_step != 'S1_TO_S2'`
+    
+    queryArgs := []interface{}{days}
+    if providerName != "" {
+        query += " AND provider_name = ?"
+        queryArgs = append(queryArgs, providerName)
+    }
+    query += `
+        GROUP BY provider_name, verification_step
+        ORDER BY SUM(NOT verified) DESC, provider_name, verification_step`
+    
+    rows, err := db.DB.Query(query, queryArgs...)
+    if err != nil {
+        color.Red("Error: Failed to query verifications: %v", err)
+        os.Exit(1)
+    }
+    defer rows.Close()
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Provider", "Step", "Checked", "Failed", "Rate", "IP", "ANI", "DNIS", "Logged", "Rejected", "Quarantined"})
+    table.SetBorder(true)
+    table.SetRowLine(false)
+    table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+    table.SetAlignment(tablewriter.ALIGN_LEFT)
+    
+    var totalChecked, totalFailed int64
+    for rows.Next() {
+        var name, step string
+        var checked, failed, ip, ani, dnis, logged, rejected, quarantined int64
+        if err := rows.Scan(&name, &step, &checked, &failed, &ip, &ani, &dnis, &logged, &rejected, &quarantined); err != nil {
+            color.Red("Error: Failed to read verifications: %v", err)
+            os.Exit(1)
+        }
+        totalChecked += checked
+        totalFailed += failed
+        
+        rate := fmt.Sprintf("%.2f%%", float64(failed)*100/float64(checked))
+        if failed > 0 {
+            rate = color.RedString(rate)
+        }
+        
+        table.Append([]string{
+            name,
+            step,
+            strconv.FormatInt(checked, 10),
+            strconv.FormatInt(failed, 10),
+            rate,
+            strconv.FormatInt(ip, 10),
+            strconv.FormatInt(ani, 10),
+            strconv.FormatInt(dnis, 10),
+            strconv.FormatInt(logged, 10),
+            strconv.FormatInt(rejected, 10),
+            strconv.FormatInt(quarantined, 10),
+        })
+    }
+    
+    table.Render()
+    fmt.Printf("\nLast %d days: %d of %d return legs failed verification\n", days, totalFailed, totalChecked)
+}
+
+func requestReload(cmd *cobra.Command, args []string) {
+    if err := providerMgr.RequestReload(); err != nil {
+        color.Red("Error: Failed to request reload: %v", err)
+        os.Exit(1)
+    }
+    
+    color.Green("✓ Reload requested, running AGI servers will pick it up on their next poll")
+}
+
 func monitorSystem(cmd *cobra.Command, args []string) {
     fmt.Println("Starting system monitor... Press Ctrl+C to exit")
     fmt.Println()
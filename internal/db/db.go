@@ -3,14 +3,22 @@ package db
 import (
     "database/sql"
     "fmt"
-    "log"
     "strings"
     
     _ "github.com/go-sql-driver/mysql"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
 )
 
+var log = logger.Component("db")
+
 var DB *sql.DB
 
+// loadBalanceModeEnum is the column type of provider_routes.load_balance_mode.
+// It must list every mode in loadbalancer.Modes.
+const loadBalanceModeEnum = `ENUM('round_robin', 'weighted', 'priority', 'failover',
+    'least_connections', 'least_utilization', 'quality', 'lcr')`
+
 func Initialize(dsn string) error {
     // Parse DSN to extract database name
     parts := strings.Split(dsn, "/")
@@ -50,7 +58,7 @@ func Initialize(dsn string) error {
         return fmt.Errorf("failed to create tables: %v", err)
     }
     
-    log.Println("Database initialized successfully")
+    log.Infof("Database initialized successfully")
     return nil
 }
 
@@ -61,12 +69,14 @@ func createTables() error {
             name VARCHAR(100) UNIQUE NOT NULL,
             type ENUM('inbound', 'intermediate', 'final') NOT NULL,
             host VARCHAR(255) NOT NULL,
+            allowed_ips JSON,
             port INT DEFAULT 5060,
             username VARCHAR(100),
             password VARCHAR(100),
             auth_type ENUM('ip', 'credentials', 'both') DEFAULT 'credentials',
             codecs JSON,
             max_channels INT DEFAULT 0,
+            max_cps INT DEFAULT 0,
             priority INT DEFAULT 0,
             weight INT DEFAULT 1,
             active BOOLEAN DEFAULT TRUE,
@@ -83,6 +93,7 @@ func createTables() error {
             provider_name VARCHAR(100),
             in_use BOOLEAN DEFAULT FALSE,
             destination VARCHAR(20),
+            leased_by VARCHAR(100),
             country VARCHAR(50),
             city VARCHAR(50),
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -98,9 +109,18 @@ func createTables() error {
             inbound_provider VARCHAR(100) NOT NULL,
             intermediate_provider VARCHAR(100) NOT NULL,
             final_provider VARCHAR(100) NOT NULL,
-            load_balance_mode ENUM('round_robin', 'weighted', 'priority', 'failover') DEFAULT 'round_robin',
+            load_balance_mode ` + loadBalanceModeEnum + ` DEFAULT 'round_robin',
             priority INT DEFAULT 0,
             active BOOLEAN DEFAULT TRUE,
+            asr_weight DECIMAL(5,2) DEFAULT 0,
+            acd_weight DECIMAL(5,2) DEFAULT 0,
+            pdd_weight DECIMAL(5,2) DEFAULT 0,
+            dnis_prefix VARCHAR(20) NOT NULL DEFAULT '',
+            dnis_pattern VARCHAR(255) NOT NULL DEFAULT '',
+            ani_prefix VARCHAR(20) NOT NULL DEFAULT '',
+            country CHAR(2) NOT NULL DEFAULT '',
+            schedule JSON NULL,
+            verify_policy ENUM('log', 'reject', 'quarantine') NOT NULL DEFAULT 'log',
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             INDEX idx_inbound (inbound_provider),
             INDEX idx_active (active)
@@ -116,18 +136,48 @@ func createTables() error {
             inbound_provider VARCHAR(100),
             intermediate_provider VARCHAR(100),
             final_provider VARCHAR(100),
+            route_name VARCHAR(100),
             status VARCHAR(20) DEFAULT 'ACTIVE',
             current_step VARCHAR(20),
             start_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             end_time TIMESTAMP NULL,
             duration INT DEFAULT 0,
+            billsec INT DEFAULT 0,
             recording_path VARCHAR(255),
+            hangup_cause VARCHAR(32),
+            intermediate_rate_id INT NULL,
+            intermediate_rate DECIMAL(10,6) NULL,
+            final_rate_id INT NULL,
+            final_rate DECIMAL(10,6) NULL,
+            inbound_rate_id INT NULL,
+            inbound_rate DECIMAL(10,6) NULL,
+            cost DECIMAL(12,6) NOT NULL DEFAULT 0,
+            revenue DECIMAL(12,6) NOT NULL DEFAULT 0,
+            margin DECIMAL(12,6) NOT NULL DEFAULT 0,
+            currency CHAR(3) NULL,
+            quarantined BOOLEAN NOT NULL DEFAULT FALSE,
             INDEX idx_call_id (call_id),
             INDEX idx_did (assigned_did),
             INDEX idx_status (status),
             INDEX idx_start_time (start_time)
         )`,
         
+        `CREATE TABLE IF NOT EXISTS call_legs (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            call_id VARCHAR(100) NOT NULL,
+            leg_number INT NOT NULL,
+            step VARCHAR(20) NOT NULL,
+            provider VARCHAR(100) NOT NULL,
+            did VARCHAR(20),
+            dial_status VARCHAR(20),
+            hangup_cause VARCHAR(32),
+            outcome VARCHAR(20),
+            start_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            end_time TIMESTAMP NULL,
+            UNIQUE KEY unique_leg (call_id, leg_number),
+            INDEX idx_did (did)
+        )`,
+        
         `CREATE TABLE IF NOT EXISTS provider_stats (
             id BIGINT AUTO_INCREMENT PRIMARY KEY,
             provider_name VARCHAR(100) NOT NULL,
@@ -138,6 +188,18 @@ func createTables() error {
             avg_call_duration DECIMAL(10,2) DEFAULT 0,
             last_call_time TIMESTAMP NULL,
             is_healthy BOOLEAN DEFAULT TRUE,
+            answered_calls BIGINT DEFAULT 0,
+            busy_calls BIGINT DEFAULT 0,
+            congestion_calls BIGINT DEFAULT 0,
+            chanunavail_calls BIGINT DEFAULT 0,
+            noanswer_calls BIGINT DEFAULT 0,
+            asr DECIMAL(5,2) DEFAULT 0,
+            circuit_state VARCHAR(10) DEFAULT 'closed',
+            reachable BOOLEAN DEFAULT TRUE,
+            probe_latency_ms INT DEFAULT 0,
+            quality_score DECIMAL(5,4) DEFAULT 0,
+            post_dial_delay_ms INT DEFAULT 0,
+            rejected_calls BIGINT DEFAULT 0,
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             UNIQUE KEY unique_provider (provider_name),
             INDEX idx_provider (provider_name)
@@ -152,10 +214,118 @@ func createTables() error {
             received_ani VARCHAR(20),
             received_dnis VARCHAR(20),
             source_ip VARCHAR(45),
+            provider_name VARCHAR(100),
             verified BOOLEAN DEFAULT FALSE,
+            failure_reason VARCHAR(32) NOT NULL DEFAULT '',
+            policy_action VARCHAR(20) NOT NULL DEFAULT '',
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            INDEX idx_call_id (call_id)
+            INDEX idx_call_id (call_id),
+            INDEX idx_provider_created (provider_name, created_at)
         )`,
+        
+        // Named pools of providers that routes send calls to
+        `CREATE TABLE IF NOT EXISTS provider_groups (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            name VARCHAR(100) UNIQUE NOT NULL,
+            description VARCHAR(255) NOT NULL DEFAULT '',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+        
+        `CREATE TABLE IF NOT EXISTS provider_group_members (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            group_name VARCHAR(100) NOT NULL,
+            provider_name VARCHAR(100) NOT NULL,
+            weight INT NULL,
+            priority INT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY unique_member (group_name, provider_name),
+            INDEX idx_provider (provider_name)
+        )`,
+        
+        // Per-provider rate decks for least-cost routing
+        `CREATE TABLE IF NOT EXISTS rate_decks (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            prefix VARCHAR(20) NOT NULL,
+            rate_per_minute DECIMAL(10,6) NOT NULL,
+            billing_increment INT NOT NULL DEFAULT 60,
+            effective_date DATE NOT NULL,
+            currency CHAR(3) NOT NULL DEFAULT 'USD',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY unique_rate (provider_name, prefix, effective_date),
+            INDEX idx_provider (provider_name)
+        )`,
+        
+        // ANI/DNIS blocklists and allowlists. Empty scope columns apply to
+        // every inbound provider or route.
+        `CREATE TABLE IF NOT EXISTS number_lists (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            list_type ENUM('block', 'allow') NOT NULL,
+            field ENUM('ani', 'dnis') NOT NULL,
+            number VARCHAR(32) NOT NULL,
+            is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+            inbound_provider VARCHAR(100) NOT NULL DEFAULT '',
+            route_name VARCHAR(100) NOT NULL DEFAULT '',
+            note VARCHAR(255) NOT NULL DEFAULT '',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY unique_entry (list_type, field, number, is_prefix, inbound_provider, route_name)
+        )`,
+        
+        // Per-provider ANI/DNIS translation rules
+        `CREATE TABLE IF NOT EXISTS number_rules (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            direction ENUM('inbound', 'outbound') NOT NULL,
+            field ENUM('ani', 'dnis', 'both') NOT NULL DEFAULT 'both',
+            action ENUM('strip', 'add', 'regex', 'e164') NOT NULL,
+            pattern VARCHAR(255) NOT NULL DEFAULT '',
+            value VARCHAR(100) NOT NULL DEFAULT '',
+            position INT NOT NULL DEFAULT 0,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_provider_direction (provider_name, direction, position)
+        )`,
+        
+        // Shared in-flight call state for cluster mode
+        `CREATE TABLE IF NOT EXISTS active_calls (
+            call_id VARCHAR(100) PRIMARY KEY,
+            assigned_did VARCHAR(20),
+            original_ani VARCHAR(20),
+            original_dnis VARCHAR(20),
+            inbound_provider VARCHAR(100),
+            node_id VARCHAR(100),
+            state JSON NOT NULL,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            INDEX idx_did (assigned_did),
+            INDEX idx_numbers (original_ani, original_dnis),
+            INDEX idx_inbound (inbound_provider),
+            INDEX idx_node (node_id)
+        )`,
+        
+        // Inbound calls refused by a fraud rule, which never get a call record
+        `CREATE TABLE IF NOT EXISTS blocked_calls (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            call_id VARCHAR(100),
+            ani VARCHAR(20),
+            dnis VARCHAR(20),
+            inbound_provider VARCHAR(100),
+            rule_name VARCHAR(100) NOT NULL,
+            reason VARCHAR(255),
+            node_id VARCHAR(100),
+            blocked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_blocked_at (blocked_at),
+            INDEX idx_ani (ani),
+            INDEX idx_provider (inbound_provider)
+        )`,
+        
+        // Bumped on every provider/route/DID change so running AGI servers
+        // know when to reload their in-memory configuration
+        `CREATE TABLE IF NOT EXISTS config_version (
+            id TINYINT PRIMARY KEY,
+            version BIGINT NOT NULL DEFAULT 0,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+        )`,
+        
+        `INSERT IGNORE INTO config_version (id, version) VALUES (1, 0)`,
     }
     
     for _, query := range queries {
@@ -164,9 +334,106 @@ func createTables() error {
         }
     }
     
+    return migrateTables()
+}
+
+// migrateTables adds columns introduced after a table was first created.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so every new
+// column is listed both in createTables and here.
+func migrateTables() error {
+    columns := []struct {
+        table      string
+        column     string
+        definition string
+    }{
+        {"providers", "max_cps", "INT DEFAULT 0 AFTER max_channels"},
+        {"providers", "allowed_ips", "JSON NULL AFTER host"},
+        {"dids", "leased_by", "VARCHAR(100) AFTER destination"},
+        {"call_records", "billsec", "INT DEFAULT 0 AFTER duration"},
+        {"call_records", "hangup_cause", "VARCHAR(32) AFTER recording_path"},
+        {"call_records", "intermediate_rate_id", "INT NULL AFTER hangup_cause"},
+        {"call_records", "intermediate_rate", "DECIMAL(10,6) NULL AFTER intermediate_rate_id"},
+        {"call_records", "final_rate_id", "INT NULL AFTER intermediate_rate"},
+        {"call_records", "final_rate", "DECIMAL(10,6) NULL AFTER final_rate_id"},
+        {"call_records", "route_name", "VARCHAR(100) AFTER final_provider"},
+        {"call_records", "inbound_rate_id", "INT NULL AFTER final_rate"},
+        {"call_records", "inbound_rate", "DECIMAL(10,6) NULL AFTER inbound_rate_id"},
+        {"call_records", "cost", "DECIMAL(12,6) NOT NULL DEFAULT 0 AFTER inbound_rate"},
+        {"call_records", "revenue", "DECIMAL(12,6) NOT NULL DEFAULT 0 AFTER cost"},
+        {"call_records", "margin", "DECIMAL(12,6) NOT NULL DEFAULT 0 AFTER revenue"},
+        {"call_records", "quarantined", "BOOLEAN NOT NULL DEFAULT FALSE AFTER margin"},
+        {"call_records", "currency", "CHAR(3) NULL AFTER margin"},
+        // The index is added with the column, which only runs when both are missing
+        {"active_calls", "inbound_provider", "VARCHAR(100) AFTER original_dnis, ADD INDEX idx_inbound (inbound_provider)"},
+        {"provider_stats", "answered_calls", "BIGINT DEFAULT 0 AFTER is_healthy"},
+        {"provider_stats", "busy_calls", "BIGINT DEFAULT 0 AFTER answered_calls"},
+        {"provider_stats", "congestion_calls", "BIGINT DEFAULT 0 AFTER busy_calls"},
+        {"provider_stats", "chanunavail_calls", "BIGINT DEFAULT 0 AFTER congestion_calls"},
+        {"provider_stats", "noanswer_calls", "BIGINT DEFAULT 0 AFTER chanunavail_calls"},
+        {"provider_stats", "asr", "DECIMAL(5,2) DEFAULT 0 AFTER noanswer_calls"},
+        {"provider_stats", "circuit_state", "VARCHAR(10) DEFAULT 'closed' AFTER asr"},
+        {"provider_stats", "reachable", "BOOLEAN DEFAULT TRUE AFTER circuit_state"},
+        {"provider_stats", "probe_latency_ms", "INT DEFAULT 0 AFTER reachable"},
+        {"provider_stats", "quality_score", "DECIMAL(5,4) DEFAULT 0 AFTER probe_latency_ms"},
+        {"provider_stats", "post_dial_delay_ms", "INT DEFAULT 0 AFTER quality_score"},
+        {"provider_stats", "rejected_calls", "BIGINT DEFAULT 0 AFTER post_dial_delay_ms"},
+        {"provider_routes", "asr_weight", "DECIMAL(5,2) DEFAULT 0 AFTER active"},
+        {"provider_routes", "acd_weight", "DECIMAL(5,2) DEFAULT 0 AFTER asr_weight"},
+        {"provider_routes", "pdd_weight", "DECIMAL(5,2) DEFAULT 0 AFTER acd_weight"},
+        {"provider_routes", "dnis_prefix", "VARCHAR(20) NOT NULL DEFAULT '' AFTER pdd_weight"},
+        {"provider_routes", "dnis_pattern", "VARCHAR(255) NOT NULL DEFAULT '' AFTER dnis_prefix"},
+        {"provider_routes", "ani_prefix", "VARCHAR(20) NOT NULL DEFAULT '' AFTER dnis_pattern"},
+        {"provider_routes", "country", "CHAR(2) NOT NULL DEFAULT '' AFTER ani_prefix"},
+        {"provider_routes", "schedule", "JSON NULL AFTER country"},
+        {"provider_routes", "verify_policy", "ENUM('log', 'reject', 'quarantine') NOT NULL DEFAULT 'log' AFTER schedule"},
+        {"call_verifications", "provider_name", "VARCHAR(100) AFTER source_ip"},
+        {"call_verifications", "failure_reason", "VARCHAR(32) NOT NULL DEFAULT '' AFTER verified"},
+        {"call_verifications", "policy_action", "VARCHAR(20) NOT NULL DEFAULT '' AFTER failure_reason"},
+    }
+    
+    for _, c := range columns {
+        if err := addColumnIfNotExists(c.table, c.column, c.definition); err != nil {
+            return fmt.Errorf("failed to add column %s.%s: %v", c.table, c.column, err)
+        }
+    }
+    
+    // Columns whose type grew, e.g. an ENUM with new values. MODIFY is a
+    // no-op when the type already matches.
+    modified := []struct {
+        table      string
+        column     string
+        definition string
+    }{
+        {"provider_routes", "load_balance_mode", loadBalanceModeEnum + " DEFAULT 'round_robin'"},
+    }
+    
+    for _, c := range modified {
+        if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+            return fmt.Errorf("failed to modify column %s.%s: %v", c.table, c.column, err)
+        }
+    }
+    
     return nil
 }
 
+func addColumnIfNotExists(table, column, definition string) error {
+    var count int
+    err := DB.QueryRow(`
+        SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+        table, column).Scan(&count)
+    if err != nil {
+        return err
+    }
+    
+    if count > 0 {
+        return nil
+    }
+    
+    _, err = DB.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, column, definition))
+    return err
+}
+
 func Close() {
     if DB != nil {
         DB.Close()
@@ -0,0 +1,211 @@
+package fraud
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
+)
+
+var log = logger.Component("fraud")
+
+// sweepInterval is how often keys without recent calls are forgotten
+const sweepInterval = time.Minute
+
+// Config lists the fraud rules to apply to inbound calls
+type Config struct {
+    Rules []Rule `mapstructure:"rules"`
+}
+
+// Call is an inbound call as the detector sees it
+type Call struct {
+    ANI      string
+    DNIS     string
+    Provider string
+}
+
+// Hit is a rule tripped by a call
+type Hit struct {
+    Rule   string
+    Type   string
+    Action string
+    Reason string
+}
+
+// Detector keeps sliding windows of inbound calls and checks each new call
+// against the configured rules. State is local to the process.
+type Detector struct {
+    mu        sync.Mutex
+    rules     []*ruleState
+    lastSweep time.Time
+}
+
+type ruleState struct {
+    Rule
+    windows map[string]window // rate and short_calls
+    runs    map[string]*run   // sequential
+    hits    int64
+}
+
+// New checks the rules and builds a detector
+func New(cfg Config) (*Detector, error) {
+    d := &Detector{lastSweep: time.Now()}
+    names := make(map[string]bool)
+    for _, rule := range cfg.Rules {
+        if err := rule.check(); err != nil {
+            return nil, err
+        }
+        if names[rule.Name] {
+            return nil, fmt.Errorf("duplicate fraud rule %s", rule.Name)
+        }
+        names[rule.Name] = true
+        
+        d.rules = append(d.rules, &ruleState{
+            Rule:    rule,
+            windows: make(map[string]window),
+            runs:    make(map[string]*run),
+        })
+    }
+    
+    log.Infof("Loaded %d fraud rules", len(d.rules))
+    return d, nil
+}
+
+// Check records a new inbound call and returns the rules it trips. Calls
+// are recorded whether or not they are then blocked, so a flood stays
+// blocked for as long as it goes on.
+func (d *Detector) Check(call Call) []Hit {
+    call.DNIS = strings.TrimPrefix(call.DNIS, "+")
+    now := time.Now()
+    
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    
+    var hits []Hit
+    for _, rs := range d.rules {
+        reason := rs.check(call, now)
+        if reason == "" {
+            continue
+        }
+        rs.hits++
+        hits = append(hits, Hit{Rule: rs.Name, Type: rs.Type, Action: rs.Action, Reason: reason})
+    }
+    
+    if now.Sub(d.lastSweep) >= sweepInterval {
+        d.sweep(now)
+    }
+    return hits
+}
+
+// CallEnded records how long an answered call lasted, for the short_calls
+// rules
+func (d *Detector) CallEnded(call Call, duration time.Duration) {
+    call.DNIS = strings.TrimPrefix(call.DNIS, "+")
+    now := time.Now()
+    
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    
+    for _, rs := range d.rules {
+        if rs.Type != RuleShortCalls || duration >= rs.MaxDuration {
+            continue
+        }
+        key := rs.keyOf(call)
+        rs.windows[key] = append(rs.windows[key].prune(now, rs.Window), now)
+    }
+}
+
+// check applies one rule to a new call and returns why it tripped, "" if
+// it did not
+func (rs *ruleState) check(call Call, now time.Time) string {
+    switch rs.Type {
+    case RulePremium:
+        for _, prefix := range rs.Prefixes {
+            if strings.HasPrefix(call.DNIS, prefix) {
+                return fmt.Sprintf("premium-rate prefix %s", prefix)
+            }
+        }
+    
+    case RuleRate:
+        key := rs.keyOf(call)
+        w := append(rs.windows[key].prune(now, rs.Window), now)
+        rs.windows[key] = w
+        if len(w) > rs.Threshold {
+            return fmt.Sprintf("%d calls by %s %s in %s", len(w), rs.Key, key, rs.Window)
+        }
+    
+    case RuleShortCalls:
+        key := rs.keyOf(call)
+        w := rs.windows[key].prune(now, rs.Window)
+        rs.windows[key] = w
+        if len(w) >= rs.Threshold {
+            return fmt.Sprintf("%d calls by %s %s shorter than %s in %s", len(w), rs.Key, key, rs.MaxDuration, rs.Window)
+        }
+    
+    case RuleSequential:
+        number, err := strconv.ParseUint(call.DNIS, 10, 64)
+        if err != nil {
+            return ""
+        }
+        key := rs.keyOf(call)
+        r := rs.runs[key]
+        if r != nil && now.Sub(r.at) <= rs.Window && (number == r.last+1 || number+1 == r.last) {
+            r.length++
+        } else {
+            r = &run{length: 1}
+            rs.runs[key] = r
+        }
+        r.last, r.at = number, now
+        if r.length >= rs.Threshold {
+            return fmt.Sprintf("%d consecutive numbers dialled by %s %s", r.length, rs.Key, key)
+        }
+    }
+    return ""
+}
+
+// sweep forgets keys without calls in their rule's window. Caller must
+// hold d.mu.
+func (d *Detector) sweep(now time.Time) {
+    for _, rs := range d.rules {
+        for key, w := range rs.windows {
+            if w = w.prune(now, rs.Window); len(w) == 0 {
+                delete(rs.windows, key)
+            } else {
+                rs.windows[key] = w
+            }
+        }
+        for key, r := range rs.runs {
+            if now.Sub(r.at) > rs.Window {
+                delete(rs.runs, key)
+            }
+        }
+    }
+    d.lastSweep = now
+}
+
+// Stats returns how often each rule tripped
+func (d *Detector) Stats() map[string]int64 {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    
+    stats := make(map[string]int64, len(d.rules))
+    for _, rs := range d.rules {
+        stats[rs.Name] = rs.hits
+    }
+    return stats
+}
+
+// Collect exports how often each rule tripped
+func (d *Detector) Collect(w *metrics.Writer) {
+    stats := d.Stats()
+    
+    w.Header("router_fraud_hits_total", "Inbound calls that tripped a fraud rule", "counter")
+    for _, rs := range d.rules {
+        w.Sample("router_fraud_hits_total", float64(stats[rs.Name]),
+            metrics.L("rule", rs.Name), metrics.L("action", rs.Action))
+    }
+}
@@ -0,0 +1,229 @@
+package fraud
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func newDetector(t *testing.T, rules ...Rule) *Detector {
+    t.Helper()
+    d, err := New(Config{Rules: rules})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return d
+}
+
+// newRuleState builds the state of one checked rule, for driving it with
+// explicit times
+func newRuleState(t *testing.T, rule Rule) *ruleState {
+    t.Helper()
+    if err := rule.check(); err != nil {
+        t.Fatal(err)
+    }
+    return &ruleState{Rule: rule, windows: make(map[string]window), runs: make(map[string]*run)}
+}
+
+func TestRuleCheck(t *testing.T) {
+    tests := []struct {
+        name string
+        rule Rule
+        err  string // "" for a valid rule
+    }{
+        {"valid rate", Rule{Name: "r", Type: RuleRate, Window: time.Minute, Threshold: 5}, ""},
+        {"valid premium", Rule{Name: "p", Type: RulePremium, Prefixes: []string{"+1900"}}, ""},
+        {"no name", Rule{Type: RuleRate, Window: time.Minute, Threshold: 5}, "without a name"},
+        {"unknown type", Rule{Name: "x", Type: "volume"}, "unknown type"},
+        {"unknown action", Rule{Name: "x", Type: RulePremium, Prefixes: []string{"1900"}, Action: "drop"}, "action"},
+        {"premium without prefixes", Rule{Name: "x", Type: RulePremium}, "need prefixes"},
+        {"unknown key", Rule{Name: "x", Type: RuleRate, Key: "route", Window: time.Minute, Threshold: 5}, "unknown key"},
+        {"dnis_prefix without length", Rule{Name: "x", Type: RuleRate, Key: KeyDNISPrefix, Window: time.Minute, Threshold: 5}, "prefix_length"},
+        {"no window", Rule{Name: "x", Type: RuleRate, Threshold: 5}, "positive"},
+        {"short_calls without max_duration", Rule{Name: "x", Type: RuleShortCalls, Window: time.Minute, Threshold: 5}, "max_duration"},
+    }
+    
+    for _, tt := range tests {
+        err := tt.rule.check()
+        switch {
+        case tt.err == "" && err != nil:
+            t.Errorf("%s: unexpected error %v", tt.name, err)
+        case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+            t.Errorf("%s: got error %v, want one about %q", tt.name, err, tt.err)
+        }
+    }
+}
+
+func TestRuleDefaults(t *testing.T) {
+    rate := Rule{Name: "r", Type: RuleRate, Window: time.Minute, Threshold: 1}
+    sequential := Rule{Name: "s", Type: RuleSequential, Window: time.Minute, Threshold: 1}
+    premium := Rule{Name: "p", Type: RulePremium, Prefixes: []string{"+1900", "44871"}}
+    for _, r := range []*Rule{&rate, &sequential, &premium} {
+        if err := r.check(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    
+    if rate.Key != KeyANI || rate.Action != ActionAlert {
+        t.Errorf("rate rule defaults to key %s, action %s; want ani, alert", rate.Key, rate.Action)
+    }
+    if sequential.Key != KeyProvider {
+        t.Errorf("sequential rule defaults to key %s, want provider", sequential.Key)
+    }
+    if premium.Prefixes[0] != "1900" || premium.Prefixes[1] != "44871" {
+        t.Errorf("premium prefixes %v, want the + stripped", premium.Prefixes)
+    }
+}
+
+func TestNewRejectsDuplicates(t *testing.T) {
+    rule := Rule{Name: "p", Type: RulePremium, Prefixes: []string{"1900"}}
+    if _, err := New(Config{Rules: []Rule{rule, rule}}); err == nil {
+        t.Error("duplicate rule names accepted")
+    }
+}
+
+func TestRateRule(t *testing.T) {
+    rs := newRuleState(t, Rule{Name: "burst", Type: RuleRate, Window: 10 * time.Second, Threshold: 3})
+    call := Call{ANI: "15551230000", DNIS: "442071234567", Provider: "s1"}
+    now := time.Now()
+    
+    for i := 0; i < 3; i++ {
+        if reason := rs.check(call, now); reason != "" {
+            t.Fatalf("call %d tripped the rule: %s", i+1, reason)
+        }
+    }
+    if reason := rs.check(call, now); reason == "" {
+        t.Fatal("4th call in the window did not trip a threshold of 3")
+    }
+    
+    // Other ANIs are counted separately
+    if reason := rs.check(Call{ANI: "15559990000", DNIS: call.DNIS}, now); reason != "" {
+        t.Errorf("another ANI tripped the rule: %s", reason)
+    }
+    
+    // Once the window has passed the count starts again
+    if reason := rs.check(call, now.Add(11*time.Second)); reason != "" {
+        t.Errorf("call after the window tripped the rule: %s", reason)
+    }
+}
+
+func TestRateRuleDNISPrefix(t *testing.T) {
+    rs := newRuleState(t, Rule{Name: "dest", Type: RuleRate, Key: KeyDNISPrefix, PrefixLength: 4,
+        Window: time.Minute, Threshold: 2})
+    now := time.Now()
+    
+    rs.check(Call{ANI: "1", DNIS: "44201111"}, now)
+    rs.check(Call{ANI: "2", DNIS: "44202222"}, now)
+    if reason := rs.check(Call{ANI: "3", DNIS: "44203333"}, now); !strings.Contains(reason, "4420") {
+        t.Errorf("3rd call to prefix 4420 got %q, want a hit on 4420", reason)
+    }
+    if reason := rs.check(Call{ANI: "4", DNIS: "44211111"}, now); reason != "" {
+        t.Errorf("call to prefix 4421 tripped the rule: %s", reason)
+    }
+}
+
+func TestSequentialRule(t *testing.T) {
+    rs := newRuleState(t, Rule{Name: "scan", Type: RuleSequential, Window: 5 * time.Second, Threshold: 3})
+    now := time.Now()
+    call := func(dnis string, at time.Time) string {
+        return rs.check(Call{ANI: "1", DNIS: dnis, Provider: "s1"}, at)
+    }
+    
+    if call("442070000001", now) != "" || call("442070000002", now) != "" {
+        t.Fatal("run of 2 tripped a threshold of 3")
+    }
+    if call("442070000003", now) == "" {
+        t.Fatal("run of 3 consecutive numbers did not trip")
+    }
+    
+    // Counting down is a scan too
+    rs = newRuleState(t, rs.Rule)
+    call("442070000009", now)
+    call("442070000008", now)
+    if call("442070000007", now) == "" {
+        t.Error("descending run did not trip")
+    }
+    
+    // A gap, a non-consecutive number or a pause longer than the window
+    // starts a new run
+    rs = newRuleState(t, rs.Rule)
+    call("442070000001", now)
+    call("442070000002", now)
+    if reason := call("442070000004", now); reason != "" {
+        t.Errorf("gap in the run tripped: %s", reason)
+    }
+    call("442070000005", now)
+    if reason := call("442070000006", now.Add(6*time.Second)); reason != "" {
+        t.Errorf("run after a pause tripped: %s", reason)
+    }
+    
+    if reason := call("not-a-number", now); reason != "" {
+        t.Errorf("non-numeric DNIS tripped: %s", reason)
+    }
+}
+
+func TestPremiumRule(t *testing.T) {
+    d := newDetector(t, Rule{Name: "premium", Type: RulePremium, Prefixes: []string{"1900", "+44871"}, Action: ActionBlock})
+    
+    tests := []struct {
+        dnis string
+        hit  bool
+    }{
+        {"19005551234", true},
+        {"+447871000000", false},
+        {"448710000000", true},
+        {"+448710000000", true},
+        {"12125551234", false},
+    }
+    for _, tt := range tests {
+        hits := d.Check(Call{ANI: "1", DNIS: tt.dnis, Provider: "s1"})
+        if (len(hits) > 0) != tt.hit {
+            t.Errorf("%s: hits %v, want hit %v", tt.dnis, hits, tt.hit)
+        }
+        if len(hits) > 0 && hits[0].Action != ActionBlock {
+            t.Errorf("%s: action %s, want block", tt.dnis, hits[0].Action)
+        }
+    }
+    
+    if got := d.Stats()["premium"]; got != 3 {
+        t.Errorf("rule tripped %d times, want 3", got)
+    }
+}
+
+func TestShortCallsRule(t *testing.T) {
+    d := newDetector(t, Rule{Name: "short", Type: RuleShortCalls, Window: time.Minute, Threshold: 2,
+        MaxDuration: 6 * time.Second})
+    call := Call{ANI: "15551230000", DNIS: "442071234567", Provider: "s1"}
+    
+    d.CallEnded(call, 3*time.Second)
+    d.CallEnded(call, 30*time.Second) // long enough, not counted
+    if hits := d.Check(call); len(hits) != 0 {
+        t.Fatalf("1 short call tripped a threshold of 2: %v", hits)
+    }
+    
+    d.CallEnded(call, 5*time.Second)
+    if hits := d.Check(call); len(hits) != 1 || hits[0].Type != RuleShortCalls {
+        t.Fatalf("2 short calls got %v, want a short_calls hit", hits)
+    }
+    
+    other := Call{ANI: "15559990000", DNIS: call.DNIS, Provider: "s1"}
+    if hits := d.Check(other); len(hits) != 0 {
+        t.Errorf("another ANI tripped the rule: %v", hits)
+    }
+}
+
+func TestSweep(t *testing.T) {
+    d := newDetector(t,
+        Rule{Name: "burst", Type: RuleRate, Window: time.Second, Threshold: 5},
+        Rule{Name: "scan", Type: RuleSequential, Window: time.Second, Threshold: 5})
+    d.Check(Call{ANI: "1", DNIS: "100", Provider: "s1"})
+    
+    d.mu.Lock()
+    d.sweep(time.Now().Add(2 * time.Second))
+    windows, runs := len(d.rules[0].windows), len(d.rules[1].runs)
+    d.mu.Unlock()
+    
+    if windows != 0 || runs != 0 {
+        t.Errorf("%d windows and %d runs left after the sweep, want none", windows, runs)
+    }
+}
@@ -0,0 +1,134 @@
+package fraud
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Rule types
+const (
+    // RuleRate trips when more than Threshold calls share a key in Window
+    RuleRate = "rate"
+    // RuleSequential trips when Threshold calls of a key in a row dial
+    // consecutive numbers, each within Window of the one before
+    RuleSequential = "sequential"
+    // RulePremium trips on calls to one of Prefixes
+    RulePremium = "premium"
+    // RuleShortCalls trips when Threshold answered calls of a key lasted
+    // less than MaxDuration in Window
+    RuleShortCalls = "short_calls"
+)
+
+// Keys a rule groups calls by
+const (
+    KeyANI        = "ani"
+    KeyDNISPrefix = "dnis_prefix"
+    KeyProvider   = "provider"
+)
+
+// What happens to a call that trips a rule
+const (
+    ActionAlert = "alert"
+    ActionBlock = "block"
+)
+
+// Rule is one configured fraud check
+type Rule struct {
+    Name         string        `mapstructure:"name"`
+    Type         string        `mapstructure:"type"`
+    Key          string        `mapstructure:"key"`           // ani, dnis_prefix or provider
+    PrefixLength int           `mapstructure:"prefix_length"` // digits of the DNIS for the dnis_prefix key
+    Window       time.Duration `mapstructure:"window"`
+    Threshold    int           `mapstructure:"threshold"`
+    MaxDuration  time.Duration `mapstructure:"max_duration"` // short_calls only
+    Prefixes     []string      `mapstructure:"prefixes"`     // premium only
+    Action       string        `mapstructure:"action"`       // alert (default) or block
+}
+
+// check validates a rule and fills in its defaults
+func (r *Rule) check() error {
+    if r.Name == "" {
+        return fmt.Errorf("fraud rule without a name")
+    }
+    if r.Action == "" {
+        r.Action = ActionAlert
+    }
+    if r.Action != ActionAlert && r.Action != ActionBlock {
+        return fmt.Errorf("fraud rule %s: action must be alert or block", r.Name)
+    }
+    
+    switch r.Type {
+    case RulePremium:
+        if len(r.Prefixes) == 0 {
+            return fmt.Errorf("fraud rule %s: premium rules need prefixes", r.Name)
+        }
+        for i, p := range r.Prefixes {
+            r.Prefixes[i] = strings.TrimPrefix(p, "+")
+        }
+        return nil
+    case RuleRate, RuleShortCalls:
+        if r.Key == "" {
+            r.Key = KeyANI
+        }
+    case RuleSequential:
+        if r.Key == "" {
+            r.Key = KeyProvider
+        }
+    default:
+        return fmt.Errorf("fraud rule %s: unknown type %q", r.Name, r.Type)
+    }
+    
+    switch r.Key {
+    case KeyANI, KeyProvider:
+    case KeyDNISPrefix:
+        if r.PrefixLength <= 0 {
+            return fmt.Errorf("fraud rule %s: the dnis_prefix key needs prefix_length", r.Name)
+        }
+    default:
+        return fmt.Errorf("fraud rule %s: unknown key %q", r.Name, r.Key)
+    }
+    
+    if r.Window <= 0 || r.Threshold <= 0 {
+        return fmt.Errorf("fraud rule %s: window and threshold must be positive", r.Name)
+    }
+    if r.Type == RuleShortCalls && r.MaxDuration <= 0 {
+        return fmt.Errorf("fraud rule %s: short_calls rules need max_duration", r.Name)
+    }
+    return nil
+}
+
+// keyOf returns the value a call is grouped by for the rule
+func (r *Rule) keyOf(call Call) string {
+    switch r.Key {
+    case KeyANI:
+        return call.ANI
+    case KeyDNISPrefix:
+        if len(call.DNIS) > r.PrefixLength {
+            return call.DNIS[:r.PrefixLength]
+        }
+        return call.DNIS
+    default:
+        return call.Provider
+    }
+}
+
+// window is a sliding count of events
+type window []time.Time
+
+// prune drops the events older than d
+func (w window) prune(now time.Time, d time.Duration) window {
+    cutoff := now.Add(-d)
+    i := 0
+    for i < len(w) && !w[i].After(cutoff) {
+        i++
+    }
+    return w[i:]
+}
+
+// run is a streak of calls to consecutive numbers
+type run struct {
+    last   uint64
+    length int
+    at     time.Time
+}
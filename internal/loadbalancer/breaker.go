@@ -0,0 +1,197 @@
+package loadbalancer
+
+import (
+    "time"
+)
+
+// CircuitState is the state of a provider's circuit breaker
+type CircuitState string
+
+const (
+    // CircuitClosed lets every call through
+    CircuitClosed CircuitState = "closed"
+    // CircuitOpen takes the provider out of rotation until RecoveryTime passes
+    CircuitOpen CircuitState = "open"
+    // CircuitHalfOpen lets probe calls through to test whether it recovered
+    CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitStates lists every state, in the order they are reported
+var CircuitStates = []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen}
+
+// BreakerConfig controls when a provider's circuit opens and closes again
+type BreakerConfig struct {
+    // MaxFailures consecutive failures open the circuit
+    MaxFailures int
+    
+    // Window is the sliding window the failure ratio is computed over
+    Window time.Duration
+    
+    // FailureRatio (0-1) of failed calls in Window opens the circuit,
+    // once at least MinCalls calls fell into the window
+    FailureRatio float64
+    MinCalls     int
+    
+    // RecoveryTime an open circuit waits before letting a probe call through
+    RecoveryTime time.Duration
+    
+    // HalfOpenProbes successful probe calls close the circuit again
+    HalfOpenProbes int
+    
+    // CheckInterval is how often the health monitor runs
+    CheckInterval time.Duration
+}
+
+// Defaults for BreakerConfig fields left at zero
+const (
+    DefaultMaxFailures    = 5
+    DefaultWindow         = 5 * time.Minute
+    DefaultFailureRatio   = 0.5
+    DefaultMinCalls       = 10
+    DefaultRecoveryTime   = 5 * time.Minute
+    DefaultHalfOpenProbes = 1
+    DefaultCheckInterval  = 30 * time.Second
+)
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+    if c.MaxFailures <= 0 {
+        c.MaxFailures = DefaultMaxFailures
+    }
+    if c.Window <= 0 {
+        c.Window = DefaultWindow
+    }
+    if c.FailureRatio <= 0 || c.FailureRatio > 1 {
+        c.FailureRatio = DefaultFailureRatio
+    }
+    if c.MinCalls <= 0 {
+        c.MinCalls = DefaultMinCalls
+    }
+    if c.RecoveryTime <= 0 {
+        c.RecoveryTime = DefaultRecoveryTime
+    }
+    if c.HalfOpenProbes <= 0 {
+        c.HalfOpenProbes = DefaultHalfOpenProbes
+    }
+    if c.CheckInterval <= 0 {
+        c.CheckInterval = DefaultCheckInterval
+    }
+    return c
+}
+
+type breakerEvent struct {
+    at     time.Time
+    failed bool
+}
+
+// breaker is the circuit breaker of one provider. It is guarded by the
+// load balancer's mutex.
+type breaker struct {
+    state          CircuitState
+    openedAt       time.Time
+    consecutive    int
+    events         []breakerEvent
+    probeStarted   time.Time // zero when no probe is in flight
+    probeSuccesses int
+}
+
+func newBreaker() *breaker {
+    return &breaker{state: CircuitClosed}
+}
+
+// available reports whether a call may be routed to the provider now,
+// without changing the state
+func (b *breaker) available(now time.Time, cfg BreakerConfig) bool {
+    switch b.state {
+    case CircuitOpen:
+        return now.Sub(b.openedAt) >= cfg.RecoveryTime
+    case CircuitHalfOpen:
+        // One probe at a time; a probe whose result never arrived expires
+        return b.probeStarted.IsZero() || now.Sub(b.probeStarted) >= cfg.RecoveryTime
+    }
+    return true
+}
+
+// acquire is called once a call was routed to the provider. In half-open
+// the call becomes the probe.
+func (b *breaker) acquire(now time.Time, cfg BreakerConfig) {
+    if b.state == CircuitOpen && now.Sub(b.openedAt) >= cfg.RecoveryTime {
+        b.state = CircuitHalfOpen
+        b.probeSuccesses = 0
+    }
+    if b.state == CircuitHalfOpen {
+        b.probeStarted = now
+    }
+}
+
+// record feeds the result of a call into the breaker
+func (b *breaker) record(now time.Time, failed bool, cfg BreakerConfig) {
+    switch b.state {
+    case CircuitHalfOpen:
+        b.probeStarted = time.Time{}
+        if failed {
+            b.open(now)
+            return
+        }
+        b.probeSuccesses++
+        if b.probeSuccesses >= cfg.HalfOpenProbes {
+            b.close()
+        }
+        return
+    case CircuitOpen:
+        // Late results of calls routed before the circuit opened
+        return
+    }
+    
+    b.events = append(b.events, breakerEvent{at: now, failed: failed})
+    b.prune(now, cfg)
+    
+    if !failed {
+        b.consecutive = 0
+        return
+    }
+    
+    b.consecutive++
+    if b.consecutive >= cfg.MaxFailures {
+        b.open(now)
+        return
+    }
+    
+    if len(b.events) >= cfg.MinCalls {
+        failures := 0
+        for _, e := range b.events {
+            if e.failed {
+                failures++
+            }
+        }
+        if float64(failures)/float64(len(b.events)) >= cfg.FailureRatio {
+            b.open(now)
+        }
+    }
+}
+
+// prune drops events that left the sliding window
+func (b *breaker) prune(now time.Time, cfg BreakerConfig) {
+    cutoff := now.Add(-cfg.Window)
+    i := 0
+    for i < len(b.events) && b.events[i].at.Before(cutoff) {
+        i++
+    }
+    b.events = b.events[i:]
+}
+
+func (b *breaker) open(now time.Time) {
+    b.state = CircuitOpen
+    b.openedAt = now
+    b.consecutive = 0
+    b.events = nil
+    b.probeStarted = time.Time{}
+    b.probeSuccesses = 0
+}
+
+func (b *breaker) close() {
+    b.state = CircuitClosed
+    b.consecutive = 0
+    b.events = nil
+    b.probeStarted = time.Time{}
+    b.probeSuccesses = 0
+}
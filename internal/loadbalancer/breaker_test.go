@@ -0,0 +1,95 @@
+package loadbalancer
+
+import (
+    "testing"
+    "time"
+)
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+    cfg := BreakerConfig{MaxFailures: 3, MinCalls: 100, RecoveryTime: time.Minute}.withDefaults()
+    b := newBreaker()
+    now := time.Now()
+    
+    for i := 0; i < 2; i++ {
+        b.record(now, true, cfg)
+    }
+    b.record(now, false, cfg) // a success resets the run
+    for i := 0; i < 2; i++ {
+        b.record(now, true, cfg)
+    }
+    if b.state != CircuitClosed {
+        t.Fatalf("state %s after a broken run of failures, want closed", b.state)
+    }
+    
+    b.record(now, true, cfg)
+    if b.state != CircuitOpen {
+        t.Fatalf("state %s after 3 failures in a row, want open", b.state)
+    }
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+    cfg := BreakerConfig{MaxFailures: 100, MinCalls: 4, FailureRatio: 0.5, Window: time.Minute}.withDefaults()
+    b := newBreaker()
+    now := time.Now()
+    
+    b.record(now, false, cfg)
+    b.record(now, true, cfg)
+    b.record(now, false, cfg)
+    if b.state != CircuitClosed {
+        t.Fatalf("state %s below MinCalls, want closed", b.state)
+    }
+    b.record(now, true, cfg)
+    if b.state != CircuitOpen {
+        t.Fatalf("state %s at 2 of 4 failed, want open", b.state)
+    }
+    
+    // Failures that left the window do not count
+    b = newBreaker()
+    b.record(now.Add(-2*time.Minute), true, cfg)
+    b.record(now.Add(-2*time.Minute), true, cfg)
+    b.record(now, false, cfg)
+    b.record(now, false, cfg)
+    b.record(now, true, cfg)
+    if b.state != CircuitClosed {
+        t.Errorf("state %s with old failures outside the window, want closed", b.state)
+    }
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+    cfg := BreakerConfig{MaxFailures: 1, RecoveryTime: time.Minute, HalfOpenProbes: 2}.withDefaults()
+    b := newBreaker()
+    now := time.Now()
+    
+    b.record(now, true, cfg)
+    if b.available(now.Add(30*time.Second), cfg) {
+        t.Fatal("open circuit available before the recovery time")
+    }
+    
+    later := now.Add(time.Minute)
+    if !b.available(later, cfg) {
+        t.Fatal("open circuit not available after the recovery time")
+    }
+    b.acquire(later, cfg)
+    if b.state != CircuitHalfOpen {
+        t.Fatalf("state %s after the first call, want half_open", b.state)
+    }
+    if b.available(later, cfg) {
+        t.Fatal("second probe let through while one is in flight")
+    }
+    
+    // A failed probe opens the circuit again
+    b.record(later, true, cfg)
+    if b.state != CircuitOpen {
+        t.Fatalf("state %s after a failed probe, want open", b.state)
+    }
+    
+    // HalfOpenProbes successful probes close it
+    later = later.Add(time.Minute)
+    for i := 0; i < 2; i++ {
+        b.acquire(later, cfg)
+        b.record(later, false, cfg)
+    }
+    if b.state != CircuitClosed {
+        t.Errorf("state %s after 2 successful probes, want closed", b.state)
+    }
+}
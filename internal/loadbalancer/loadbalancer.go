@@ -4,6 +4,7 @@ import (
     "fmt"
     "math/rand"
     "sort"
+    "strings"
     "sync"
     "time"
     
@@ -15,16 +16,99 @@ type LoadBalancer struct {
     mu              sync.RWMutex
     providerStats   map[string]*models.LoadBalancerStats
     roundRobinIndex map[string]int
+    durationSamples map[string]int64
+    breakers        map[string]*breaker
+    breakerCfg      BreakerConfig
+    qualitySamples  map[string][]qualitySample
+    qualityCfg      QualityConfig
+    monitorOnce     sync.Once
 }
 
 func New() *LoadBalancer {
     return &LoadBalancer{
         providerStats:   make(map[string]*models.LoadBalancerStats),
         roundRobinIndex: make(map[string]int),
+        durationSamples: make(map[string]int64),
+        breakers:        make(map[string]*breaker),
+        breakerCfg:      BreakerConfig{}.withDefaults(),
+        qualitySamples:  make(map[string][]qualitySample),
+        qualityCfg:      QualityConfig{}.withDefaults(),
     }
 }
 
+// Configure sets the circuit breaker thresholds. Zero fields keep their defaults.
+func (lb *LoadBalancer) Configure(cfg BreakerConfig) {
+    lb.mu.Lock()
+    lb.breakerCfg = cfg.withDefaults()
+    lb.mu.Unlock()
+}
+
+// ConfigureQuality sets the scoring of the quality mode. Zero fields keep
+// their defaults.
+func (lb *LoadBalancer) ConfigureQuality(cfg QualityConfig) {
+    lb.mu.Lock()
+    lb.qualityCfg = cfg.withDefaults()
+    lb.mu.Unlock()
+}
+
+// statsFor returns the stats of a provider, creating them on first use.
+// Caller must hold lb.mu.
+func (lb *LoadBalancer) statsFor(providerName string) *models.LoadBalancerStats {
+    stats, exists := lb.providerStats[providerName]
+    if !exists {
+        stats = &models.LoadBalancerStats{
+            ProviderName: providerName,
+            IsHealthy:    true,
+            CircuitState: string(CircuitClosed),
+        }
+        lb.providerStats[providerName] = stats
+    }
+    return stats
+}
+
+// breakerFor returns the circuit breaker of a provider. Caller must hold lb.mu.
+func (lb *LoadBalancer) breakerFor(providerName string) *breaker {
+    b, exists := lb.breakers[providerName]
+    if !exists {
+        b = newBreaker()
+        lb.breakers[providerName] = b
+    }
+    return b
+}
+
+// recordResult feeds a call result into the provider's circuit breaker and
+// mirrors the breaker state on its stats. Caller must hold lb.mu.
+func (lb *LoadBalancer) recordResult(stats *models.LoadBalancerStats, failed bool) {
+    b := lb.breakerFor(stats.ProviderName)
+    b.record(time.Now(), failed, lb.breakerCfg)
+    syncCircuitState(stats, b)
+}
+
+func syncCircuitState(stats *models.LoadBalancerStats, b *breaker) {
+    stats.CircuitState = string(b.state)
+    stats.IsHealthy = b.state != CircuitOpen
+}
+
+// Selection is what a route asks of the load balancer: the mode, plus the
+// settings some modes take from the route
+type Selection struct {
+    Mode string
+    
+    // Quality weights of the route, zero for the configured defaults
+    Quality QualityWeights
+    
+    // What a call to the called number costs with each candidate (lcr mode),
+    // all in one currency. Candidates without a cost are only used when no
+    // costed one is left.
+    Costs map[string]float64
+}
+
 func (lb *LoadBalancer) SelectProvider(providers []*models.Provider, mode string) (*models.Provider, error) {
+    return lb.Select(providers, Selection{Mode: mode})
+}
+
+// Select picks a provider for a route out of providers
+func (lb *LoadBalancer) Select(providers []*models.Provider, sel Selection) (*models.Provider, error) {
     if len(providers) == 0 {
         return nil, fmt.Errorf("no providers available")
     }
@@ -35,29 +119,56 @@ func (lb *LoadBalancer) SelectProvider(providers []*models.Provider, mode string
         return nil, fmt.Errorf("no healthy providers available")
     }
     
-    switch mode {
+    var selected *models.Provider
+    var err error
+    switch sel.Mode {
     case "round_robin":
-        return lb.roundRobin(activeProviders)
+        selected, err = lb.roundRobin(activeProviders)
     case "weighted":
-        return lb.weightedRandom(activeProviders)
+        selected, err = lb.weightedRandom(activeProviders)
     case "priority":
-        return lb.priority(activeProviders)
+        selected, err = lb.priority(activeProviders)
     case "failover":
-        return lb.failover(activeProviders)
+        selected, err = lb.failover(activeProviders)
+    case "least_connections":
+        selected, err = lb.leastConnections(activeProviders)
+    case "least_utilization":
+        selected, err = lb.leastUtilization(activeProviders)
+    case "quality":
+        selected, err = lb.quality(activeProviders, sel.Quality)
+    case "lcr":
+        selected, err = lb.leastCost(activeProviders, sel.Costs)
     default:
-        return lb.roundRobin(activeProviders)
+        selected, err = lb.roundRobin(activeProviders)
+    }
+    if err != nil {
+        return nil, err
     }
+    
+    // A call to a recovering provider is its half-open probe
+    lb.mu.Lock()
+    b := lb.breakerFor(selected.Name)
+    b.acquire(time.Now(), lb.breakerCfg)
+    syncCircuitState(lb.statsFor(selected.Name), b)
+    lb.mu.Unlock()
+    
+    return selected, nil
 }
 
 func (lb *LoadBalancer) filterHealthyProviders(providers []*models.Provider) []*models.Provider {
     lb.mu.RLock()
     defer lb.mu.RUnlock()
     
+    now := time.Now()
     var healthy []*models.Provider
     for _, p := range providers {
         if p.Active {
-            stats, exists := lb.providerStats[p.Name]
-            if !exists || stats.IsHealthy {
+            stats := lb.providerStats[p.Name]
+            if stats != nil && stats.ProbeDown {
+                continue
+            }
+            b, exists := lb.breakers[p.Name]
+            if !exists || b.available(now, lb.breakerCfg) {
                 // Check max channels limit
                 if p.MaxChannels == 0 || stats == nil || stats.ActiveCalls < int64(p.MaxChannels) {
                     healthy = append(healthy, p)
@@ -68,11 +179,13 @@ func (lb *LoadBalancer) filterHealthyProviders(providers []*models.Provider) []*
     return healthy
 }
 
+// roundRobin takes turns through providers. The turn is kept per set of
+// provider names, so it carries over between calls to the same pool.
 func (lb *LoadBalancer) roundRobin(providers []*models.Provider) (*models.Provider, error) {
     lb.mu.Lock()
     defer lb.mu.Unlock()
     
-    key := fmt.Sprintf("%v", providers)
+    key := poolKey(providers)
     index := lb.roundRobinIndex[key]
     provider := providers[index%len(providers)]
     lb.roundRobinIndex[key] = index + 1
@@ -80,6 +193,16 @@ func (lb *LoadBalancer) roundRobin(providers []*models.Provider) (*models.Provid
     return provider, nil
 }
 
+// poolKey names a set of providers by their sorted names
+func poolKey(providers []*models.Provider) string {
+    names := make([]string, len(providers))
+    for i, p := range providers {
+        names[i] = p.Name
+    }
+    sort.Strings(names)
+    return strings.Join(names, ",")
+}
+
 func (lb *LoadBalancer) weightedRandom(providers []*models.Provider) (*models.Provider, error) {
     totalWeight := 0
     for _, p := range providers {
@@ -125,18 +248,96 @@ func (lb *LoadBalancer) failover(providers []*models.Provider) (*models.Provider
     return providers[0], nil
 }
 
+// leastConnections picks the provider with the fewest active calls.
+// Ties go to the higher priority.
+func (lb *LoadBalancer) leastConnections(providers []*models.Provider) (*models.Provider, error) {
+    lb.mu.RLock()
+    defer lb.mu.RUnlock()
+    
+    var best *models.Provider
+    var bestCalls int64
+    for _, p := range providers {
+        calls := lb.activeCalls(p.Name)
+        if best == nil || calls < bestCalls || (calls == bestCalls && p.Priority > best.Priority) {
+            best, bestCalls = p, calls
+        }
+    }
+    return best, nil
+}
+
+// leastUtilization picks the provider with the lowest active/max channels
+// ratio. A provider without a channel limit counts as unused. Ties go to the
+// fewest active calls, then the higher priority.
+func (lb *LoadBalancer) leastUtilization(providers []*models.Provider) (*models.Provider, error) {
+    lb.mu.RLock()
+    defer lb.mu.RUnlock()
+    
+    var best *models.Provider
+    var bestRatio float64
+    var bestCalls int64
+    for _, p := range providers {
+        calls := lb.activeCalls(p.Name)
+        ratio := 0.0
+        if p.MaxChannels > 0 {
+            ratio = float64(calls) / float64(p.MaxChannels)
+        }
+        
+        better := best == nil || ratio < bestRatio ||
+            (ratio == bestRatio && (calls < bestCalls || (calls == bestCalls && p.Priority > best.Priority)))
+        if better {
+            best, bestRatio, bestCalls = p, ratio, calls
+        }
+    }
+    return best, nil
+}
+
+// leastCost picks the provider with the lowest cost for the destination.
+// Ties go to the higher priority, then the fewest active calls.
+func (lb *LoadBalancer) leastCost(providers []*models.Provider, costs map[string]float64) (*models.Provider, error) {
+    lb.mu.RLock()
+    defer lb.mu.RUnlock()
+    
+    var best *models.Provider
+    var bestCost float64
+    var bestCosted bool
+    var bestCalls int64
+    for _, p := range providers {
+        cost, costed := costs[p.Name]
+        calls := lb.activeCalls(p.Name)
+        
+        var better bool
+        switch {
+        case best == nil:
+            better = true
+        case costed != bestCosted:
+            better = costed
+        case costed && cost != bestCost:
+            better = cost < bestCost
+        case p.Priority != best.Priority:
+            better = p.Priority > best.Priority
+        default:
+            better = calls < bestCalls
+        }
+        if better {
+            best, bestCost, bestCosted, bestCalls = p, cost, costed, calls
+        }
+    }
+    return best, nil
+}
+
+// activeCalls returns the active calls of a provider. Caller must hold lb.mu.
+func (lb *LoadBalancer) activeCalls(providerName string) int64 {
+    if stats, exists := lb.providerStats[providerName]; exists {
+        return stats.ActiveCalls
+    }
+    return 0
+}
+
 func (lb *LoadBalancer) UpdateStats(providerName string, callSucceeded bool, duration time.Duration) {
     lb.mu.Lock()
     defer lb.mu.Unlock()
     
-    stats, exists := lb.providerStats[providerName]
-    if !exists {
-        stats = &models.LoadBalancerStats{
-            ProviderName: providerName,
-            IsHealthy:    true,
-        }
-        lb.providerStats[providerName] = stats
-    }
+    stats := lb.statsFor(providerName)
     
     stats.TotalCalls++
     stats.LastCallTime = time.Now()
@@ -150,28 +351,18 @@ func (lb *LoadBalancer) UpdateStats(providerName string, callSucceeded bool, dur
     }
     
     stats.SuccessRate = float64(stats.TotalCalls-stats.FailedCalls) / float64(stats.TotalCalls) * 100
-    
-    // Mark unhealthy if success rate drops below 50%
-    if stats.TotalCalls > 10 && stats.SuccessRate < 50 {
-        stats.IsHealthy = false
-    }
+    lb.recordResult(stats, !callSucceeded)
     
     // Update database
-    go lb.updateStatsInDB(stats)
+    snapshot := *stats
+    go lb.updateStatsInDB(&snapshot)
 }
 
 func (lb *LoadBalancer) IncrementActiveCalls(providerName string, delta int64) {
     lb.mu.Lock()
     defer lb.mu.Unlock()
     
-    stats, exists := lb.providerStats[providerName]
-    if !exists {
-        stats = &models.LoadBalancerStats{
-            ProviderName: providerName,
-            IsHealthy:    true,
-        }
-        lb.providerStats[providerName] = stats
-    }
+    stats := lb.statsFor(providerName)
     
     stats.ActiveCalls += delta
     if stats.ActiveCalls < 0 {
@@ -179,6 +370,22 @@ func (lb *LoadBalancer) IncrementActiveCalls(providerName string, delta int64) {
     }
 }
 
+// SetActiveCalls replaces the active call counts of every provider, e.g.
+// after counting the calls again. Providers missing from counts have none.
+func (lb *LoadBalancer) SetActiveCalls(counts map[string]int64) {
+    lb.mu.Lock()
+    defer lb.mu.Unlock()
+    
+    for name, stats := range lb.providerStats {
+        if _, counted := counts[name]; !counted {
+            stats.ActiveCalls = 0
+        }
+    }
+    for name, n := range counts {
+        lb.statsFor(name).ActiveCalls = n
+    }
+}
+
 func (lb *LoadBalancer) GetProviderStats(providerName string) models.LoadBalancerStats {
     lb.mu.RLock()
     defer lb.mu.RUnlock()
@@ -190,14 +397,23 @@ func (lb *LoadBalancer) GetProviderStats(providerName string) models.LoadBalance
     return models.LoadBalancerStats{
         ProviderName: providerName,
         IsHealthy:    true,
+        CircuitState: string(CircuitClosed),
     }
 }
 
 func (lb *LoadBalancer) updateStatsInDB(stats *models.LoadBalancerStats) {
+    // Without a database (e.g. in tests) stats only live in memory
+    if db.DB == nil {
+        return
+    }
+    
     query := `
         INSERT INTO provider_stats (provider_name, total_calls, active_calls, failed_calls, 
-                                   success_rate, avg_call_duration, last_call_time, is_healthy)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+                                   success_rate, avg_call_duration, last_call_time, is_healthy,
+                                   answered_calls, busy_calls, congestion_calls, chanunavail_calls,
+                                   noanswer_calls, asr, circuit_state, reachable, probe_latency_ms,
+                                   quality_score, post_dial_delay_ms)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON DUPLICATE KEY UPDATE
             total_calls = VALUES(total_calls),
             active_calls = VALUES(active_calls),
@@ -205,36 +421,65 @@ func (lb *LoadBalancer) updateStatsInDB(stats *models.LoadBalancerStats) {
             success_rate = VALUES(success_rate),
             avg_call_duration = VALUES(avg_call_duration),
             last_call_time = VALUES(last_call_time),
-            is_healthy = VALUES(is_healthy)`
+            is_healthy = VALUES(is_healthy),
+            answered_calls = VALUES(answered_calls),
+            busy_calls = VALUES(busy_calls),
+            congestion_calls = VALUES(congestion_calls),
+            chanunavail_calls = VALUES(chanunavail_calls),
+            noanswer_calls = VALUES(noanswer_calls),
+            asr = VALUES(asr),
+            circuit_state = VALUES(circuit_state),
+            reachable = VALUES(reachable),
+            probe_latency_ms = VALUES(probe_latency_ms),
+            quality_score = VALUES(quality_score),
+            post_dial_delay_ms = VALUES(post_dial_delay_ms)`
     
     db.DB.Exec(query, stats.ProviderName, stats.TotalCalls, stats.ActiveCalls,
         stats.FailedCalls, stats.SuccessRate, stats.AvgCallDuration,
-        stats.LastCallTime, stats.IsHealthy)
+        stats.LastCallTime, stats.IsHealthy,
+        stats.Answered, stats.Busy, stats.Congestion, stats.ChanUnavail,
+        stats.NoAnswer, stats.ASR, stats.CircuitState,
+        !stats.ProbeDown, int(stats.ProbeLatency*1000),
+        stats.QualityScore, int(stats.PostDialDelay*1000))
 }
 
+// StartHealthMonitor starts the periodic circuit breaker check. Calling it
+// again has no effect.
 func (lb *LoadBalancer) StartHealthMonitor() {
-    go func() {
-        ticker := time.NewTicker(30 * time.Second)
-        defer ticker.Stop()
-        
-        for range ticker.C {
-            lb.checkProviderHealth()
-        }
-    }()
+    lb.monitorOnce.Do(func() {
+        go func() {
+            for {
+                lb.mu.RLock()
+                interval := lb.breakerCfg.CheckInterval
+                lb.mu.RUnlock()
+                
+                time.Sleep(interval)
+                lb.checkProviderHealth()
+            }
+        }()
+    })
 }
 
+// checkProviderHealth moves open circuits whose recovery time passed to
+// half-open, so the next call to the provider is let through as a probe,
+// and persists the resulting state
 func (lb *LoadBalancer) checkProviderHealth() {
     lb.mu.Lock()
     defer lb.mu.Unlock()
     
-    for name, stats := range lb.providerStats {
-        // Reset health if no calls in last 5 minutes
-        fmt.Println(name)
-        if time.Since(stats.LastCallTime) > 5*time.Minute && !stats.IsHealthy {
-            stats.IsHealthy = true
-            stats.FailedCalls = 0
-            stats.TotalCalls = 0
-            stats.SuccessRate = 100
+    now := time.Now()
+    for name, b := range lb.breakers {
+        if b.state == CircuitOpen && now.Sub(b.openedAt) >= lb.breakerCfg.RecoveryTime {
+            b.state = CircuitHalfOpen
+            b.probeSuccesses = 0
+        }
+        b.prune(now, lb.breakerCfg)
+        
+        stats := lb.statsFor(name)
+        if stats.CircuitState != string(b.state) {
+            syncCircuitState(stats, b)
+            snapshot := *stats
+            go lb.updateStatsInDB(&snapshot)
         }
     }
 }
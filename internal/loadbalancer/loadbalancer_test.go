@@ -0,0 +1,106 @@
+package loadbalancer
+
+import (
+    "strings"
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func testProviders() []*models.Provider {
+    return []*models.Provider{
+        {Name: "a", Active: true, Priority: 1, MaxChannels: 10},
+        {Name: "b", Active: true, Priority: 2, MaxChannels: 100},
+        {Name: "c", Active: true, Priority: 3},
+    }
+}
+
+func TestRoundRobin(t *testing.T) {
+    lb := New()
+    var picked []string
+    for i := 0; i < 4; i++ {
+        // A new copy of the pool each call, as group overrides once made
+        got, err := lb.Select(testProviders(), Selection{Mode: "round_robin"})
+        if err != nil {
+            t.Fatal(err)
+        }
+        picked = append(picked, got.Name)
+    }
+    if got := strings.Join(picked, ","); got != "a,b,c,a" {
+        t.Errorf("picked %s, want a,b,c,a", got)
+    }
+    if len(lb.roundRobinIndex) != 1 {
+        t.Errorf("%d round robin turns kept for one pool, want 1", len(lb.roundRobinIndex))
+    }
+}
+
+func TestLeastConnections(t *testing.T) {
+    tests := []struct {
+        name   string
+        active map[string]int64
+        want   string
+    }{
+        {"all idle, highest priority wins", nil, "c"},
+        {"fewest calls", map[string]int64{"a": 1, "b": 0, "c": 2}, "b"},
+        {"tie on calls, highest priority wins", map[string]int64{"a": 1, "b": 1, "c": 2}, "b"},
+    }
+    
+    for _, tt := range tests {
+        lb := New()
+        for name, n := range tt.active {
+            lb.IncrementActiveCalls(name, n)
+        }
+        got, err := lb.Select(testProviders(), Selection{Mode: "least_connections"})
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if got.Name != tt.want {
+            t.Errorf("%s: selected %s, want %s", tt.name, got.Name, tt.want)
+        }
+    }
+}
+
+func TestLeastUtilization(t *testing.T) {
+    tests := []struct {
+        name   string
+        cMax   int // channel limit of c
+        active map[string]int64
+        want   string
+    }{
+        {"unlimited provider counts as unused", 0, map[string]int64{"a": 1, "b": 1, "c": 50}, "c"},
+        {"lowest ratio over fewest calls", 2, map[string]int64{"a": 5, "b": 20, "c": 1}, "b"},
+        {"tie on ratio, fewest calls", 20, map[string]int64{"a": 5, "b": 50, "c": 10}, "a"},
+        {"tie on ratio and calls, highest priority", 10, map[string]int64{"a": 5, "b": 50, "c": 5}, "c"},
+    }
+    
+    for _, tt := range tests {
+        lb := New()
+        for name, n := range tt.active {
+            lb.IncrementActiveCalls(name, n)
+        }
+        providers := testProviders()
+        providers[2].MaxChannels = tt.cMax
+        got, err := lb.Select(providers, Selection{Mode: "least_utilization"})
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if got.Name != tt.want {
+            t.Errorf("%s: selected %s, want %s", tt.name, got.Name, tt.want)
+        }
+    }
+}
+
+func TestSelectSkipsFullAndInactive(t *testing.T) {
+    lb := New()
+    providers := testProviders()
+    providers[2].Active = false
+    lb.IncrementActiveCalls("b", 100) // at max channels
+    
+    got, err := lb.Select(providers, Selection{Mode: "priority"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.Name != "a" {
+        t.Errorf("selected %s, want a", got.Name)
+    }
+}
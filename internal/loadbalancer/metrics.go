@@ -0,0 +1,107 @@
+package loadbalancer
+
+import (
+    "sort"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Collect exports per-provider load balancer statistics
+func (lb *LoadBalancer) Collect(w *metrics.Writer) {
+    lb.mu.RLock()
+    stats := make([]models.LoadBalancerStats, 0, len(lb.providerStats))
+    for _, s := range lb.providerStats {
+        stats = append(stats, *s)
+    }
+    lb.mu.RUnlock()
+    
+    sort.Slice(stats, func(i, j int) bool {
+        return stats[i].ProviderName < stats[j].ProviderName
+    })
+    
+    gauge := func(name, help string, value func(s models.LoadBalancerStats) float64) {
+        w.Header(name, help, "gauge")
+        for _, s := range stats {
+            w.Sample(name, value(s), metrics.L("provider", s.ProviderName))
+        }
+    }
+    counter := func(name, help string, value func(s models.LoadBalancerStats) float64) {
+        w.Header(name, help, "counter")
+        for _, s := range stats {
+            w.Sample(name, value(s), metrics.L("provider", s.ProviderName))
+        }
+    }
+    
+    gauge("router_provider_active_calls", "Calls currently routed through the provider",
+        func(s models.LoadBalancerStats) float64 { return float64(s.ActiveCalls) })
+    counter("router_provider_calls_total", "Completed or failed calls through the provider",
+        func(s models.LoadBalancerStats) float64 { return float64(s.TotalCalls) })
+    counter("router_provider_failed_calls_total", "Failed calls through the provider",
+        func(s models.LoadBalancerStats) float64 { return float64(s.FailedCalls) })
+    gauge("router_provider_success_ratio", "Share of successful calls (0-1)",
+        func(s models.LoadBalancerStats) float64 { return s.SuccessRate / 100 })
+    gauge("router_provider_avg_call_duration_seconds", "Average duration of successful calls",
+        func(s models.LoadBalancerStats) float64 { return s.AvgCallDuration })
+    gauge("router_provider_asr", "Answer-seizure ratio of Dials towards the provider (0-1)",
+        func(s models.LoadBalancerStats) float64 { return s.ASR / 100 })
+    gauge("router_provider_quality_score", "Quality score over the rolling window with the default weights (0-1)",
+        func(s models.LoadBalancerStats) float64 { return s.QualityScore })
+    gauge("router_provider_post_dial_delay_seconds", "Average post-dial delay over the rolling window",
+        func(s models.LoadBalancerStats) float64 { return s.PostDialDelay })
+    
+    w.Header("router_provider_dial_outcomes_total", "Dial results towards the provider", "counter")
+    for _, s := range stats {
+        counts := map[DialOutcome]int64{
+            OutcomeAnswered:    s.Answered,
+            OutcomeBusy:        s.Busy,
+            OutcomeCongestion:  s.Congestion,
+            OutcomeChanUnavail: s.ChanUnavail,
+            OutcomeNoAnswer:    s.NoAnswer,
+        }
+        for _, outcome := range DialOutcomes {
+            w.Sample("router_provider_dial_outcomes_total", float64(counts[outcome]),
+                metrics.L("provider", s.ProviderName), metrics.L("outcome", string(outcome)))
+        }
+    }
+    
+    w.Header("router_provider_circuit_state", "1 for the current circuit breaker state of the provider", "gauge")
+    for _, s := range stats {
+        for _, state := range CircuitStates {
+            value := 0.0
+            if s.CircuitState == string(state) {
+                value = 1
+            }
+            w.Sample("router_provider_circuit_state", value,
+                metrics.L("provider", s.ProviderName), metrics.L("state", string(state)))
+        }
+    }
+    
+    w.Header("router_provider_probe_up", "1 if the last SIP OPTIONS probes reached the provider", "gauge")
+    for _, s := range stats {
+        if s.LastProbeTime.IsZero() {
+            continue
+        }
+        value := 1.0
+        if s.ProbeDown {
+            value = 0
+        }
+        w.Sample("router_provider_probe_up", value, metrics.L("provider", s.ProviderName))
+    }
+    
+    w.Header("router_provider_probe_latency_seconds", "Round-trip time of the last answered OPTIONS probe", "gauge")
+    for _, s := range stats {
+        if s.LastProbeTime.IsZero() {
+            continue
+        }
+        w.Sample("router_provider_probe_latency_seconds", s.ProbeLatency, metrics.L("provider", s.ProviderName))
+    }
+    
+    gauge("router_provider_healthy", "1 if the load balancer considers the provider healthy",
+        func(s models.LoadBalancerStats) float64 {
+            if s.IsHealthy {
+                return 1
+            }
+            return 0
+        })
+}
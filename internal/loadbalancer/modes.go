@@ -0,0 +1,14 @@
+package loadbalancer
+
+// Modes lists the load balance modes accepted for a provider route
+var Modes = []string{"round_robin", "weighted", "priority", "failover", "least_connections", "least_utilization", "quality", "lcr"}
+
+// IsValidMode reports whether mode is one of Modes
+func IsValidMode(mode string) bool {
+    for _, m := range Modes {
+        if mode == m {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,117 @@
+package loadbalancer
+
+import "time"
+
+// DialOutcome is the result of one Dial towards a provider
+type DialOutcome string
+
+const (
+    OutcomeAnswered    DialOutcome = "answered"
+    OutcomeBusy        DialOutcome = "busy"
+    OutcomeCongestion  DialOutcome = "congestion"
+    OutcomeChanUnavail DialOutcome = "chanunavail"
+    OutcomeNoAnswer    DialOutcome = "noanswer"
+)
+
+// DialOutcomes lists every outcome, in the order they are reported
+var DialOutcomes = []DialOutcome{
+    OutcomeAnswered, OutcomeBusy, OutcomeCongestion, OutcomeChanUnavail, OutcomeNoAnswer,
+}
+
+// CarrierFailure reports whether the outcome is the provider's fault.
+// Busy and unanswered calls are decided by the called party.
+func (o DialOutcome) CarrierFailure() bool {
+    return o == OutcomeCongestion || o == OutcomeChanUnavail
+}
+
+// ClassifyDial maps Asterisk's DIALSTATUS, falling back to the Q.850
+// HANGUPCAUSE, onto a dial outcome. ok is false when the Dial said nothing
+// about the provider, e.g. the caller cancelled.
+func ClassifyDial(dialStatus, hangupCause string) (outcome DialOutcome, ok bool) {
+    switch dialStatus {
+    case "ANSWER":
+        return OutcomeAnswered, true
+    case "BUSY":
+        return OutcomeBusy, true
+    case "NOANSWER":
+        return OutcomeNoAnswer, true
+    case "CONGESTION":
+        return OutcomeCongestion, true
+    case "CHANUNAVAIL":
+        return OutcomeChanUnavail, true
+    case "CANCEL", "DONTCALL", "TORTURE", "INVALIDARGS":
+        return "", false
+    }
+    
+    switch hangupCause {
+    case "17":
+        return OutcomeBusy, true
+    case "18", "19":
+        return OutcomeNoAnswer, true
+    case "34", "38", "41", "42", "44", "47":
+        return OutcomeCongestion, true
+    case "1", "3", "20", "27":
+        return OutcomeChanUnavail, true
+    }
+    return "", false
+}
+
+// RecordDialOutcome feeds the result of a Dial towards a provider into its
+// success rate, ASR, quality window and circuit breaker. Congestion and
+// unavailable results count as failed calls, everything else as the carrier
+// working.
+func (lb *LoadBalancer) RecordDialOutcome(providerName string, outcome DialOutcome, timing DialTiming) {
+    lb.mu.Lock()
+    defer lb.mu.Unlock()
+    
+    stats := lb.statsFor(providerName)
+    
+    switch outcome {
+    case OutcomeAnswered:
+        stats.Answered++
+    case OutcomeBusy:
+        stats.Busy++
+    case OutcomeCongestion:
+        stats.Congestion++
+    case OutcomeChanUnavail:
+        stats.ChanUnavail++
+    case OutcomeNoAnswer:
+        stats.NoAnswer++
+    default:
+        return
+    }
+    
+    stats.TotalCalls++
+    stats.LastCallTime = time.Now()
+    
+    if outcome.CarrierFailure() {
+        stats.FailedCalls++
+        stats.ConsecutiveFailures++
+    } else {
+        stats.ConsecutiveFailures = 0
+    }
+    
+    stats.SuccessRate = float64(stats.TotalCalls-stats.FailedCalls) / float64(stats.TotalCalls) * 100
+    
+    attempts := stats.Answered + stats.Busy + stats.Congestion + stats.ChanUnavail + stats.NoAnswer
+    stats.ASR = float64(stats.Answered) / float64(attempts) * 100
+    
+    lb.recordQuality(stats, outcome, timing)
+    lb.recordResult(stats, outcome.CarrierFailure())
+    
+    snapshot := *stats
+    go lb.updateStatsInDB(&snapshot)
+}
+
+// RecordCallDuration adds the duration of a completed call to the provider's
+// average without counting it as another call; the Dial outcome does that.
+func (lb *LoadBalancer) RecordCallDuration(providerName string, duration time.Duration) {
+    lb.mu.Lock()
+    defer lb.mu.Unlock()
+    
+    stats := lb.statsFor(providerName)
+    
+    n := lb.durationSamples[providerName] + 1
+    lb.durationSamples[providerName] = n
+    stats.AvgCallDuration = (stats.AvgCallDuration*float64(n-1) + duration.Seconds()) / float64(n)
+}
@@ -0,0 +1,47 @@
+package loadbalancer
+
+import (
+    "testing"
+)
+
+func TestClassifyDial(t *testing.T) {
+    tests := []struct {
+        dialStatus, cause string
+        outcome           DialOutcome
+        ok                bool
+    }{
+        {"ANSWER", "16", OutcomeAnswered, true},
+        {"BUSY", "", OutcomeBusy, true},
+        {"NOANSWER", "", OutcomeNoAnswer, true},
+        {"CONGESTION", "", OutcomeCongestion, true},
+        {"CHANUNAVAIL", "", OutcomeChanUnavail, true},
+        {"CANCEL", "16", "", false},
+        {"INVALIDARGS", "", "", false},
+        
+        // Without DIALSTATUS the hangup cause decides
+        {"", "17", OutcomeBusy, true},
+        {"", "19", OutcomeNoAnswer, true},
+        {"", "34", OutcomeCongestion, true},
+        {"", "38", OutcomeCongestion, true},
+        {"", "3", OutcomeChanUnavail, true},
+        {"", "16", "", false},
+        {"", "", "", false},
+    }
+    
+    for _, tt := range tests {
+        outcome, ok := ClassifyDial(tt.dialStatus, tt.cause)
+        if outcome != tt.outcome || ok != tt.ok {
+            t.Errorf("ClassifyDial(%q, %q) = %q, %v; want %q, %v",
+                tt.dialStatus, tt.cause, outcome, ok, tt.outcome, tt.ok)
+        }
+    }
+}
+
+func TestCarrierFailure(t *testing.T) {
+    for _, outcome := range DialOutcomes {
+        want := outcome == OutcomeCongestion || outcome == OutcomeChanUnavail
+        if got := outcome.CarrierFailure(); got != want {
+            t.Errorf("%s.CarrierFailure() = %v, want %v", outcome, got, want)
+        }
+    }
+}
@@ -0,0 +1,26 @@
+package loadbalancer
+
+import "time"
+
+// SetReachable records the result of an active probe. An unreachable
+// provider is skipped by SelectProvider until a probe succeeds again.
+// It returns true if the provider's reachability changed.
+func (lb *LoadBalancer) SetReachable(providerName string, up bool, latency time.Duration) bool {
+    lb.mu.Lock()
+    defer lb.mu.Unlock()
+    
+    stats := lb.statsFor(providerName)
+    changed := stats.ProbeDown == up
+    
+    stats.ProbeDown = !up
+    stats.LastProbeTime = time.Now()
+    if up {
+        stats.ProbeLatency = latency.Seconds()
+    }
+    
+    if changed {
+        snapshot := *stats
+        go lb.updateStatsInDB(&snapshot)
+    }
+    return changed
+}
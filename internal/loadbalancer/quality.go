@@ -0,0 +1,225 @@
+package loadbalancer
+
+import (
+    "math/rand"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// QualityWeights sets how much answer-seizure ratio, average call duration
+// and post-dial delay count towards a provider's quality score. Only the
+// ratio between the weights matters.
+type QualityWeights struct {
+    ASR float64
+    ACD float64
+    PDD float64
+}
+
+func (w QualityWeights) isZero() bool {
+    return w.ASR <= 0 && w.ACD <= 0 && w.PDD <= 0
+}
+
+// QualityConfig controls the quality load balance mode
+type QualityConfig struct {
+    // Window is the rolling window the scores are computed over
+    Window time.Duration
+    
+    // MinShare (0-1) of the traffic is spread evenly over all candidates,
+    // so worse providers keep receiving enough calls to be re-scored
+    MinShare float64
+    
+    // TargetACD is the average call duration that earns the full ACD score
+    TargetACD time.Duration
+    
+    // MaxPDD is the post-dial delay that earns no PDD score at all
+    MaxPDD time.Duration
+    
+    // Weights are used by routes that set no weights of their own
+    Weights QualityWeights
+}
+
+// Defaults for QualityConfig fields left at zero
+const (
+    DefaultQualityWindow = 15 * time.Minute
+    DefaultMinShare      = 0.1
+    DefaultTargetACD     = 3 * time.Minute
+    DefaultMaxPDD        = 10 * time.Second
+    DefaultASRWeight     = 0.5
+    DefaultACDWeight     = 0.3
+    DefaultPDDWeight     = 0.2
+)
+
+func (c QualityConfig) withDefaults() QualityConfig {
+    if c.Window <= 0 {
+        c.Window = DefaultQualityWindow
+    }
+    if c.MinShare <= 0 || c.MinShare > 1 {
+        c.MinShare = DefaultMinShare
+    }
+    if c.TargetACD <= 0 {
+        c.TargetACD = DefaultTargetACD
+    }
+    if c.MaxPDD <= 0 {
+        c.MaxPDD = DefaultMaxPDD
+    }
+    if c.Weights.isZero() {
+        c.Weights = QualityWeights{ASR: DefaultASRWeight, ACD: DefaultACDWeight, PDD: DefaultPDDWeight}
+    }
+    return c
+}
+
+// DialTiming is how long a Dial took, as reported by Asterisk. Zero fields
+// were not reported.
+type DialTiming struct {
+    // PostDialDelay is the time from the Dial until the far end signalled
+    // ringing or progress
+    PostDialDelay time.Duration
+    
+    // Talk is the time the call was up after it was answered
+    Talk time.Duration
+}
+
+type qualitySample struct {
+    at       time.Time
+    answered bool
+    talk     time.Duration
+    pdd      time.Duration
+}
+
+// qualityMetrics are the averages of a provider's samples in the window
+type qualityMetrics struct {
+    attempts int
+    asr      float64 // 0-1
+    acd      time.Duration
+    pdd      time.Duration
+    hasACD   bool
+    hasPDD   bool
+}
+
+// recordQuality adds a Dial result to the provider's rolling window and
+// refreshes the score shown in its stats. Caller must hold lb.mu.
+func (lb *LoadBalancer) recordQuality(stats *models.LoadBalancerStats, outcome DialOutcome, timing DialTiming) {
+    now := time.Now()
+    samples := append(lb.qualitySamples[stats.ProviderName], qualitySample{
+        at:       now,
+        answered: outcome == OutcomeAnswered,
+        talk:     timing.Talk,
+        pdd:      timing.PostDialDelay,
+    })
+    lb.qualitySamples[stats.ProviderName] = pruneQuality(samples, now, lb.qualityCfg.Window)
+    
+    m := lb.qualityMetricsFor(stats.ProviderName, now)
+    stats.QualityScore = lb.qualityScore(m, lb.qualityCfg.Weights)
+    stats.PostDialDelay = m.pdd.Seconds()
+}
+
+// pruneQuality drops samples that left the rolling window
+func pruneQuality(samples []qualitySample, now time.Time, window time.Duration) []qualitySample {
+    cutoff := now.Add(-window)
+    i := 0
+    for i < len(samples) && samples[i].at.Before(cutoff) {
+        i++
+    }
+    return samples[i:]
+}
+
+// qualityMetricsFor averages the provider's samples in the window.
+// Caller must hold lb.mu.
+func (lb *LoadBalancer) qualityMetricsFor(providerName string, now time.Time) qualityMetrics {
+    var m qualityMetrics
+    var answered, talkSamples, pddSamples int
+    var talk, pdd time.Duration
+    
+    cutoff := now.Add(-lb.qualityCfg.Window)
+    for _, s := range lb.qualitySamples[providerName] {
+        if s.at.Before(cutoff) {
+            continue
+        }
+        m.attempts++
+        if s.answered {
+            answered++
+            if s.talk > 0 {
+                talk += s.talk
+                talkSamples++
+            }
+        }
+        if s.pdd > 0 {
+            pdd += s.pdd
+            pddSamples++
+        }
+    }
+    
+    if m.attempts > 0 {
+        m.asr = float64(answered) / float64(m.attempts)
+    }
+    if talkSamples > 0 {
+        m.acd = talk / time.Duration(talkSamples)
+        m.hasACD = true
+    }
+    if pddSamples > 0 {
+        m.pdd = pdd / time.Duration(pddSamples)
+        m.hasPDD = true
+    }
+    return m
+}
+
+// qualityScore combines the metrics into a score between 0 and 1. A metric
+// without samples scores 0.5, so a new provider starts in the middle.
+// Caller must hold lb.mu.
+func (lb *LoadBalancer) qualityScore(m qualityMetrics, w QualityWeights) float64 {
+    if w.isZero() {
+        w = lb.qualityCfg.Weights
+    }
+    
+    asr, acd, pdd := 0.5, 0.5, 0.5
+    if m.attempts > 0 {
+        asr = m.asr
+    }
+    if m.hasACD {
+        acd = m.acd.Seconds() / lb.qualityCfg.TargetACD.Seconds()
+        if acd > 1 {
+            acd = 1
+        }
+    }
+    if m.hasPDD {
+        pdd = 1 - m.pdd.Seconds()/lb.qualityCfg.MaxPDD.Seconds()
+        if pdd < 0 {
+            pdd = 0
+        }
+    }
+    
+    total := w.ASR + w.ACD + w.PDD
+    return (w.ASR*asr + w.ACD*acd + w.PDD*pdd) / total
+}
+
+// quality picks a provider at random with a probability that grows with its
+// score. MinShare of the traffic is spread evenly, so every candidate keeps
+// receiving some calls and its score can recover.
+func (lb *LoadBalancer) quality(providers []*models.Provider, weights QualityWeights) (*models.Provider, error) {
+    lb.mu.RLock()
+    now := time.Now()
+    scores := make([]float64, len(providers))
+    total := 0.0
+    for i, p := range providers {
+        scores[i] = lb.qualityScore(lb.qualityMetricsFor(p.Name, now), weights)
+        total += scores[i]
+    }
+    minShare := lb.qualityCfg.MinShare
+    lb.mu.RUnlock()
+    
+    n := float64(len(providers))
+    r := rand.Float64()
+    for i, p := range providers {
+        share := 1 / n
+        if total > 0 {
+            share = minShare/n + (1-minShare)*scores[i]/total
+        }
+        r -= share
+        if r < 0 {
+            return p, nil
+        }
+    }
+    
+    return providers[len(providers)-1], nil
+}
@@ -0,0 +1,143 @@
+package loadbalancer
+
+import (
+    "math"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestQualityScore(t *testing.T) {
+    lb := New()
+    lb.ConfigureQuality(QualityConfig{TargetACD: 100 * time.Second, MaxPDD: 10 * time.Second})
+    even := QualityWeights{ASR: 1, ACD: 1, PDD: 1}
+    
+    tests := []struct {
+        name    string
+        metrics qualityMetrics
+        weights QualityWeights
+        want    float64
+    }{
+        {"no samples start in the middle", qualityMetrics{}, even, 0.5},
+        {"perfect", qualityMetrics{attempts: 10, asr: 1, acd: 100 * time.Second, hasACD: true, pdd: 0, hasPDD: true}, even, 1},
+        {"ACD above target is capped", qualityMetrics{attempts: 10, asr: 1, acd: 500 * time.Second, hasACD: true}, even, 2.5 / 3},
+        {"PDD above max scores 0", qualityMetrics{attempts: 10, asr: 0, pdd: 20 * time.Second, hasPDD: true}, even, 0.5 / 3},
+        {"half of everything", qualityMetrics{attempts: 10, asr: 0.5, acd: 50 * time.Second, hasACD: true, pdd: 5 * time.Second, hasPDD: true}, even, 0.5},
+        {"ASR only", qualityMetrics{attempts: 10, asr: 0.8, acd: 10 * time.Second, hasACD: true}, QualityWeights{ASR: 1}, 0.8},
+        {"weighted", qualityMetrics{attempts: 10, asr: 1, acd: 0, hasACD: true}, QualityWeights{ASR: 3, ACD: 1}, 0.75},
+    }
+    
+    for _, tt := range tests {
+        if got := lb.qualityScore(tt.metrics, tt.weights); math.Abs(got-tt.want) > 1e-9 {
+            t.Errorf("%s: score %.4f, want %.4f", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestQualityMetricsWindow(t *testing.T) {
+    lb := New()
+    lb.ConfigureQuality(QualityConfig{Window: time.Minute})
+    now := time.Now()
+    
+    lb.qualitySamples["p"] = []qualitySample{
+        {at: now.Add(-2 * time.Minute), answered: false}, // outside the window
+        {at: now, answered: true, talk: 60 * time.Second, pdd: 2 * time.Second},
+        {at: now, answered: true, talk: 120 * time.Second},
+        {at: now, answered: false, pdd: 4 * time.Second},
+        {at: now, answered: false},
+    }
+    
+    m := lb.qualityMetricsFor("p", now)
+    if m.attempts != 4 || m.asr != 0.5 {
+        t.Errorf("attempts %d, ASR %.2f; want 4, 0.50", m.attempts, m.asr)
+    }
+    if !m.hasACD || m.acd != 90*time.Second {
+        t.Errorf("ACD %v, want 1m30s", m.acd)
+    }
+    if !m.hasPDD || m.pdd != 3*time.Second {
+        t.Errorf("PDD %v, want 3s", m.pdd)
+    }
+}
+
+func TestRecordDialOutcomeQuality(t *testing.T) {
+    lb := New()
+    lb.RecordDialOutcome("p", OutcomeAnswered, DialTiming{PostDialDelay: time.Second, Talk: DefaultTargetACD})
+    lb.RecordDialOutcome("p", OutcomeCongestion, DialTiming{})
+    
+    stats := lb.GetProviderStats("p")
+    if stats.ASR != 50 || stats.FailedCalls != 1 {
+        t.Errorf("ASR %.0f, failed %d; want 50, 1", stats.ASR, stats.FailedCalls)
+    }
+    if stats.QualityScore <= 0.5 || stats.QualityScore >= 1 {
+        t.Errorf("quality score %.3f, want between 0.5 and 1", stats.QualityScore)
+    }
+    if stats.PostDialDelay != 1 {
+        t.Errorf("post-dial delay %.2fs, want 1s", stats.PostDialDelay)
+    }
+}
+
+func TestQualitySelection(t *testing.T) {
+    lb := New()
+    lb.ConfigureQuality(QualityConfig{MinShare: 0.2})
+    for i := 0; i < 20; i++ {
+        lb.RecordDialOutcome("good", OutcomeAnswered, DialTiming{PostDialDelay: time.Second, Talk: DefaultTargetACD})
+        lb.RecordDialOutcome("bad", OutcomeNoAnswer, DialTiming{PostDialDelay: DefaultMaxPDD})
+    }
+    
+    providers := []*models.Provider{
+        {Name: "good", Active: true},
+        {Name: "bad", Active: true},
+    }
+    
+    // good scores 0.5 + 0.3 + 0.2*0.9 = 0.98. bad scores only the neutral
+    // 0.5 of its ACD weight, having answered nothing: 0.3*0.5 = 0.15. It gets
+    // half the 20% spread evenly plus 80% * 0.15/1.13, about 20.6%.
+    const calls = 5000
+    picked := make(map[string]int)
+    for i := 0; i < calls; i++ {
+        p, err := lb.Select(providers, Selection{Mode: "quality"})
+        if err != nil {
+            t.Fatal(err)
+        }
+        picked[p.Name]++
+    }
+    
+    badShare := float64(picked["bad"]) / calls
+    if badShare < 0.18 || badShare > 0.23 {
+        t.Errorf("bad provider got %.1f%% of calls, want about 20.6%%", badShare*100)
+    }
+}
+
+func TestQualitySelectionRouteWeights(t *testing.T) {
+    lb := New()
+    lb.ConfigureQuality(QualityConfig{MinShare: 0.01})
+    for i := 0; i < 20; i++ {
+        // fast answers, short calls
+        lb.RecordDialOutcome("fast", OutcomeAnswered, DialTiming{PostDialDelay: time.Second, Talk: time.Second})
+        // slow answers, long calls
+        lb.RecordDialOutcome("long", OutcomeAnswered, DialTiming{PostDialDelay: DefaultMaxPDD, Talk: DefaultTargetACD})
+    }
+    
+    providers := []*models.Provider{
+        {Name: "fast", Active: true},
+        {Name: "long", Active: true},
+    }
+    
+    for weights, want := range map[QualityWeights]string{
+        {ACD: 1}: "long",
+        {PDD: 1}: "fast",
+    } {
+        picked := make(map[string]int)
+        for i := 0; i < 1000; i++ {
+            p, err := lb.Select(providers, Selection{Mode: "quality", Quality: weights})
+            if err != nil {
+                t.Fatal(err)
+            }
+            picked[p.Name]++
+        }
+        if picked[want] < 900 {
+            t.Errorf("weights %+v: %s picked %d of 1000 times, want most", weights, want, picked[want])
+        }
+    }
+}
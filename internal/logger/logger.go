@@ -0,0 +1,254 @@
+package logger
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Level is the severity of a log line
+type Level int
+
+const (
+    DebugLevel Level = iota
+    InfoLevel
+    WarnLevel
+    ErrorLevel
+)
+
+func (l Level) String() string {
+    switch l {
+    case DebugLevel:
+        return "debug"
+    case InfoLevel:
+        return "info"
+    case WarnLevel:
+        return "warn"
+    default:
+        return "error"
+    }
+}
+
+// ParseLevel converts a level name from the config file
+func ParseLevel(name string) (Level, error) {
+    switch strings.ToLower(name) {
+    case "debug":
+        return DebugLevel, nil
+    case "info", "":
+        return InfoLevel, nil
+    case "warn", "warning":
+        return WarnLevel, nil
+    case "error":
+        return ErrorLevel, nil
+    }
+    return InfoLevel, fmt.Errorf("unknown log level %q", name)
+}
+
+// Fields are structured key/value pairs attached to a log line
+type Fields map[string]interface{}
+
+// Config controls where and how log lines are written
+type Config struct {
+    Level      string
+    Format     string // "json" or "text"
+    File       string // empty means stderr
+    MaxSizeMB  int    // rotate the file once it grows past this size
+    MaxBackups int    // rotated files to keep
+}
+
+type output struct {
+    mu     sync.Mutex
+    out    io.Writer
+    level  Level
+    json   bool
+    closer io.Closer
+}
+
+var std = &output{out: os.Stderr, level: InfoLevel}
+
+// Init configures the process-wide logger
+func Init(cfg Config) error {
+    level, err := ParseLevel(cfg.Level)
+    if err != nil {
+        return err
+    }
+    
+    var out io.Writer = os.Stderr
+    var closer io.Closer
+    if cfg.File != "" {
+        f, err := NewRotatingFile(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+        if err != nil {
+            return err
+        }
+        out, closer = f, f
+    }
+    
+    std.mu.Lock()
+    defer std.mu.Unlock()
+    
+    if std.closer != nil {
+        std.closer.Close()
+    }
+    std.out = out
+    std.closer = closer
+    std.level = level
+    std.json = cfg.Format != "text"
+    
+    return nil
+}
+
+// SetLevel changes the minimum level that is written
+func SetLevel(level Level) {
+    std.mu.Lock()
+    std.level = level
+    std.mu.Unlock()
+}
+
+// Close flushes and closes the log file, if any
+func Close() {
+    std.mu.Lock()
+    defer std.mu.Unlock()
+    
+    if std.closer != nil {
+        std.closer.Close()
+        std.closer = nil
+        std.out = os.Stderr
+    }
+}
+
+// Entry is a logger carrying a set of fields
+type Entry struct {
+    fields Fields
+}
+
+// Component returns a logger tagged with the component that writes it
+func Component(name string) *Entry {
+    return &Entry{fields: Fields{"component": name}}
+}
+
+// WithField returns a copy of the entry with one more field
+func (e *Entry) WithField(key string, value interface{}) *Entry {
+    return e.WithFields(Fields{key: value})
+}
+
+// WithFields returns a copy of the entry with the given fields added
+func (e *Entry) WithFields(fields Fields) *Entry {
+    merged := make(Fields, len(e.fields)+len(fields))
+    for k, v := range e.fields {
+        merged[k] = v
+    }
+    for k, v := range fields {
+        merged[k] = v
+    }
+    return &Entry{fields: merged}
+}
+
+func (e *Entry) Debugf(format string, args ...interface{}) { e.log(DebugLevel, format, args...) }
+func (e *Entry) Infof(format string, args ...interface{})  { e.log(InfoLevel, format, args...) }
+func (e *Entry) Warnf(format string, args ...interface{})  { e.log(WarnLevel, format, args...) }
+func (e *Entry) Errorf(format string, args ...interface{}) { e.log(ErrorLevel, format, args...) }
+
+// Fatalf logs at error level and exits the process
+func (e *Entry) Fatalf(format string, args ...interface{}) {
+    e.log(ErrorLevel, format, args...)
+    Close()
+    os.Exit(1)
+}
+
+func (e *Entry) log(level Level, format string, args ...interface{}) {
+    std.mu.Lock()
+    defer std.mu.Unlock()
+    
+    if level < std.level {
+        return
+    }
+    
+    msg := fmt.Sprintf(format, args...)
+    now := time.Now()
+    
+    var line []byte
+    if std.json {
+        line = formatJSON(now, level, msg, e.fields)
+    } else {
+        line = formatText(now, level, msg, e.fields)
+    }
+    
+    std.out.Write(line)
+}
+
+func sortedFieldKeys(fields Fields) []string {
+    keys := make([]string, 0, len(fields))
+    for k := range fields {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func formatJSON(t time.Time, level Level, msg string, fields Fields) []byte {
+    var b strings.Builder
+    b.WriteString(`{"time":"`)
+    b.WriteString(t.Format(time.RFC3339Nano))
+    b.WriteString(`","level":"`)
+    b.WriteString(level.String())
+    b.WriteString(`","msg":`)
+    writeJSONValue(&b, msg)
+    
+    for _, k := range sortedFieldKeys(fields) {
+        b.WriteByte(',')
+        writeJSONValue(&b, k)
+        b.WriteByte(':')
+        writeJSONValue(&b, fields[k])
+    }
+    
+    b.WriteString("}\n")
+    return []byte(b.String())
+}
+
+func writeJSONValue(b *strings.Builder, v interface{}) {
+    if err, ok := v.(error); ok {
+        v = err.Error()
+    }
+    
+    encoded, err := json.Marshal(v)
+    if err != nil {
+        encoded, _ = json.Marshal(fmt.Sprint(v))
+    }
+    b.Write(encoded)
+}
+
+func formatText(t time.Time, level Level, msg string, fields Fields) []byte {
+    var b strings.Builder
+    b.WriteString(t.Format("2006-01-02 15:04:05.000"))
+    b.WriteByte(' ')
+    b.WriteString(fmt.Sprintf("%-5s", strings.ToUpper(level.String())))
+    b.WriteByte(' ')
+    b.WriteString(msg)
+    
+    for _, k := range sortedFieldKeys(fields) {
+        b.WriteString(fmt.Sprintf(" %s=%v", k, fields[k]))
+    }
+    
+    b.WriteByte('\n')
+    return []byte(b.String())
+}
+
+// StdWriter adapts the standard library logger, so third-party log.Printf
+// output ends up in the same stream. Use with log.SetFlags(0).
+func StdWriter(component string) io.Writer {
+    return stdWriter{entry: Component(component)}
+}
+
+type stdWriter struct {
+    entry *Entry
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+    w.entry.Infof("%s", strings.TrimRight(string(p), "\n"))
+    return len(p), nil
+}
@@ -0,0 +1,118 @@
+package logger
+
+import (
+    "fmt"
+    "os"
+    "sync"
+)
+
+// RotatingFile is an io.Writer that renames the file to file.1, file.2, ...
+// once it reaches maxSize, keeping at most maxBackups old files
+type RotatingFile struct {
+    mu         sync.Mutex
+    path       string
+    maxSize    int64
+    maxBackups int
+    file       *os.File
+    size       int64
+}
+
+// NewRotatingFile opens path for appending. maxSizeMB <= 0 disables rotation.
+func NewRotatingFile(path string, maxSizeMB, maxBackups int) (*RotatingFile, error) {
+    f := &RotatingFile{
+        path:       path,
+        maxSize:    int64(maxSizeMB) * 1024 * 1024,
+        maxBackups: maxBackups,
+    }
+    
+    if err := f.open(); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+func (f *RotatingFile) open() error {
+    file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return fmt.Errorf("failed to open log file %s: %v", f.path, err)
+    }
+    
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+    
+    f.file = file
+    f.size = info.Size()
+    return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    if f.file != nil && f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize && f.size > 0 {
+        if err := f.rotate(); err != nil {
+            fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+        }
+    }
+    
+    // The file could not be reopened after a failed rotation: try again, and
+    // keep the line on stderr until it works
+    if f.file == nil {
+        if err := f.open(); err != nil {
+            return os.Stderr.Write(p)
+        }
+    }
+    
+    n, err := f.file.Write(p)
+    f.size += int64(n)
+    return n, err
+}
+
+// rotate moves the current file aside and opens a new one. If that fails,
+// logging carries on in the current file, and f.file is nil only if even
+// that cannot be reopened.
+func (f *RotatingFile) rotate() error {
+    err := f.file.Close()
+    f.file = nil
+    if err == nil {
+        err = f.shift()
+    }
+    if err == nil {
+        err = f.open()
+    }
+    if err == nil {
+        return nil
+    }
+    
+    if reopenErr := f.open(); reopenErr != nil {
+        return fmt.Errorf("%v (and reopening failed: %v)", err, reopenErr)
+    }
+    return err
+}
+
+// shift renames file.1 to file.2 and so on, dropping the oldest, and the
+// current file to file.1
+func (f *RotatingFile) shift() error {
+    if f.maxBackups <= 0 {
+        return os.Remove(f.path)
+    }
+    
+    os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+    for i := f.maxBackups - 1; i >= 1; i-- {
+        os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+    }
+    return os.Rename(f.path, f.path+".1")
+}
+
+func (f *RotatingFile) Close() error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    if f.file == nil {
+        return nil
+    }
+    return f.file.Close()
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+    "bufio"
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+)
+
+var log = logger.Component("metrics")
+
+// Collector writes its current metrics when /metrics is scraped
+type Collector interface {
+    Collect(w *Writer)
+}
+
+// Label is a single name="value" pair on a sample
+type Label struct {
+    Name  string
+    Value string
+}
+
+// L builds a label
+func L(name, value string) Label {
+    return Label{Name: name, Value: value}
+}
+
+// Writer renders samples in the Prometheus text exposition format
+type Writer struct {
+    buf *bufio.Writer
+}
+
+// Header writes the HELP and TYPE lines of a metric family.
+// typ is one of "counter", "gauge" or "histogram".
+func (w *Writer) Header(name, help, typ string) {
+    fmt.Fprintf(w.buf, "# HELP %s %s\n", name, help)
+    fmt.Fprintf(w.buf, "# TYPE %s %s\n", name, typ)
+}
+
+// Sample writes a single sample line
+func (w *Writer) Sample(name string, value float64, labels ...Label) {
+    w.buf.WriteString(name)
+    if len(labels) > 0 {
+        w.buf.WriteByte('{')
+        for i, l := range labels {
+            if i > 0 {
+                w.buf.WriteByte(',')
+            }
+            fmt.Fprintf(w.buf, "%s=\"%s\"", l.Name, escapeLabel(l.Value))
+        }
+        w.buf.WriteByte('}')
+    }
+    w.buf.WriteByte(' ')
+    w.buf.WriteString(formatValue(value))
+    w.buf.WriteByte('\n')
+}
+
+// Handler serves the metrics of all collectors
+func Handler(collectors ...Collector) http.Handler {
+    return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+        rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        
+        w := &Writer{buf: bufio.NewWriter(rw)}
+        for _, c := range collectors {
+            c.Collect(w)
+        }
+        
+        if err := w.buf.Flush(); err != nil {
+            log.Errorf("Failed to write metrics: %v", err)
+        }
+    })
+}
+
+// DefaultBuckets are latency buckets in seconds suited to routing decisions,
+// which are dominated by a handful of MySQL round trips
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// HistogramVec is a histogram partitioned by the value of one label
+type HistogramVec struct {
+    mu      sync.Mutex
+    name    string
+    help    string
+    label   string
+    buckets []float64
+    series  map[string]*histogram
+}
+
+type histogram struct {
+    counts []uint64 // per bucket, not cumulative
+    sum    float64
+    count  uint64
+}
+
+func NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+    return &HistogramVec{
+        name:    name,
+        help:    help,
+        label:   label,
+        buckets: buckets,
+        series:  make(map[string]*histogram),
+    }
+}
+
+// Observe records a value for the given label value
+func (h *HistogramVec) Observe(labelValue string, value float64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    s, exists := h.series[labelValue]
+    if !exists {
+        s = &histogram{counts: make([]uint64, len(h.buckets))}
+        h.series[labelValue] = s
+    }
+    
+    for i, upper := range h.buckets {
+        if value <= upper {
+            s.counts[i]++
+            break
+        }
+    }
+    s.sum += value
+    s.count++
+}
+
+func (h *HistogramVec) Collect(w *Writer) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    
+    w.Header(h.name, h.help, "histogram")
+    
+    for _, labelValue := range sortedKeys(h.series) {
+        s := h.series[labelValue]
+        
+        var cumulative uint64
+        for i, upper := range h.buckets {
+            cumulative += s.counts[i]
+            w.Sample(h.name+"_bucket", float64(cumulative), L(h.label, labelValue), L("le", formatValue(upper)))
+        }
+        w.Sample(h.name+"_bucket", float64(s.count), L(h.label, labelValue), L("le", "+Inf"))
+        w.Sample(h.name+"_sum", s.sum, L(h.label, labelValue))
+        w.Sample(h.name+"_count", float64(s.count), L(h.label, labelValue))
+    }
+}
+
+// CounterVec is a counter partitioned by the value of one label
+type CounterVec struct {
+    mu     sync.Mutex
+    name   string
+    help   string
+    label  string
+    values map[string]float64
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+    return &CounterVec{
+        name:   name,
+        help:   help,
+        label:  label,
+        values: make(map[string]float64),
+    }
+}
+
+// Inc adds one to the counter for the given label value
+func (c *CounterVec) Inc(labelValue string) {
+    c.mu.Lock()
+    c.values[labelValue]++
+    c.mu.Unlock()
+}
+
+func (c *CounterVec) Collect(w *Writer) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    
+    w.Header(c.name, c.help, "counter")
+    for _, labelValue := range sortedKeys(c.values) {
+        w.Sample(c.name, c.values[labelValue], L(c.label, labelValue))
+    }
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func formatValue(v float64) string {
+    switch {
+    case math.IsInf(v, 1):
+        return "+Inf"
+    case math.IsInf(v, -1):
+        return "-Inf"
+    case math.IsNaN(v):
+        return "NaN"
+    }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+    v = strings.ReplaceAll(v, `\`, `\\`)
+    v = strings.ReplaceAll(v, "\n", `\n`)
+    return strings.ReplaceAll(v, `"`, `\"`)
+}
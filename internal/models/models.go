@@ -10,12 +10,16 @@ type Provider struct {
     Name        string    `json:"name"`
     Type        string    `json:"type"` // "inbound", "intermediate", "final"
     Host        string    `json:"host"`
+    // Addresses, CIDRs and hostnames calls from the provider may come from;
+    // empty for Host only
+    AllowedIPs  []string  `json:"allowed_ips,omitempty"`
     Port        int       `json:"port"`
     Username    string    `json:"username"`    // Can be empty for IP-only auth
     Password    string    `json:"password"`    // Can be empty for IP-only auth
     AuthType    string    `json:"auth_type"`   // "ip", "credentials", "both"
     Codecs      []string  `json:"codecs"`
     MaxChannels int       `json:"max_channels"`
+    MaxCPS      int       `json:"max_cps"`     // Calls per second, inbound providers only
     Priority    int       `json:"priority"`
     Weight      int       `json:"weight"`
     Active      bool      `json:"active"`
@@ -42,47 +46,187 @@ type ProviderRoute struct {
     ID                   int       `json:"id"`
     Name                 string    `json:"name"`
     InboundProvider      string    `json:"inbound_provider"`      // S1 in UML
-    IntermediateProvider string    `json:"intermediate_provider"` // S3 in UML
-    FinalProvider        string    `json:"final_provider"`        // S4 in UML
-    LoadBalanceMode      string    `json:"load_balance_mode"`     // round_robin, weighted, priority, failover
+    IntermediateProvider string    `json:"intermediate_provider"` // S3 in UML, provider or group
+    FinalProvider        string    `json:"final_provider"`        // S4 in UML, provider or group
+    LoadBalanceMode      string    `json:"load_balance_mode"`     // see loadbalancer.Modes
     Priority             int       `json:"priority"`
     Active               bool      `json:"active"`
     CreatedAt            time.Time `json:"created_at"`
+    // Quality mode weights, all zero for the configured defaults
+    ASRWeight            float64   `json:"asr_weight"`
+    ACDWeight            float64   `json:"acd_weight"`
+    PDDWeight            float64   `json:"pdd_weight"`
+    // Match criteria, all must hold; empty matches any call
+    DNISPrefix           string    `json:"dnis_prefix"`
+    DNISPattern          string    `json:"dnis_pattern"` // regular expression
+    ANIPrefix            string    `json:"ani_prefix"`
+    Country              string    `json:"country"` // ISO 3166 code of the DNIS
+    // When the route may be used, nil for always
+    Schedule             *RouteSchedule `json:"schedule,omitempty"`
+    // What happens to calls whose return legs fail ANI/DNIS verification:
+    // "log", "reject" or "quarantine"
+    VerifyPolicy         string    `json:"verify_policy"`
+}
+
+// RouteSchedule limits when a route is active. A schedule without windows
+// allows calls at any time except on its holidays.
+type RouteSchedule struct {
+    Timezone string           `json:"timezone,omitempty"` // IANA name, default UTC
+    Windows  []ScheduleWindow `json:"windows,omitempty"`
+    Holidays []string         `json:"holidays,omitempty"` // YYYY-MM-DD, no calls all day
+}
+
+// ScheduleWindow is a daily time range on some days of the week
+type ScheduleWindow struct {
+    Days  []string `json:"days,omitempty"` // "mon".."sun", empty for every day
+    Start string   `json:"start"`          // HH:MM
+    End   string   `json:"end"`            // HH:MM, at or before Start to run past midnight
+}
+
+// ProviderGroup is a named pool of providers that a route hop can send
+// calls to
+type ProviderGroup struct {
+    ID          int           `json:"id"`
+    Name        string        `json:"name"`
+    Description string        `json:"description"`
+    Members     []GroupMember `json:"members"`
+    CreatedAt   time.Time     `json:"created_at"`
+}
+
+// GroupMember is a provider in a group. Weight and Priority, when set,
+// replace the provider's own values for calls through the group.
+type GroupMember struct {
+    ProviderName string `json:"provider_name"`
+    Weight       *int   `json:"weight,omitempty"`
+    Priority     *int   `json:"priority,omitempty"`
+}
+
+// ListEntry is a number or prefix on the ANI or DNIS blocklist or
+// allowlist, optionally only for calls from one inbound provider or on one
+// route
+type ListEntry struct {
+    ID              int       `json:"id"`
+    List            string    `json:"list"`  // "block" or "allow"
+    Field           string    `json:"field"` // "ani" or "dnis"
+    Number          string    `json:"number"`
+    Prefix          bool      `json:"prefix"`
+    InboundProvider string    `json:"inbound_provider,omitempty"`
+    RouteName       string    `json:"route_name,omitempty"`
+    Note            string    `json:"note,omitempty"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// NumberRule rewrites the ANI or DNIS of calls from (inbound) or to
+// (outbound) a provider. A provider's rules for a direction apply in order
+// of Position.
+type NumberRule struct {
+    ID           int       `json:"id"`
+    ProviderName string    `json:"provider_name"`
+    Direction    string    `json:"direction"` // "inbound" or "outbound"
+    Field        string    `json:"field"`     // "ani", "dnis" or "both"
+    Action       string    `json:"action"`    // "strip", "add", "regex" or "e164"
+    // Pattern limits the rule to numbers it matches; for regex it is the
+    // expression replaced
+    Pattern      string    `json:"pattern,omitempty"`
+    // Value is the prefix to strip or add, the regex replacement or the
+    // country of e164
+    Value        string    `json:"value"`
+    Position     int       `json:"position"`
+    CreatedAt    time.Time `json:"created_at"`
+}
+
+// Rate is one prefix of a provider's rate deck
+type Rate struct {
+    ID               int       `json:"id"`
+    ProviderName     string    `json:"provider_name"`
+    Prefix           string    `json:"prefix"`
+    RatePerMinute    float64   `json:"rate_per_minute"`
+    BillingIncrement int       `json:"billing_increment"` // seconds
+    EffectiveDate    time.Time `json:"effective_date"`
+    Currency         string    `json:"currency"`
 }
 
 // CallRecord represents complete call flow through the system
 type CallRecord struct {
-    ID                   int64
-    CallID               string
+    ID                   int64      `json:"id"`
+    CallID               string     `json:"call_id"`
     // Original values from S1
-    OriginalANI          string    // ANI-1
-    OriginalDNIS         string    // DNIS-1
+    OriginalANI          string     `json:"original_ani"`  // ANI-1
+    OriginalDNIS         string     `json:"original_dnis"` // DNIS-1
     // Transformed values for S3
-    TransformedANI       string    // ANI-2 (=DNIS-1)
-    AssignedDID          string    // DID
+    TransformedANI       string     `json:"transformed_ani"` // ANI-2 (=DNIS-1)
+    AssignedDID          string     `json:"assigned_did"`    // DID
     // Providers involved
-    InboundProvider      string    // S1
-    IntermediateProvider string    // S3
-    FinalProvider        string    // S4
+    InboundProvider      string     `json:"inbound_provider"`      // S1
+    IntermediateProvider string     `json:"intermediate_provider"` // S3
+    FinalProvider        string     `json:"final_provider"`        // S4
+    RouteName            string     `json:"route_name"`
     // Call state
-    Status               string
-    CurrentStep          string    // "S1_TO_S2", "S2_TO_S3", "S3_TO_S2", "S2_TO_S4", "S4_TO_S2"
-    StartTime            time.Time
-    EndTime              *time.Time
-    Duration             int
-    RecordingPath        string
+    Status               string     `json:"status"`
+    CurrentStep          string     `json:"current_step"` // "S1_TO_S2", "S2_TO_S3", "S3_TO_S2", "S2_TO_S4", "S4_TO_S2"
+    StartTime            time.Time  `json:"start_time"`
+    EndTime              *time.Time `json:"end_time,omitempty"`
+    Duration             int        `json:"duration"`
+    Billsec              int        `json:"billsec"` // answered (talk) time the call is rated on
+    RecordingPath        string     `json:"recording_path"`
+    HangupCause          string     `json:"hangup_cause,omitempty"`
+    // Router node that accepted the call (cluster mode)
+    NodeID               string     `json:"node_id"`
+    // Rates of the chosen providers for OriginalDNIS, nil without a rate deck
+    IntermediateRate     *Rate      `json:"intermediate_rate,omitempty"`
+    FinalRate            *Rate      `json:"final_rate,omitempty"`
+    // Rating of a completed call. Revenue is charged at the inbound
+    // provider's (sell) rate, cost at the intermediate and final (buy) rates,
+    // all in Currency. Currency is empty if the call could not be rated.
+    InboundRate          *Rate      `json:"inbound_rate,omitempty"`
+    Cost                 float64    `json:"cost"`
+    Revenue              float64    `json:"revenue"`
+    Margin               float64    `json:"margin"`
+    Currency             string     `json:"currency,omitempty"`
+}
+
+// CallLeg is one outbound Dial attempt of a call. A call has one leg towards
+// S3 and one towards S4, plus one more for every retry on another provider.
+type CallLeg struct {
+    ID          int64      `json:"id"`
+    CallID      string     `json:"call_id"`
+    LegNumber   int        `json:"leg_number"`
+    Step        string     `json:"step"` // "S2_TO_S3" or "S2_TO_S4"
+    Provider    string     `json:"provider"`
+    DID         string     `json:"did"`
+    DialStatus  string     `json:"dial_status,omitempty"`
+    HangupCause string     `json:"hangup_cause,omitempty"`
+    Outcome     string     `json:"outcome,omitempty"`
+    StartTime   time.Time  `json:"start_time"`
+    EndTime     *time.Time `json:"end_time,omitempty"`
 }
 
 // LoadBalancerStats tracks provider performance
 type LoadBalancerStats struct {
-    ProviderName    string
-    TotalCalls      int64
-    ActiveCalls     int64
-    FailedCalls     int64
-    SuccessRate     float64
-    AvgCallDuration float64
-    LastCallTime    time.Time
-    IsHealthy       bool
+    ProviderName    string    `json:"provider_name"`
+    TotalCalls      int64     `json:"total_calls"`
+    ActiveCalls     int64     `json:"active_calls"`
+    FailedCalls     int64     `json:"failed_calls"`
+    SuccessRate     float64   `json:"success_rate"`
+    AvgCallDuration float64   `json:"avg_call_duration"`
+    LastCallTime    time.Time `json:"last_call_time"`
+    IsHealthy       bool      `json:"is_healthy"`
+    // Dial outcomes reported by the dialplan
+    Answered            int64   `json:"answered"`
+    Busy                int64   `json:"busy"`
+    Congestion          int64   `json:"congestion"`
+    ChanUnavail         int64   `json:"chanunavail"`
+    NoAnswer            int64   `json:"noanswer"`
+    ASR                 float64 `json:"asr"` // Answer-seizure ratio, percent
+    ConsecutiveFailures int64   `json:"consecutive_failures"`
+    CircuitState        string  `json:"circuit_state"` // closed, open or half_open
+    // Active SIP OPTIONS probing
+    ProbeDown           bool      `json:"probe_down"`
+    ProbeLatency        float64   `json:"probe_latency"` // seconds
+    LastProbeTime       time.Time `json:"last_probe_time"`
+    // Quality over the rolling window
+    QualityScore        float64   `json:"quality_score"`   // 0-1
+    PostDialDelay       float64   `json:"post_dial_delay"` // seconds
 }
 
 // CallResponse for API/AGI
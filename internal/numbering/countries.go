@@ -0,0 +1,165 @@
+package numbering
+
+import (
+    "strings"
+)
+
+// country is one entry of the calling code table. Countries that share a
+// calling code list the national prefixes that set them apart; the first
+// entry of a shared code without prefixes owns the rest of it.
+type country struct {
+    iso      string
+    code     string
+    prefixes []string
+}
+
+var countries = []country{
+    // North American Numbering Plan
+    {"US", "1", nil},
+    {"CA", "1", []string{"204", "226", "236", "249", "250", "263", "289", "306", "343", "354", "365", "367",
+        "368", "382", "387", "403", "416", "418", "428", "431", "437", "438", "450", "460", "468", "474",
+        "506", "514", "519", "548", "579", "581", "584", "587", "604", "613", "639", "647", "672", "683",
+        "705", "709", "742", "753", "778", "780", "782", "807", "819", "825", "867", "873", "879", "902",
+        "905", "942"}},
+    {"BS", "1", []string{"242"}},
+    {"BB", "1", []string{"246"}},
+    {"AI", "1", []string{"264"}},
+    {"AG", "1", []string{"268"}},
+    {"VG", "1", []string{"284"}},
+    {"VI", "1", []string{"340"}},
+    {"KY", "1", []string{"345"}},
+    {"BM", "1", []string{"441"}},
+    {"GD", "1", []string{"473"}},
+    {"TC", "1", []string{"649"}},
+    {"JM", "1", []string{"658", "876"}},
+    {"MS", "1", []string{"664"}},
+    {"MP", "1", []string{"670"}},
+    {"GU", "1", []string{"671"}},
+    {"AS", "1", []string{"684"}},
+    {"SX", "1", []string{"721"}},
+    {"LC", "1", []string{"758"}},
+    {"DM", "1", []string{"767"}},
+    {"VC", "1", []string{"784"}},
+    {"PR", "1", []string{"787", "939"}},
+    {"DO", "1", []string{"809", "829", "849"}},
+    {"TT", "1", []string{"868"}},
+    {"KN", "1", []string{"869"}},
+    
+    // Zone 2
+    {"EG", "20", nil}, {"SS", "211", nil}, {"MA", "212", nil}, {"DZ", "213", nil}, {"TN", "216", nil},
+    {"LY", "218", nil}, {"GM", "220", nil}, {"SN", "221", nil}, {"MR", "222", nil}, {"ML", "223", nil},
+    {"GN", "224", nil}, {"CI", "225", nil}, {"BF", "226", nil}, {"NE", "227", nil}, {"TG", "228", nil},
+    {"BJ", "229", nil}, {"MU", "230", nil}, {"LR", "231", nil}, {"SL", "232", nil}, {"GH", "233", nil},
+    {"NG", "234", nil}, {"TD", "235", nil}, {"CF", "236", nil}, {"CM", "237", nil}, {"CV", "238", nil},
+    {"ST", "239", nil}, {"GQ", "240", nil}, {"GA", "241", nil}, {"CG", "242", nil}, {"CD", "243", nil},
+    {"AO", "244", nil}, {"GW", "245", nil}, {"IO", "246", nil}, {"SC", "248", nil}, {"SD", "249", nil},
+    {"RW", "250", nil}, {"ET", "251", nil}, {"SO", "252", nil}, {"DJ", "253", nil}, {"KE", "254", nil},
+    {"TZ", "255", nil}, {"UG", "256", nil}, {"BI", "257", nil}, {"MZ", "258", nil}, {"ZM", "260", nil},
+    {"MG", "261", nil}, {"RE", "262", nil}, {"ZW", "263", nil}, {"NA", "264", nil}, {"MW", "265", nil},
+    {"LS", "266", nil}, {"BW", "267", nil}, {"SZ", "268", nil}, {"KM", "269", nil}, {"ZA", "27", nil},
+    {"SH", "290", nil}, {"ER", "291", nil}, {"AW", "297", nil}, {"FO", "298", nil}, {"GL", "299", nil},
+    
+    // Zones 3 and 4, Europe
+    {"GR", "30", nil}, {"NL", "31", nil}, {"BE", "32", nil}, {"FR", "33", nil}, {"ES", "34", nil},
+    {"GI", "350", nil}, {"PT", "351", nil}, {"LU", "352", nil}, {"IE", "353", nil}, {"IS", "354", nil},
+    {"AL", "355", nil}, {"MT", "356", nil}, {"CY", "357", nil}, {"FI", "358", nil}, {"BG", "359", nil},
+    {"HU", "36", nil}, {"LT", "370", nil}, {"LV", "371", nil}, {"EE", "372", nil}, {"MD", "373", nil},
+    {"AM", "374", nil}, {"BY", "375", nil}, {"AD", "376", nil}, {"MC", "377", nil}, {"SM", "378", nil},
+    {"UA", "380", nil}, {"RS", "381", nil}, {"ME", "382", nil}, {"XK", "383", nil}, {"HR", "385", nil},
+    {"SI", "386", nil}, {"BA", "387", nil}, {"MK", "389", nil}, {"IT", "39", nil}, {"VA", "379", nil},
+    {"RO", "40", nil}, {"CH", "41", nil}, {"CZ", "420", nil}, {"SK", "421", nil}, {"LI", "423", nil},
+    {"AT", "43", nil}, {"GB", "44", nil}, {"DK", "45", nil}, {"SE", "46", nil}, {"NO", "47", nil},
+    {"PL", "48", nil}, {"DE", "49", nil},
+    
+    // Zone 5, Central and South America
+    {"FK", "500", nil}, {"BZ", "501", nil}, {"GT", "502", nil}, {"SV", "503", nil}, {"HN", "504", nil},
+    {"NI", "505", nil}, {"CR", "506", nil}, {"PA", "507", nil}, {"PM", "508", nil}, {"HT", "509", nil},
+    {"PE", "51", nil}, {"MX", "52", nil}, {"CU", "53", nil}, {"AR", "54", nil}, {"BR", "55", nil},
+    {"CL", "56", nil}, {"CO", "57", nil}, {"VE", "58", nil}, {"GP", "590", nil}, {"BO", "591", nil},
+    {"GY", "592", nil}, {"EC", "593", nil}, {"GF", "594", nil}, {"PY", "595", nil}, {"MQ", "596", nil},
+    {"SR", "597", nil}, {"UY", "598", nil}, {"CW", "599", nil},
+    
+    // Zone 6, Southeast Asia and Oceania
+    {"MY", "60", nil}, {"AU", "61", nil}, {"ID", "62", nil}, {"PH", "63", nil}, {"NZ", "64", nil},
+    {"SG", "65", nil}, {"TH", "66", nil}, {"TL", "670", nil}, {"NF", "672", nil}, {"BN", "673", nil},
+    {"NR", "674", nil}, {"PG", "675", nil}, {"TO", "676", nil}, {"SB", "677", nil}, {"VU", "678", nil},
+    {"FJ", "679", nil}, {"PW", "680", nil}, {"WF", "681", nil}, {"CK", "682", nil}, {"NU", "683", nil},
+    {"WS", "685", nil}, {"KI", "686", nil}, {"NC", "687", nil}, {"TV", "688", nil}, {"PF", "689", nil},
+    {"TK", "690", nil}, {"FM", "691", nil}, {"MH", "692", nil},
+    
+    // Zone 7
+    {"RU", "7", nil},
+    {"KZ", "7", []string{"6", "7"}},
+    
+    // Zone 8, East Asia
+    {"JP", "81", nil}, {"KR", "82", nil}, {"VN", "84", nil}, {"KP", "850", nil}, {"HK", "852", nil},
+    {"MO", "853", nil}, {"KH", "855", nil}, {"LA", "856", nil}, {"CN", "86", nil}, {"BD", "880", nil},
+    {"TW", "886", nil},
+    
+    // Zone 9, West, Central and South Asia
+    {"TR", "90", nil}, {"IN", "91", nil}, {"PK", "92", nil}, {"AF", "93", nil}, {"LK", "94", nil},
+    {"MM", "95", nil}, {"MV", "960", nil}, {"LB", "961", nil}, {"JO", "962", nil}, {"SY", "963", nil},
+    {"IQ", "964", nil}, {"KW", "965", nil}, {"SA", "966", nil}, {"YE", "967", nil}, {"OM", "968", nil},
+    {"PS", "970", nil}, {"AE", "971", nil}, {"IL", "972", nil}, {"BH", "973", nil}, {"QA", "974", nil},
+    {"BT", "975", nil}, {"MN", "976", nil}, {"NP", "977", nil}, {"IR", "98", nil}, {"TJ", "992", nil},
+    {"TM", "993", nil}, {"AZ", "994", nil}, {"GE", "995", nil}, {"KG", "996", nil}, {"UZ", "998", nil},
+}
+
+var (
+    // byPrefix maps a calling code, or calling code plus national prefix,
+    // to the country it belongs to
+    byPrefix = make(map[string]string)
+    // callingCodes maps a country to its calling code
+    callingCodes = make(map[string]string)
+    // maxPrefix is the length of the longest key of byPrefix
+    maxPrefix int
+)
+
+func init() {
+    for _, c := range countries {
+        callingCodes[c.iso] = c.code
+        
+        keys := []string{c.code}
+        if len(c.prefixes) > 0 {
+            keys = keys[:0]
+            for _, p := range c.prefixes {
+                keys = append(keys, c.code+p)
+            }
+        }
+        for _, key := range keys {
+            if _, taken := byPrefix[key]; taken {
+                continue
+            }
+            byPrefix[key] = c.iso
+            if len(key) > maxPrefix {
+                maxPrefix = len(key)
+            }
+        }
+    }
+}
+
+// Country returns the ISO 3166 code of the country an international number
+// (with or without a leading +) belongs to, or "" if it is not known.
+// Countries sharing a calling code are told apart by their national prefix
+// where the table has one, e.g. Canadian area codes within +1.
+func Country(number string) string {
+    number = strings.TrimPrefix(number, "+")
+    
+    n := maxPrefix
+    if len(number) < n {
+        n = len(number)
+    }
+    for ; n > 0; n-- {
+        if iso, ok := byPrefix[number[:n]]; ok {
+            return iso
+        }
+    }
+    return ""
+}
+
+// CallingCode returns the calling code of a country given by its ISO 3166
+// code, e.g. "44" for "GB"
+func CallingCode(iso string) (string, bool) {
+    code, ok := callingCodes[strings.ToUpper(iso)]
+    return code, ok
+}
@@ -0,0 +1,47 @@
+package numbering
+
+import (
+    "strings"
+)
+
+// keepZero lists the countries whose numbers keep their leading 0 in
+// international form
+var keepZero = map[string]bool{"IT": true, "SM": true, "VA": true}
+
+// E164 puts a number as dialled in a country into international form, as
+// digits without the leading +. Numbers starting with + or the country's
+// international access code (00, or 011 within +1) are international
+// already. A national number has its trunk prefix 0 replaced by the calling
+// code, or kept after it where the country dials it internationally too;
+// within +1 ten-digit numbers get the 1 added. Anything else is assumed to
+// be international and only loses a leading +.
+func E164(number, iso string) string {
+    if strings.HasPrefix(number, "+") {
+        return number[1:]
+    }
+    
+    code, ok := CallingCode(iso)
+    if !ok {
+        return number
+    }
+    
+    if code == "1" {
+        switch {
+        case strings.HasPrefix(number, "011"):
+            return number[3:]
+        case len(number) == 10:
+            return code + number
+        }
+        return number
+    }
+    
+    switch {
+    case strings.HasPrefix(number, "00"):
+        return number[2:]
+    case strings.HasPrefix(number, "0") && !keepZero[strings.ToUpper(iso)]:
+        return code + number[1:]
+    case strings.HasPrefix(number, "0"):
+        return code + number
+    }
+    return number
+}
@@ -0,0 +1,75 @@
+package numbering
+
+import (
+    "testing"
+)
+
+func TestE164(t *testing.T) {
+    tests := []struct {
+        number, iso string
+        want        string
+    }{
+        {"+442071234567", "US", "442071234567"},
+        {"+12125551234", "", "12125551234"},
+        
+        // North American Numbering Plan
+        {"2125551234", "US", "12125551234"},
+        {"12125551234", "US", "12125551234"},
+        {"011442071234567", "US", "442071234567"},
+        {"4165551234", "CA", "14165551234"},
+        {"5551234", "US", "5551234"},
+        
+        // International access code and trunk prefix
+        {"00442071234567", "GB", "442071234567"},
+        {"02071234567", "GB", "442071234567"},
+        {"442071234567", "GB", "442071234567"},
+        {"0612345678", "fr", "33612345678"},
+        {"0049301234567", "DE", "49301234567"},
+        
+        // Italy keeps the 0 after the calling code
+        {"0612345678", "IT", "390612345678"},
+        {"0039061234567", "IT", "39061234567"},
+        
+        // Unknown countries leave the number alone
+        {"02071234567", "ZZ", "02071234567"},
+        {"02071234567", "", "02071234567"},
+        {"", "GB", ""},
+    }
+    
+    for _, tt := range tests {
+        if got := E164(tt.number, tt.iso); got != tt.want {
+            t.Errorf("E164(%q, %q) = %q, want %q", tt.number, tt.iso, got, tt.want)
+        }
+    }
+}
+
+func TestCountry(t *testing.T) {
+    tests := []struct {
+        number, want string
+    }{
+        {"12125551234", "US"},
+        {"+14165551234", "CA"},
+        {"18765551234", "JM"},
+        {"442071234567", "GB"},
+        {"35312345678", "IE"},
+        {"77011234567", "KZ"},
+        {"74951234567", "RU"},
+        {"999", ""},
+        {"", ""},
+    }
+    
+    for _, tt := range tests {
+        if got := Country(tt.number); got != tt.want {
+            t.Errorf("Country(%q) = %q, want %q", tt.number, got, tt.want)
+        }
+    }
+}
+
+func TestCallingCode(t *testing.T) {
+    if code, ok := CallingCode("gb"); !ok || code != "44" {
+        t.Errorf("CallingCode(gb) = %q, %v; want 44, true", code, ok)
+    }
+    if _, ok := CallingCode("ZZ"); ok {
+        t.Error("CallingCode(ZZ) found a code")
+    }
+}
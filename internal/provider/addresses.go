@@ -0,0 +1,139 @@
+package provider
+
+import (
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// How long the addresses of a provider hostname are cached, and how long a
+// hostname that failed to resolve is left alone
+const (
+    hostCacheTTL   = 5 * time.Minute
+    hostRetryDelay = 30 * time.Second
+)
+
+// SourceAddresses returns the addresses, CIDRs and hostnames calls from a
+// provider may come from: its allowed list, or its host if that is empty
+func SourceAddresses(p *models.Provider) []string {
+    if len(p.AllowedIPs) > 0 {
+        return p.AllowedIPs
+    }
+    return []string{p.Host}
+}
+
+// ParseAllowedAddress checks one entry of a provider's allowed list and
+// returns it in canonical form: an IP address, a CIDR or a hostname
+func ParseAllowedAddress(entry string) (string, error) {
+    entry = strings.TrimSpace(entry)
+    if ip := net.ParseIP(entry); ip != nil {
+        return ip.String(), nil
+    }
+    if _, network, err := net.ParseCIDR(entry); err == nil {
+        return network.String(), nil
+    }
+    if isHostname(entry) {
+        return strings.ToLower(strings.TrimSuffix(entry, ".")), nil
+    }
+    return "", fmt.Errorf("%w: %q is not an IP address, CIDR or hostname", ErrInvalid, entry)
+}
+
+// isHostname reports whether s is a syntactically valid DNS name
+func isHostname(s string) bool {
+    s = strings.TrimSuffix(s, ".")
+    if s == "" || len(s) > 253 {
+        return false
+    }
+    for _, label := range strings.Split(s, ".") {
+        if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+            return false
+        }
+        for _, c := range label {
+            if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+                return false
+            }
+        }
+    }
+    // All-numeric names are malformed addresses, not hostnames
+    return strings.Trim(s, "0123456789.") != ""
+}
+
+// SourceAllowed reports whether a call from ip may come from provider p:
+// ip must be one of its addresses, lie in one of its CIDRs or be an address
+// one of its hostnames resolves to
+func (m *Manager) SourceAllowed(p *models.Provider, ip net.IP) bool {
+    for _, entry := range SourceAddresses(p) {
+        if allowed := net.ParseIP(entry); allowed != nil {
+            if allowed.Equal(ip) {
+                return true
+            }
+            continue
+        }
+        if _, network, err := net.ParseCIDR(entry); err == nil {
+            if network.Contains(ip) {
+                return true
+            }
+            continue
+        }
+        for _, resolved := range m.hosts.lookup(entry) {
+            if resolved.Equal(ip) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// hostCache keeps the addresses provider hostnames resolve to, so that
+// verifying a call does not wait on DNS every time
+type hostCache struct {
+    mu      sync.Mutex
+    entries map[string]*hostEntry
+    resolve func(host string) ([]net.IP, error)
+}
+
+type hostEntry struct {
+    ips     []net.IP
+    expires time.Time
+}
+
+func newHostCache() *hostCache {
+    return &hostCache{entries: make(map[string]*hostEntry), resolve: net.LookupIP}
+}
+
+// lookup returns the addresses of host, resolving it again once the cached
+// ones expire. If resolving fails the last known addresses stay in use.
+func (c *hostCache) lookup(host string) []net.IP {
+    now := time.Now()
+    
+    c.mu.Lock()
+    cached, ok := c.entries[host]
+    c.mu.Unlock()
+    if ok && now.Before(cached.expires) {
+        return cached.ips
+    }
+    
+    ips, err := c.resolve(host)
+    if err != nil {
+        log.Warnf("Failed to resolve provider host %s: %v", host, err)
+        var stale []net.IP
+        if ok {
+            stale = cached.ips
+        }
+        c.store(host, &hostEntry{ips: stale, expires: now.Add(hostRetryDelay)})
+        return stale
+    }
+    
+    c.store(host, &hostEntry{ips: ips, expires: now.Add(hostCacheTTL)})
+    return ips
+}
+
+func (c *hostCache) store(host string, entry *hostEntry) {
+    c.mu.Lock()
+    c.entries[host] = entry
+    c.mu.Unlock()
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+    "errors"
+    "net"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestParseAllowedAddress(t *testing.T) {
+    tests := []struct {
+        entry string
+        want  string // "" for ErrInvalid
+    }{
+        {"192.0.2.1", "192.0.2.1"},
+        {" 2001:DB8::1 ", "2001:db8::1"},
+        {"192.0.2.7/24", "192.0.2.0/24"},
+        {"192.0.2.1/32", "192.0.2.1/32"},
+        {"0.0.0.0/0", "0.0.0.0/0"},
+        {"2001:db8::1/128", "2001:db8::1/128"},
+        {"2001:db8::/32", "2001:db8::/32"},
+        {"SIP.Example.com.", "sip.example.com"},
+        {"sip-1.example.com", "sip-1.example.com"},
+        
+        {"10.0.0.0/33", ""},
+        {"2001:db8::/129", ""},
+        {"192.0.2.1:5060", ""},
+        {"[2001:db8::1]:5060", ""},
+        {"host:port:extra", ""},
+        {"192.0.2.256", ""},
+        {"-sip.example.com", ""},
+        {"sip..example.com", ""},
+        {"sip_1.example.com", ""},
+        {"", ""},
+    }
+    
+    for _, tt := range tests {
+        got, err := ParseAllowedAddress(tt.entry)
+        if tt.want == "" {
+            if !errors.Is(err, ErrInvalid) {
+                t.Errorf("ParseAllowedAddress(%q) = %q, %v; want ErrInvalid", tt.entry, got, err)
+            }
+            continue
+        }
+        if err != nil || got != tt.want {
+            t.Errorf("ParseAllowedAddress(%q) = %q, %v; want %q", tt.entry, got, err, tt.want)
+        }
+    }
+}
+
+// fakeResolver answers lookups from a fixed table and counts them
+type fakeResolver struct {
+    hosts   map[string][]net.IP
+    lookups int
+}
+
+func (f *fakeResolver) resolve(host string) ([]net.IP, error) {
+    f.lookups++
+    if ips, ok := f.hosts[host]; ok {
+        return ips, nil
+    }
+    return nil, errors.New("no such host")
+}
+
+func TestSourceAllowed(t *testing.T) {
+    m := NewManager()
+    resolver := &fakeResolver{hosts: map[string][]net.IP{
+        "sip.example.com": {net.ParseIP("203.0.113.5"), net.ParseIP("2001:db8:1::5")},
+    }}
+    m.hosts.resolve = resolver.resolve
+    
+    allowed := &models.Provider{Host: "192.0.2.99", AllowedIPs: []string{
+        "192.0.2.1", "198.51.100.0/24", "2001:db8::/126", "sip.example.com", "gone.example.com",
+    }}
+    byHost := &models.Provider{Host: "192.0.2.99"}
+    
+    tests := []struct {
+        provider *models.Provider
+        ip       string
+        want     bool
+    }{
+        {allowed, "192.0.2.1", true},
+        {allowed, "::ffff:192.0.2.1", true},
+        {allowed, "192.0.2.2", false},
+        
+        // CIDR edges
+        {allowed, "198.51.100.0", true},
+        {allowed, "198.51.100.255", true},
+        {allowed, "198.51.99.255", false},
+        {allowed, "198.51.101.0", false},
+        {allowed, "2001:db8::3", true},
+        {allowed, "2001:db8::4", false},
+        
+        // Addresses of a hostname
+        {allowed, "203.0.113.5", true},
+        {allowed, "2001:db8:1::5", true},
+        {allowed, "203.0.113.6", false},
+        
+        // The host only counts without an allowed list
+        {allowed, "192.0.2.99", false},
+        {byHost, "192.0.2.99", true},
+        {byHost, "192.0.2.1", false},
+    }
+    
+    for _, tt := range tests {
+        if got := m.SourceAllowed(tt.provider, net.ParseIP(tt.ip)); got != tt.want {
+            t.Errorf("SourceAllowed(%v, %s) = %v, want %v", tt.provider.AllowedIPs, tt.ip, got, tt.want)
+        }
+    }
+    
+    // Each hostname was resolved once and then served from the cache
+    if resolver.lookups != 2 {
+        t.Errorf("%d lookups, want 2", resolver.lookups)
+    }
+}
+
+func TestHostCache(t *testing.T) {
+    resolver := &fakeResolver{hosts: map[string][]net.IP{"sip.example.com": {net.ParseIP("203.0.113.5")}}}
+    c := newHostCache()
+    c.resolve = resolver.resolve
+    
+    if ips := c.lookup("sip.example.com"); len(ips) != 1 || !ips[0].Equal(net.ParseIP("203.0.113.5")) {
+        t.Fatalf("resolved to %v, want 203.0.113.5", ips)
+    }
+    c.lookup("sip.example.com")
+    if resolver.lookups != 1 {
+        t.Errorf("%d lookups before the entry expired, want 1", resolver.lookups)
+    }
+    
+    // Once expired the host is resolved again; if that fails the last
+    // addresses stay in use until the retry delay has passed
+    c.entries["sip.example.com"].expires = time.Now().Add(-time.Second)
+    delete(resolver.hosts, "sip.example.com")
+    if ips := c.lookup("sip.example.com"); len(ips) != 1 || !ips[0].Equal(net.ParseIP("203.0.113.5")) {
+        t.Errorf("failed lookup returned %v, want the cached 203.0.113.5", ips)
+    }
+    c.lookup("sip.example.com")
+    if resolver.lookups != 2 {
+        t.Errorf("%d lookups, want 2: a failed lookup is retried after %v", resolver.lookups, hostRetryDelay)
+    }
+    if expires := c.entries["sip.example.com"].expires; expires.After(time.Now().Add(hostRetryDelay)) {
+        t.Errorf("failed lookup cached until %v, want at most %v", expires, hostRetryDelay)
+    }
+    
+    // A host that never resolved has no addresses
+    if ips := c.lookup("gone.example.com"); len(ips) != 0 {
+        t.Errorf("unresolvable host returned %v", ips)
+    }
+}
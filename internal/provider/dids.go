@@ -0,0 +1,120 @@
+package provider
+
+import (
+    "database/sql"
+    "fmt"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// DIDFilter narrows ListDIDs results. Zero values mean "no filter".
+type DIDFilter struct {
+    ProviderName string
+    InUse        *bool
+    Limit        int
+}
+
+// AddDID adds a DID to the pool of an existing provider, or updates it if
+// the number is already known
+func (m *Manager) AddDID(did *models.DID) error {
+    if did.Number == "" {
+        return fmt.Errorf("%w: DID number is required", ErrInvalid)
+    }
+    
+    if _, err := m.GetProvider(did.ProviderName); err != nil {
+        return fmt.Errorf("%w: provider %s not found", ErrInvalid, did.ProviderName)
+    }
+    
+    query := `
+        INSERT INTO dids (number, provider_name, country, city, in_use, created_at, updated_at)
+        VALUES (?, ?, ?, ?, 0, NOW(), NOW())
+        ON DUPLICATE KEY UPDATE
+            provider_name = VALUES(provider_name),
+            country = VALUES(country),
+            city = VALUES(city),
+            updated_at = NOW()`
+    
+    if _, err := db.DB.Exec(query, did.Number, did.ProviderName, did.Country, did.City); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    log.Infof("DID %s added for provider %s", did.Number, did.ProviderName)
+    return nil
+}
+
+// ListDIDs returns DIDs ordered by provider and number
+func (m *Manager) ListDIDs(filter DIDFilter) ([]*models.DID, error) {
+    query := `
+        SELECT id, number, provider_name, in_use, destination, country, city, created_at, updated_at
+        FROM dids WHERE 1=1`
+    args := []interface{}{}
+    
+    if filter.ProviderName != "" {
+        query += " AND provider_name = ?"
+        args = append(args, filter.ProviderName)
+    }
+    
+    if filter.InUse != nil {
+        query += " AND in_use = ?"
+        args = append(args, *filter.InUse)
+    }
+    
+    query += " ORDER BY provider_name, number"
+    
+    if filter.Limit > 0 {
+        query += " LIMIT ?"
+        args = append(args, filter.Limit)
+    }
+    
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var dids []*models.DID
+    for rows.Next() {
+        did := &models.DID{}
+        var providerName, destination, country, city sql.NullString
+        
+        err := rows.Scan(&did.ID, &did.Number, &providerName, &did.InUse, &destination,
+            &country, &city, &did.CreatedAt, &did.UpdatedAt)
+        if err != nil {
+            return nil, err
+        }
+        
+        did.ProviderName = providerName.String
+        did.Destination = destination.String
+        did.Country = country.String
+        did.City = city.String
+        dids = append(dids, did)
+    }
+    
+    return dids, rows.Err()
+}
+
+// DeleteDID removes a DID that is not currently assigned to a call
+func (m *Manager) DeleteDID(number string) error {
+    var inUse bool
+    err := db.DB.QueryRow("SELECT in_use FROM dids WHERE number = ?", number).Scan(&inUse)
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("DID %s %w", number, ErrNotFound)
+    }
+    if err != nil {
+        return err
+    }
+    
+    if inUse {
+        return fmt.Errorf("%w: DID %s is currently in use", ErrConflict, number)
+    }
+    
+    if _, err := db.DB.Exec("DELETE FROM dids WHERE number = ? AND in_use = 0", number); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    log.Infof("DID %s deleted", number)
+    return nil
+}
@@ -0,0 +1,13 @@
+package provider
+
+import (
+    "errors"
+)
+
+// Error classes returned by the manager. They are wrapped with context, so
+// check them with errors.Is.
+var (
+    ErrNotFound = errors.New("not found")
+    ErrInvalid  = errors.New("invalid request")
+    ErrConflict = errors.New("conflict")
+)
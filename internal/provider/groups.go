@@ -0,0 +1,315 @@
+package provider
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// AddGroup creates a provider group, or updates the description of an
+// existing one. When group.Members is not nil it replaces the membership.
+func (m *Manager) AddGroup(group *models.ProviderGroup) error {
+    if group.Name == "" {
+        return fmt.Errorf("%w: group name is required", ErrInvalid)
+    }
+    
+    m.mu.RLock()
+    _, clash := m.providers[group.Name]
+    m.mu.RUnlock()
+    if clash {
+        return fmt.Errorf("%w: a provider is already named %s", ErrConflict, group.Name)
+    }
+    
+    for _, member := range group.Members {
+        if err := m.checkMember(member); err != nil {
+            return err
+        }
+    }
+    
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    _, err = tx.Exec(`
+        INSERT INTO provider_groups (name, description)
+        VALUES (?, ?)
+        ON DUPLICATE KEY UPDATE description = VALUES(description)`,
+        group.Name, group.Description)
+    if err != nil {
+        return err
+    }
+    
+    if group.Members != nil {
+        if _, err := tx.Exec("DELETE FROM provider_group_members WHERE group_name = ?", group.Name); err != nil {
+            return err
+        }
+        for _, member := range group.Members {
+            if err := storeMember(tx, group.Name, member); err != nil {
+                return err
+            }
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadGroups(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Provider group %s saved", group.Name)
+    return nil
+}
+
+// DeleteGroup removes a provider group that no route uses
+func (m *Manager) DeleteGroup(name string) error {
+    var count int
+    db.DB.QueryRow("SELECT COUNT(*) FROM provider_routes WHERE intermediate_provider = ? OR final_provider = ?",
+        name, name).Scan(&count)
+    if count > 0 {
+        return fmt.Errorf("%w: group %s is used in %d routes", ErrConflict, name, count)
+    }
+    
+    result, err := db.DB.Exec("DELETE FROM provider_groups WHERE name = ?", name)
+    if err != nil {
+        return err
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("group %s %w", name, ErrNotFound)
+    }
+    
+    if _, err := db.DB.Exec("DELETE FROM provider_group_members WHERE group_name = ?", name); err != nil {
+        return err
+    }
+    
+    m.mu.Lock()
+    delete(m.groups, name)
+    delete(m.groupPools, name)
+    m.mu.Unlock()
+    
+    bumpConfigVersion()
+    
+    log.Infof("Provider group %s deleted", name)
+    return nil
+}
+
+// ListGroups returns every provider group ordered by name
+func (m *Manager) ListGroups() []*models.ProviderGroup {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    
+    groups := make([]*models.ProviderGroup, 0, len(m.groups))
+    for _, group := range m.groups {
+        groups = append(groups, group)
+    }
+    sort.Slice(groups, func(i, j int) bool {
+        return groups[i].Name < groups[j].Name
+    })
+    return groups
+}
+
+// GetGroup returns a provider group
+func (m *Manager) GetGroup(name string) (*models.ProviderGroup, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    
+    group, exists := m.groups[name]
+    if !exists {
+        return nil, fmt.Errorf("group %s %w", name, ErrNotFound)
+    }
+    return group, nil
+}
+
+// AddGroupMember adds a provider to a group, or updates its overrides if it
+// is already a member
+func (m *Manager) AddGroupMember(groupName string, member models.GroupMember) error {
+    if _, err := m.GetGroup(groupName); err != nil {
+        return err
+    }
+    if err := m.checkMember(member); err != nil {
+        return err
+    }
+    
+    if err := storeMember(db.DB, groupName, member); err != nil {
+        return err
+    }
+    
+    if err := m.LoadGroups(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Provider %s added to group %s", member.ProviderName, groupName)
+    return nil
+}
+
+// RemoveGroupMember takes a provider out of a group
+func (m *Manager) RemoveGroupMember(groupName, providerName string) error {
+    result, err := db.DB.Exec("DELETE FROM provider_group_members WHERE group_name = ? AND provider_name = ?",
+        groupName, providerName)
+    if err != nil {
+        return err
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("provider %s in group %s %w", providerName, groupName, ErrNotFound)
+    }
+    
+    if err := m.LoadGroups(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Provider %s removed from group %s", providerName, groupName)
+    return nil
+}
+
+// LoadGroups reads every provider group and its members into memory
+func (m *Manager) LoadGroups() error {
+    rows, err := db.DB.Query(`
+        SELECT id, name, description, created_at
+        FROM provider_groups`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    
+    groups := make(map[string]*models.ProviderGroup)
+    for rows.Next() {
+        group := &models.ProviderGroup{Members: []models.GroupMember{}}
+        if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.CreatedAt); err != nil {
+            log.Errorf("Error loading provider group: %v", err)
+            continue
+        }
+        groups[group.Name] = group
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    memberRows, err := db.DB.Query(`
+        SELECT group_name, provider_name, weight, priority
+        FROM provider_group_members
+        ORDER BY group_name, provider_name`)
+    if err != nil {
+        return err
+    }
+    defer memberRows.Close()
+    
+    for memberRows.Next() {
+        var groupName string
+        var weight, priority sql.NullInt64
+        member := models.GroupMember{}
+        if err := memberRows.Scan(&groupName, &member.ProviderName, &weight, &priority); err != nil {
+            log.Errorf("Error loading provider group member: %v", err)
+            continue
+        }
+        if weight.Valid {
+            w := int(weight.Int64)
+            member.Weight = &w
+        }
+        if priority.Valid {
+            p := int(priority.Int64)
+            member.Priority = &p
+        }
+        if group, exists := groups[groupName]; exists {
+            group.Members = append(group.Members, member)
+        }
+    }
+    if err := memberRows.Err(); err != nil {
+        return err
+    }
+    
+    m.mu.Lock()
+    m.groups = groups
+    m.buildGroupPools()
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d provider groups", len(groups))
+    return nil
+}
+
+// buildGroupPools works out the provider pool of every group: its members
+// with the group's weight and priority overrides applied. Members that are
+// not loaded, such as inactive providers, are left out. The pools are built
+// once per change of the providers or groups, so a group hands out the same
+// providers on every call. Caller must hold m.mu for writing.
+func (m *Manager) buildGroupPools() {
+    pools := make(map[string][]*models.Provider, len(m.groups))
+    for name, group := range m.groups {
+        pools[name] = m.groupPool(group)
+    }
+    m.groupPools = pools
+}
+
+// groupPool returns the providers of a group with its overrides applied.
+// Caller must hold m.mu.
+func (m *Manager) groupPool(group *models.ProviderGroup) []*models.Provider {
+    var pool []*models.Provider
+    for _, member := range group.Members {
+        p, exists := m.providers[member.ProviderName]
+        if !exists {
+            continue
+        }
+        if member.Weight != nil || member.Priority != nil {
+            override := *p
+            if member.Weight != nil {
+                override.Weight = *member.Weight
+            }
+            if member.Priority != nil {
+                override.Priority = *member.Priority
+            }
+            p = &override
+        }
+        pool = append(pool, p)
+    }
+    return pool
+}
+
+// checkMember validates a group member
+func (m *Manager) checkMember(member models.GroupMember) error {
+    if _, err := m.GetProvider(member.ProviderName); err != nil {
+        return fmt.Errorf("%w: provider %s not found", ErrInvalid, member.ProviderName)
+    }
+    if member.Weight != nil && *member.Weight <= 0 {
+        return fmt.Errorf("%w: member weight must be positive", ErrInvalid)
+    }
+    return nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// storeMember inserts or updates a group member
+func storeMember(ex execer, groupName string, member models.GroupMember) error {
+    var weight, priority sql.NullInt64
+    if member.Weight != nil {
+        weight = sql.NullInt64{Int64: int64(*member.Weight), Valid: true}
+    }
+    if member.Priority != nil {
+        priority = sql.NullInt64{Int64: int64(*member.Priority), Valid: true}
+    }
+    
+    _, err := ex.Exec(`
+        INSERT INTO provider_group_members (group_name, provider_name, weight, priority)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            weight = VALUES(weight),
+            priority = VALUES(priority)`,
+        groupName, member.ProviderName, weight, priority)
+    if err != nil {
+        return fmt.Errorf("failed to store member %s: %v", member.ProviderName, err)
+    }
+    return nil
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestGroupPool(t *testing.T) {
+    weight, priority := 5, 9
+    m := NewManager()
+    m.providers = map[string]*models.Provider{
+        "a": {Name: "a", Active: true, Weight: 1, Priority: 1},
+        "b": {Name: "b", Active: true, Weight: 1, Priority: 1},
+    }
+    m.groups = map[string]*models.ProviderGroup{
+        "carriers": {Name: "carriers", Members: []models.GroupMember{
+            {ProviderName: "a", Weight: &weight, Priority: &priority},
+            {ProviderName: "b"},
+            {ProviderName: "gone"},
+        }},
+    }
+    m.buildGroupPools()
+    
+    pool, err := m.GetProvidersByName("carriers")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(pool) != 2 || pool[0].Name != "a" || pool[1].Name != "b" {
+        t.Fatalf("got pool %v, want a and b", pool)
+    }
+    if pool[0].Weight != 5 || pool[0].Priority != 9 {
+        t.Errorf("override weight %d, priority %d; want 5, 9", pool[0].Weight, pool[0].Priority)
+    }
+    if m.providers["a"].Weight != 1 {
+        t.Error("override changed the provider itself")
+    }
+    if pool[1] != m.providers["b"] {
+        t.Error("member without overrides is not the provider itself")
+    }
+    
+    again, _ := m.GetProvidersByName("carriers")
+    if again[0] != pool[0] {
+        t.Error("override copy made again on a second lookup")
+    }
+}
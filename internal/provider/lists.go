@@ -0,0 +1,425 @@
+package provider
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "strings"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Number lists and the call fields they apply to
+const (
+    ListBlock = "block"
+    ListAllow = "allow"
+    
+    FieldANI  = "ani"
+    FieldDNIS = "dnis"
+)
+
+// listScope is the inbound provider and route a list entry is limited to,
+// empty for all of them
+type listScope struct {
+    provider, route string
+}
+
+// numberSet holds the entries of one scope and field by number. When the
+// same number is on both lists the block entry is kept.
+type numberSet struct {
+    exact    map[string]*models.ListEntry
+    prefixes map[string]*models.ListEntry
+    allows   int // allow entries, which turn the field into an allowlist
+}
+
+func newNumberSet() *numberSet {
+    return &numberSet{
+        exact:    make(map[string]*models.ListEntry),
+        prefixes: make(map[string]*models.ListEntry),
+    }
+}
+
+func (s *numberSet) add(entry *models.ListEntry) {
+    entries := s.exact
+    if entry.Prefix {
+        entries = s.prefixes
+    }
+    if existing, ok := entries[entry.Number]; !ok || existing.List == ListAllow {
+        entries[entry.Number] = entry
+    }
+    if entry.List == ListAllow {
+        s.allows++
+    }
+}
+
+// lookup returns the most specific entry for number: an exact entry, else
+// the one with the longest prefix. The rank grows with how specific it is.
+func (s *numberSet) lookup(number string) (*models.ListEntry, int) {
+    if entry, ok := s.exact[number]; ok {
+        return entry, len(number) + 1
+    }
+    for n := len(number); n > 0; n-- {
+        if entry, ok := s.prefixes[number[:n]]; ok {
+            return entry, n
+        }
+    }
+    return nil, 0
+}
+
+// numberLists is the compiled number_lists table
+type numberLists map[listScope]map[string]*numberSet
+
+// ListRefusal says why the number lists refuse a call
+type ListRefusal struct {
+    Field  string
+    Number string
+    // Entry is the blocklist entry the number matched, nil when the number
+    // is missing from an allowlist
+    Entry *models.ListEntry
+}
+
+// Rule names the list that refused the call
+func (r *ListRefusal) Rule() string {
+    if r.Entry == nil {
+        return "allowlist"
+    }
+    return "blocklist"
+}
+
+func (r *ListRefusal) Reason() string {
+    if r.Entry == nil {
+        return fmt.Sprintf("%s %s is not on the allowlist", strings.ToUpper(r.Field), r.Number)
+    }
+    return fmt.Sprintf("%s %s matches blocklist entry %s", strings.ToUpper(r.Field), r.Number, FormatListNumber(r.Entry))
+}
+
+// ScreenNumbers checks the ANI and DNIS of a call against the lists that
+// apply to its inbound provider and route. The most specific matching entry
+// decides, a block entry winning a tie. A number without a match is refused
+// only if an allowlist applies to its field. Returns nil if the call may go
+// ahead.
+func (m *Manager) ScreenNumbers(inboundProvider, routeName, ani, dnis string) *ListRefusal {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    
+    if len(m.numberLists) == 0 {
+        return nil
+    }
+    
+    scopes := []listScope{{}, {provider: inboundProvider}, {route: routeName}, {inboundProvider, routeName}}
+    for _, field := range []string{FieldANI, FieldDNIS} {
+        number := ani
+        if field == FieldDNIS {
+            number = dnis
+        }
+        number = strings.TrimPrefix(number, "+")
+        
+        var best *models.ListEntry
+        var bestRank int
+        allowlisted := false
+        for _, scope := range scopes {
+            set := m.numberLists[scope][field]
+            if set == nil {
+                continue
+            }
+            if set.allows > 0 {
+                allowlisted = true
+            }
+            entry, rank := set.lookup(number)
+            if entry != nil && (rank > bestRank || (rank == bestRank && entry.List == ListBlock)) {
+                best, bestRank = entry, rank
+            }
+        }
+        
+        switch {
+        case best != nil && best.List == ListBlock:
+            return &ListRefusal{Field: field, Number: number, Entry: best}
+        case best == nil && allowlisted:
+            return &ListRefusal{Field: field, Number: number}
+        }
+    }
+    return nil
+}
+
+// AddListEntry puts a number on a list, or updates the note of an entry
+// that is already there
+func (m *Manager) AddListEntry(entry *models.ListEntry) error {
+    if err := m.checkListEntry(entry); err != nil {
+        return err
+    }
+    
+    if err := storeListEntry(db.DB, entry); err != nil {
+        return err
+    }
+    
+    if err := m.LoadLists(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Added %s to the %s %slist", FormatListNumber(entry), entry.Field, entry.List)
+    return nil
+}
+
+// RemoveListEntry takes a number off a list
+func (m *Manager) RemoveListEntry(entry *models.ListEntry) error {
+    entry.Number = strings.TrimPrefix(entry.Number, "+")
+    
+    result, err := db.DB.Exec(`
+        DELETE FROM number_lists
+        WHERE list_type = ? AND field = ? AND number = ? AND is_prefix = ?
+          AND inbound_provider = ? AND route_name = ?`,
+        entry.List, entry.Field, entry.Number, entry.Prefix, entry.InboundProvider, entry.RouteName)
+    if err != nil {
+        return err
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("%s on the %s %slist %w", FormatListNumber(entry), entry.Field, entry.List, ErrNotFound)
+    }
+    
+    if err := m.LoadLists(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Removed %s from the %s %slist", FormatListNumber(entry), entry.Field, entry.List)
+    return nil
+}
+
+// ImportListEntries adds many entries in one transaction. With replace,
+// the entries already on each list, field and scope being imported are
+// removed first.
+func (m *Manager) ImportListEntries(entries []*models.ListEntry, replace bool) error {
+    for _, entry := range entries {
+        if err := m.checkListEntry(entry); err != nil {
+            return err
+        }
+    }
+    
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    if replace {
+        cleared := make(map[models.ListEntry]bool)
+        for _, entry := range entries {
+            key := models.ListEntry{List: entry.List, Field: entry.Field, InboundProvider: entry.InboundProvider, RouteName: entry.RouteName}
+            if cleared[key] {
+                continue
+            }
+            cleared[key] = true
+            _, err := tx.Exec(`
+                DELETE FROM number_lists
+                WHERE list_type = ? AND field = ? AND inbound_provider = ? AND route_name = ?`,
+                entry.List, entry.Field, entry.InboundProvider, entry.RouteName)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    
+    for _, entry := range entries {
+        if err := storeListEntry(tx, entry); err != nil {
+            return err
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadLists(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    log.Infof("Imported %d number list entries", len(entries))
+    return nil
+}
+
+// ListEntries returns the list entries matching the non-empty fields of
+// filter: List, Field, InboundProvider and RouteName
+func (m *Manager) ListEntries(filter models.ListEntry) ([]*models.ListEntry, error) {
+    query := `
+        SELECT id, list_type, field, number, is_prefix, inbound_provider, route_name, note, created_at
+        FROM number_lists
+        WHERE 1=1`
+    var args []interface{}
+    
+    for _, f := range []struct{ column, value string }{
+        {"list_type", filter.List},
+        {"field", filter.Field},
+        {"inbound_provider", filter.InboundProvider},
+        {"route_name", filter.RouteName},
+    } {
+        if f.value != "" {
+            query += " AND " + f.column + " = ?"
+            args = append(args, f.value)
+        }
+    }
+    query += " ORDER BY list_type, field, inbound_provider, route_name, number"
+    
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var entries []*models.ListEntry
+    for rows.Next() {
+        entry := &models.ListEntry{}
+        err := rows.Scan(&entry.ID, &entry.List, &entry.Field, &entry.Number, &entry.Prefix,
+            &entry.InboundProvider, &entry.RouteName, &entry.Note, &entry.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+        entries = append(entries, entry)
+    }
+    return entries, rows.Err()
+}
+
+// LoadLists reads the number lists into memory
+func (m *Manager) LoadLists() error {
+    entries, err := m.ListEntries(models.ListEntry{})
+    if err != nil {
+        return err
+    }
+    
+    lists := compileNumberLists(entries)
+    
+    m.mu.Lock()
+    m.numberLists = lists
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d number list entries", len(entries))
+    return nil
+}
+
+// compileNumberLists groups list entries by scope and field
+func compileNumberLists(entries []*models.ListEntry) numberLists {
+    lists := make(numberLists)
+    for _, entry := range entries {
+        scope := listScope{entry.InboundProvider, entry.RouteName}
+        if lists[scope] == nil {
+            lists[scope] = make(map[string]*numberSet)
+        }
+        set := lists[scope][entry.Field]
+        if set == nil {
+            set = newNumberSet()
+            lists[scope][entry.Field] = set
+        }
+        set.add(entry)
+    }
+    return lists
+}
+
+// ParseListNumber parses a list number as given on the command line or in
+// an import file. A trailing * makes it a prefix, e.g. 1900*.
+func ParseListNumber(spec string) (number string, prefix bool, err error) {
+    number = strings.TrimPrefix(strings.TrimSpace(spec), "+")
+    prefix = strings.HasSuffix(number, "*")
+    number = strings.TrimSuffix(number, "*")
+    if number == "" || strings.Trim(number, "0123456789") != "" {
+        return "", false, fmt.Errorf("%w: invalid number %q", ErrInvalid, spec)
+    }
+    return number, prefix, nil
+}
+
+// FormatListNumber is the inverse of ParseListNumber
+func FormatListNumber(entry *models.ListEntry) string {
+    if entry.Prefix {
+        return entry.Number + "*"
+    }
+    return entry.Number
+}
+
+// ParseNumberList reads list entries, one per line in CSV form:
+//
+//     number,note
+//
+// The note is optional and a number ending in * is a prefix. Empty lines,
+// lines starting with # and a header line are skipped. The caller fills in
+// the list, field and scope.
+func ParseNumberList(r io.Reader) ([]*models.ListEntry, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.Comment = '#'
+    reader.TrimLeadingSpace = true
+    
+    var entries []*models.ListEntry
+    for first := true; ; first = false {
+        fields, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+        }
+        line, _ := reader.FieldPos(0)
+        
+        if len(fields) == 0 || strings.TrimSpace(fields[0]) == "" {
+            continue
+        }
+        if first && strings.EqualFold(strings.TrimSpace(fields[0]), "number") {
+            continue
+        }
+        
+        number, prefix, err := ParseListNumber(fields[0])
+        if err != nil {
+            return nil, fmt.Errorf("%w: line %d: invalid number %q", ErrInvalid, line, fields[0])
+        }
+        entry := &models.ListEntry{Number: number, Prefix: prefix}
+        if len(fields) > 1 {
+            entry.Note = strings.TrimSpace(fields[1])
+        }
+        entries = append(entries, entry)
+    }
+    
+    return entries, nil
+}
+
+// checkListEntry validates a list entry and normalizes its number
+func (m *Manager) checkListEntry(entry *models.ListEntry) error {
+    if entry.List != ListBlock && entry.List != ListAllow {
+        return fmt.Errorf("%w: list must be block or allow", ErrInvalid)
+    }
+    if entry.Field != FieldANI && entry.Field != FieldDNIS {
+        return fmt.Errorf("%w: field must be ani or dnis", ErrInvalid)
+    }
+    
+    entry.Number = strings.TrimPrefix(entry.Number, "+")
+    if entry.Number == "" || strings.Trim(entry.Number, "0123456789") != "" {
+        return fmt.Errorf("%w: invalid number %q", ErrInvalid, entry.Number)
+    }
+    
+    if entry.InboundProvider != "" {
+        p, err := m.GetProvider(entry.InboundProvider)
+        if err != nil || p.Type != "inbound" {
+            return fmt.Errorf("%w: inbound provider %s not found", ErrInvalid, entry.InboundProvider)
+        }
+    }
+    if entry.RouteName != "" {
+        if _, err := m.GetRoute(entry.RouteName); err != nil {
+            return fmt.Errorf("%w: route %s not found", ErrInvalid, entry.RouteName)
+        }
+    }
+    return nil
+}
+
+// storeListEntry inserts a list entry or updates its note
+func storeListEntry(ex execer, entry *models.ListEntry) error {
+    _, err := ex.Exec(`
+        INSERT INTO number_lists (list_type, field, number, is_prefix, inbound_provider, route_name, note)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE note = VALUES(note)`,
+        entry.List, entry.Field, entry.Number, entry.Prefix, entry.InboundProvider, entry.RouteName, entry.Note)
+    if err != nil {
+        return fmt.Errorf("failed to store list entry %s: %v", FormatListNumber(entry), err)
+    }
+    return nil
+}
@@ -0,0 +1,121 @@
+package provider
+
+import (
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func listEntry(list, field, spec, inboundProvider, routeName string) *models.ListEntry {
+    number, prefix, err := ParseListNumber(spec)
+    if err != nil {
+        panic(err)
+    }
+    return &models.ListEntry{List: list, Field: field, Number: number, Prefix: prefix,
+        InboundProvider: inboundProvider, RouteName: routeName}
+}
+
+func TestScreenNumbers(t *testing.T) {
+    m := NewManager()
+    m.numberLists = compileNumberLists([]*models.ListEntry{
+        listEntry(ListBlock, FieldDNIS, "1900*", "", ""),
+        listEntry(ListAllow, FieldDNIS, "19005550000", "in1", ""),
+        listEntry(ListBlock, FieldDNIS, "44*", "", ""),
+        listEntry(ListAllow, FieldDNIS, "4420*", "", "uk"),
+        listEntry(ListBlock, FieldDNIS, "33123", "", "fr"),
+        listEntry(ListAllow, FieldDNIS, "33123", "", "fr"),
+        listEntry(ListBlock, FieldANI, "15551112222", "", "uk"),
+        listEntry(ListAllow, FieldANI, "15551112222", "in2", ""),
+        listEntry(ListAllow, FieldANI, "4930*", "in3", ""),
+    })
+    
+    tests := []struct {
+        name                string
+        provider, route     string
+        ani, dnis           string
+        rule, field, number string // rule is "" when the call may go ahead
+    }{
+        {"no match", "in0", "us", "15550000000", "12125551234", "", "", ""},
+        {"global prefix block", "in0", "us", "15550000000", "19005551234", "blocklist", FieldDNIS, "19005551234"},
+        {"leading + ignored", "in1", "us", "15550000000", "+19005551234", "blocklist", FieldDNIS, "19005551234"},
+        {"exact allow beats a shorter block prefix", "in1", "us", "15550000000", "19005550000", "", "", ""},
+        {"allow of another provider does not apply", "in0", "us", "15550000000", "19005550000", "blocklist", FieldDNIS, "19005550000"},
+        {"longer allow prefix of the route", "in0", "uk", "15550000000", "442071234567", "", "", ""},
+        {"block prefix outside the route allow", "in0", "uk", "15550000000", "442171234567", "blocklist", FieldDNIS, "442171234567"},
+        {"route allow does not apply elsewhere", "in0", "us", "15550000000", "442071234567", "blocklist", FieldDNIS, "442071234567"},
+        {"route allowlist refuses other numbers", "in0", "uk", "15550000000", "12125551234", "allowlist", FieldDNIS, "12125551234"},
+        {"block kept over allow of the same set", "in0", "fr", "15550000000", "33123", "blocklist", FieldDNIS, "33123"},
+        {"route block", "in0", "uk", "15551112222", "442071234567", "blocklist", FieldANI, "15551112222"},
+        {"block wins a tie across scopes", "in2", "uk", "15551112222", "442071234567", "blocklist", FieldANI, "15551112222"},
+        {"provider allow without the route block", "in2", "us", "15551112222", "12125551234", "", "", ""},
+        {"provider allowlist match", "in3", "us", "4930123456", "12125551234", "", "", ""},
+        {"provider allowlist refusal", "in3", "us", "15550000000", "12125551234", "allowlist", FieldANI, "15550000000"},
+    }
+    
+    for _, tt := range tests {
+        refusal := m.ScreenNumbers(tt.provider, tt.route, tt.ani, tt.dnis)
+        if refusal == nil {
+            if tt.rule != "" {
+                t.Errorf("%s: call allowed, want %s refusal", tt.name, tt.rule)
+            }
+            continue
+        }
+        if refusal.Rule() != tt.rule || refusal.Field != tt.field || refusal.Number != tt.number {
+            t.Errorf("%s: got %s refusal of %s %s, want %q of %s %s", tt.name,
+                refusal.Rule(), refusal.Field, refusal.Number, tt.rule, tt.field, tt.number)
+        }
+    }
+}
+
+func TestScreenNumbersWithoutLists(t *testing.T) {
+    if refusal := NewManager().ScreenNumbers("in0", "us", "15550000000", "19005551234"); refusal != nil {
+        t.Errorf("call refused without lists: %s", refusal.Reason())
+    }
+}
+
+func TestParseListNumber(t *testing.T) {
+    tests := []struct {
+        spec   string
+        number string
+        prefix bool
+    }{
+        {"15551234567", "15551234567", false},
+        {" +15551234567 ", "15551234567", false},
+        {"1900*", "1900", true},
+        {"+44*", "44", true},
+    }
+    for _, tt := range tests {
+        number, prefix, err := ParseListNumber(tt.spec)
+        if err != nil || number != tt.number || prefix != tt.prefix {
+            t.Errorf("%q: got %q, %v, %v; want %q, %v", tt.spec, number, prefix, err, tt.number, tt.prefix)
+        }
+    }
+    
+    for _, spec := range []string{"", "*", "+", "1-800", "abc*", "19*00"} {
+        if _, _, err := ParseListNumber(spec); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%q: got %v, want ErrInvalid", spec, err)
+        }
+    }
+}
+
+func TestParseNumberList(t *testing.T) {
+    input := "number,note\n# comment\n\n+15551234567,known spammer\n1900*\n"
+    entries, err := ParseNumberList(strings.NewReader(input))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []*models.ListEntry{
+        {Number: "15551234567", Note: "known spammer"},
+        {Number: "1900", Prefix: true},
+    }
+    if !reflect.DeepEqual(entries, want) {
+        t.Errorf("got %+v, want %+v", entries, want)
+    }
+    
+    if _, err := ParseNumberList(strings.NewReader("1555\nnot-a-number\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+        t.Errorf("got %v, want an error on line 2", err)
+    }
+}
@@ -1,28 +1,68 @@
 package provider
 
 import (
-//    "database/sql"
+    "database/sql"
     "encoding/json"
     "fmt"
-    "log"
+    "strings"
     "sync"
+    "time"
     
     "github.com/hamzaKhattat/asterisk-router-production/internal/ara"
     "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
     "github.com/hamzaKhattat/asterisk-router-production/internal/models"
 )
 
+var log = logger.Component("provider")
+
+// ProviderTypes lists the accepted values for models.Provider.Type
+var ProviderTypes = []string{"inbound", "intermediate", "final"}
+
+// Route verification policies for calls whose ANI or DNIS changed on the
+// way back from S3 or S4
+const (
+    VerifyLog        = "log"        // log a warning and route the call
+    VerifyReject     = "reject"     // refuse the call
+    VerifyQuarantine = "quarantine" // route the call but flag its record
+)
+
+// VerifyPolicies lists the accepted values for models.ProviderRoute.VerifyPolicy
+var VerifyPolicies = []string{VerifyLog, VerifyReject, VerifyQuarantine}
+
 type Manager struct {
     mu             sync.RWMutex
     providers      map[string]*models.Provider
     providerRoutes map[string]*models.ProviderRoute
+    // Compiled match criteria of providerRoutes
+    routeMatchers  map[string]*routeMatcher
+    // Providers dropped by a reload, kept so in-flight calls can still be verified
+    retired        map[string]*models.Provider
+    groups         map[string]*models.ProviderGroup
+    // Members of each group with the group's overrides applied
+    groupPools     map[string][]*models.Provider
+    rates          map[string]rateDeck
+    numberLists    numberLists
+    translations   map[translation][]*numberRule
+    // Resolved addresses of provider hostnames, for source IP checks
+    hosts          *hostCache
     araManager     *ara.Manager
+    configVersion  int64
 }
 
 func NewManager() *Manager {
     return &Manager{
         providers:      make(map[string]*models.Provider),
         providerRoutes: make(map[string]*models.ProviderRoute),
+        routeMatchers:  make(map[string]*routeMatcher),
+        retired:        make(map[string]*models.Provider),
+        groups:         make(map[string]*models.ProviderGroup),
+        groupPools:     make(map[string][]*models.Provider),
+        rates:          make(map[string]rateDeck),
+        numberLists:    make(numberLists),
+        translations:   make(map[translation][]*numberRule),
+        hosts:          newHostCache(),
         araManager:     ara.NewManager(),
     }
 }
@@ -33,16 +73,42 @@ func (m *Manager) Initialize() error {
         return fmt.Errorf("failed to create ARA tables: %v", err)
     }
     
+    // Remember the config version we start from so the watcher only
+    // reloads on changes made after this point
+    if version, err := currentConfigVersion(); err == nil {
+        m.configVersion = version
+    }
+    
     // Load providers from database
     if err := m.LoadProviders(); err != nil {
         return err
     }
     
+    // Load provider groups
+    if err := m.LoadGroups(); err != nil {
+        return err
+    }
+    
     // Load routes
     if err := m.LoadRoutes(); err != nil {
         return err
     }
     
+    // Load rate decks for least-cost routing
+    if err := m.LoadRates(); err != nil {
+        return err
+    }
+    
+    // Load ANI/DNIS blocklists and allowlists
+    if err := m.LoadLists(); err != nil {
+        return err
+    }
+    
+    // Load ANI/DNIS translation rules
+    if err := m.LoadNumberRules(); err != nil {
+        return err
+    }
+    
     // Create dialplan
     if err := m.araManager.CreateDialplan(); err != nil {
         return err
@@ -54,13 +120,43 @@ func (m *Manager) Initialize() error {
 func (m *Manager) AddProvider(p *models.Provider) error {
     // Validate
     if p.Name == "" || p.Host == "" {
-        return fmt.Errorf("provider name and host are required")
+        return fmt.Errorf("%w: provider name and host are required", ErrInvalid)
+    }
+    
+    validType := false
+    for _, t := range ProviderTypes {
+        if p.Type == t {
+            validType = true
+            break
+        }
+    }
+    if !validType {
+        return fmt.Errorf("%w: provider type must be inbound, intermediate, or final", ErrInvalid)
+    }
+    
+    if p.MaxChannels < 0 || p.MaxCPS < 0 {
+        return fmt.Errorf("%w: channel and CPS limits cannot be negative", ErrInvalid)
     }
     
     if p.Port == 0 {
         p.Port = 5060
     }
     
+    for i, entry := range p.AllowedIPs {
+        address, err := ParseAllowedAddress(entry)
+        if err != nil {
+            return err
+        }
+        p.AllowedIPs[i] = address
+    }
+    
+    m.mu.RLock()
+    _, clash := m.groups[p.Name]
+    m.mu.RUnlock()
+    if clash {
+        return fmt.Errorf("%w: a provider group is already named %s", ErrConflict, p.Name)
+    }
+    
     // Determine auth type based on username/password
     if p.Username == "" && p.Password == "" {
         p.AuthType = "ip"
@@ -75,24 +171,30 @@ func (m *Manager) AddProvider(p *models.Provider) error {
     
     // Store in database
     codecsJSON, _ := json.Marshal(p.Codecs)
+    var allowedJSON []byte
+    if len(p.AllowedIPs) > 0 {
+        allowedJSON, _ = json.Marshal(p.AllowedIPs)
+    }
     
     query := `
-        INSERT INTO providers (name, type, host, port, username, password, auth_type, codecs, max_channels, priority, weight, active)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO providers (name, type, host, allowed_ips, port, username, password, auth_type, codecs, max_channels, max_cps, priority, weight, active)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON DUPLICATE KEY UPDATE
             type = VALUES(type),
             host = VALUES(host),
+            allowed_ips = VALUES(allowed_ips),
             port = VALUES(port),
             username = VALUES(username),
             password = VALUES(password),
             auth_type = VALUES(auth_type),
             codecs = VALUES(codecs),
             max_channels = VALUES(max_channels),
+            max_cps = VALUES(max_cps),
             priority = VALUES(priority),
             weight = VALUES(weight),
             active = VALUES(active)`
     
-    result, err := db.DB.Exec(query, p.Name, p.Type, p.Host, p.Port, p.Username, p.Password, p.AuthType, codecsJSON, p.MaxChannels, p.Priority, p.Weight, p.Active)
+    result, err := db.DB.Exec(query, p.Name, p.Type, p.Host, allowedJSON, p.Port, p.Username, p.Password, p.AuthType, codecsJSON, p.MaxChannels, p.MaxCPS, p.Priority, p.Weight, p.Active)
     if err != nil {
         return err
     }
@@ -105,6 +207,8 @@ func (m *Manager) AddProvider(p *models.Provider) error {
     // Store in memory
     m.mu.Lock()
     m.providers[p.Name] = p
+    delete(m.retired, p.Name)
+    m.buildGroupPools()
     m.mu.Unlock()
     
     // Create ARA endpoint
@@ -112,7 +216,9 @@ func (m *Manager) AddProvider(p *models.Provider) error {
         return fmt.Errorf("failed to create ARA endpoint: %v", err)
     }
     
-    log.Printf("Provider %s added successfully", p.Name)
+    bumpConfigVersion()
+    
+    log.Infof("Provider %s added successfully", p.Name)
     return nil
 }
 
@@ -122,36 +228,35 @@ func (m *Manager) GetProvider(name string) (*models.Provider, error) {
     
     provider, exists := m.providers[name]
     if !exists {
-        return nil, fmt.Errorf("provider %s not found", name)
+        provider, exists = m.retired[name]
+    }
+    if !exists {
+        return nil, fmt.Errorf("provider %s %w", name, ErrNotFound)
     }
     
     return provider, nil
 }
 
-func (m *Manager) GetProvidersByName(namePattern string) ([]*models.Provider, error) {
+// GetProvidersByName returns the pool a route hop refers to: the members of
+// the provider group of that name, with the group's overrides applied, or
+// else the single provider of that name
+func (m *Manager) GetProvidersByName(name string) ([]*models.Provider, error) {
     m.mu.RLock()
     defer m.mu.RUnlock()
     
-    var providers []*models.Provider
-    
-    // Check if it's an exact match first
-    if p, exists := m.providers[namePattern]; exists {
-        providers = append(providers, p)
-        return providers, nil
-    }
-    
-    // Otherwise, look for pattern match (e.g., for load balancing groups)
-    for name, p := range m.providers {
-        if name == namePattern || p.Type == namePattern {
-            providers = append(providers, p)
+    if _, exists := m.groups[name]; exists {
+        pool := m.groupPools[name]
+        if len(pool) == 0 {
+            return nil, fmt.Errorf("provider group %s has no active members", name)
         }
+        return pool, nil
     }
     
-    if len(providers) == 0 {
-        return nil, fmt.Errorf("no providers found matching %s", namePattern)
+    if p, exists := m.providers[name]; exists {
+        return []*models.Provider{p}, nil
     }
     
-    return providers, nil
+    return nil, fmt.Errorf("no provider or group named %s", name)
 }
 
 func (m *Manager) ListProviders(providerType string) ([]*models.Provider, error) {
@@ -174,30 +279,45 @@ func (m *Manager) DeleteProvider(name string) error {
     db.DB.QueryRow("SELECT COUNT(*) FROM provider_routes WHERE inbound_provider = ? OR intermediate_provider = ? OR final_provider = ?", 
         name, name, name).Scan(&count)
     if count > 0 {
-        return fmt.Errorf("provider %s is used in %d routes", name, count)
+        return fmt.Errorf("%w: provider %s is used in %d routes", ErrConflict, name, count)
     }
     
     // Delete from ARA
     if err := m.araManager.DeleteEndpoint(name); err != nil {
-        log.Printf("Failed to delete ARA endpoint: %v", err)
+        log.Errorf("Failed to delete ARA endpoint: %v", err)
     }
     
     // Delete from database
-    if _, err := db.DB.Exec("DELETE FROM providers WHERE name = ?", name); err != nil {
+    result, err := db.DB.Exec("DELETE FROM providers WHERE name = ?", name)
+    if err != nil {
         return err
     }
     
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("provider %s %w", name, ErrNotFound)
+    }
+    
+    // Take it out of any provider groups
+    if _, err := db.DB.Exec("DELETE FROM provider_group_members WHERE provider_name = ?", name); err != nil {
+        log.Errorf("Failed to remove provider %s from groups: %v", name, err)
+    } else if err := m.LoadGroups(); err != nil {
+        log.Errorf("Failed to reload provider groups: %v", err)
+    }
+    
     // Remove from memory
     m.mu.Lock()
     delete(m.providers, name)
+    delete(m.retired, name)
+    m.buildGroupPools()
     m.mu.Unlock()
     
+    bumpConfigVersion()
     return nil
 }
 
 func (m *Manager) LoadProviders() error {
     query := `
-        SELECT id, name, type, host, port, username, password, auth_type, codecs, max_channels, priority, weight, active
+        SELECT id, name, type, host, allowed_ips, port, username, password, auth_type, codecs, max_channels, max_cps, priority, weight, active
         FROM providers
         WHERE active = TRUE`
     
@@ -207,53 +327,117 @@ func (m *Manager) LoadProviders() error {
     }
     defer rows.Close()
     
-    m.mu.Lock()
-    defer m.mu.Unlock()
-    
-    m.providers = make(map[string]*models.Provider)
+    // Build the new table first and swap it in under the lock, so lookups
+    // never see a half-loaded provider list
+    providers := make(map[string]*models.Provider)
     
     for rows.Next() {
         p := &models.Provider{}
-        var codecsJSON []byte
+        var codecsJSON, allowedJSON []byte
         
-        err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.Host, &p.Port, &p.Username, &p.Password, &p.AuthType, &codecsJSON, &p.MaxChannels, &p.Priority, &p.Weight, &p.Active)
+        err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.Host, &allowedJSON, &p.Port, &p.Username, &p.Password, &p.AuthType, &codecsJSON, &p.MaxChannels, &p.MaxCPS, &p.Priority, &p.Weight, &p.Active)
         if err != nil {
-            log.Printf("Error loading provider: %v", err)
+            log.Errorf("Error loading provider: %v", err)
             continue
         }
         
         json.Unmarshal(codecsJSON, &p.Codecs)
-        m.providers[p.Name] = p
+        if len(allowedJSON) > 0 {
+            json.Unmarshal(allowedJSON, &p.AllowedIPs)
+        }
+        providers[p.Name] = p
         
         // Create ARA endpoint
         m.araManager.CreateEndpoint(p)
     }
     
-    log.Printf("Loaded %d providers", len(m.providers))
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    m.mu.Lock()
+    for name, p := range m.providers {
+        if _, exists := providers[name]; !exists {
+            m.retired[name] = p
+        }
+    }
+    for name := range providers {
+        delete(m.retired, name)
+    }
+    m.providers = providers
+    m.buildGroupPools()
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d providers", len(providers))
     return nil
 }
 
 // Route management
 func (m *Manager) AddProviderRoute(route *models.ProviderRoute) error {
-    // Validate providers exist
-    for _, providerName := range []string{route.InboundProvider, route.IntermediateProvider, route.FinalProvider} {
-        if _, err := m.GetProvider(providerName); err != nil {
-            return fmt.Errorf("provider %s not found", providerName)
+    if route.Name == "" {
+        return fmt.Errorf("%w: route name is required", ErrInvalid)
+    }
+    
+    if route.LoadBalanceMode == "" {
+        route.LoadBalanceMode = "round_robin"
+    }
+    if !loadbalancer.IsValidMode(route.LoadBalanceMode) {
+        return fmt.Errorf("%w: unknown load balance mode %s", ErrInvalid, route.LoadBalanceMode)
+    }
+    if route.ASRWeight < 0 || route.ACDWeight < 0 || route.PDDWeight < 0 {
+        return fmt.Errorf("%w: quality weights must not be negative", ErrInvalid)
+    }
+    if route.VerifyPolicy == "" {
+        route.VerifyPolicy = VerifyLog
+    }
+    if route.VerifyPolicy != VerifyLog && route.VerifyPolicy != VerifyReject && route.VerifyPolicy != VerifyQuarantine {
+        return fmt.Errorf("%w: verify policy must be one of %s", ErrInvalid, strings.Join(VerifyPolicies, ", "))
+    }
+    matcher, err := compileRouteMatch(route)
+    if err != nil {
+        return err
+    }
+    scheduleJSON, err := encodeSchedule(route.Schedule)
+    if err != nil {
+        return err
+    }
+    
+    // Validate providers exist; the intermediate and final hops may also
+    // name a provider group
+    if _, err := m.GetProvider(route.InboundProvider); err != nil {
+        return fmt.Errorf("%w: provider %s not found", ErrInvalid, route.InboundProvider)
+    }
+    for _, poolName := range []string{route.IntermediateProvider, route.FinalProvider} {
+        if _, err := m.GetProvidersByName(poolName); err != nil {
+            return fmt.Errorf("%w: no provider or group named %s", ErrInvalid, poolName)
         }
     }
     
     query := `
-        INSERT INTO provider_routes (name, inbound_provider, intermediate_provider, final_provider, load_balance_mode, priority, active)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO provider_routes (name, inbound_provider, intermediate_provider, final_provider, load_balance_mode, priority, active,
+                                     asr_weight, acd_weight, pdd_weight, dnis_prefix, dnis_pattern, ani_prefix, country, schedule,
+                                     verify_policy)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
         ON DUPLICATE KEY UPDATE
             inbound_provider = VALUES(inbound_provider),
             intermediate_provider = VALUES(intermediate_provider),
             final_provider = VALUES(final_provider),
             load_balance_mode = VALUES(load_balance_mode),
             priority = VALUES(priority),
-            active = VALUES(active)`
-    
-    result, err := db.DB.Exec(query, route.Name, route.InboundProvider, route.IntermediateProvider, route.FinalProvider, route.LoadBalanceMode, route.Priority, route.Active)
+            active = VALUES(active),
+            asr_weight = VALUES(asr_weight),
+            acd_weight = VALUES(acd_weight),
+            pdd_weight = VALUES(pdd_weight),
+            dnis_prefix = VALUES(dnis_prefix),
+            dnis_pattern = VALUES(dnis_pattern),
+            ani_prefix = VALUES(ani_prefix),
+            country = VALUES(country),
+            schedule = VALUES(schedule),
+            verify_policy = VALUES(verify_policy)`
+    
+    result, err := db.DB.Exec(query, route.Name, route.InboundProvider, route.IntermediateProvider, route.FinalProvider, route.LoadBalanceMode, route.Priority, route.Active,
+        route.ASRWeight, route.ACDWeight, route.PDDWeight, route.DNISPrefix, route.DNISPattern, route.ANIPrefix, route.Country, scheduleJSON,
+        route.VerifyPolicy)
     if err != nil {
         return err
     }
@@ -265,29 +449,150 @@ func (m *Manager) AddProviderRoute(route *models.ProviderRoute) error {
     
     m.mu.Lock()
     m.providerRoutes[route.Name] = route
+    m.routeMatchers[route.Name] = matcher
     m.mu.Unlock()
     
-    log.Printf("Provider route %s created: %s -> %s -> %s", route.Name, route.InboundProvider, route.IntermediateProvider, route.FinalProvider)
+    bumpConfigVersion()
+    
+    log.Infof("Provider route %s created: %s -> %s -> %s", route.Name, route.InboundProvider, route.IntermediateProvider, route.FinalProvider)
     return nil
 }
 
-func (m *Manager) GetRouteForInbound(inboundProvider string) (*models.ProviderRoute, error) {
+// ListRoutes returns every route in the database, including inactive ones
+func (m *Manager) ListRoutes() ([]*models.ProviderRoute, error) {
+    query := `
+        SELECT id, name, inbound_provider, intermediate_provider, final_provider,
+               load_balance_mode, priority, active, created_at,
+               asr_weight, acd_weight, pdd_weight, dnis_prefix, dnis_pattern, ani_prefix, country, schedule, verify_policy
+        FROM provider_routes
+        ORDER BY priority DESC, name`
+    
+    rows, err := db.DB.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var routes []*models.ProviderRoute
+    for rows.Next() {
+        route := &models.ProviderRoute{}
+        var scheduleJSON []byte
+        err := rows.Scan(&route.ID, &route.Name, &route.InboundProvider, &route.IntermediateProvider,
+            &route.FinalProvider, &route.LoadBalanceMode, &route.Priority, &route.Active, &route.CreatedAt,
+            &route.ASRWeight, &route.ACDWeight, &route.PDDWeight,
+            &route.DNISPrefix, &route.DNISPattern, &route.ANIPrefix, &route.Country, &scheduleJSON, &route.VerifyPolicy)
+        if err != nil {
+            return nil, err
+        }
+        if route.Schedule, err = decodeSchedule(scheduleJSON); err != nil {
+            return nil, err
+        }
+        routes = append(routes, route)
+    }
+    
+    return routes, rows.Err()
+}
+
+// GetRoute returns a single route from the database
+func (m *Manager) GetRoute(name string) (*models.ProviderRoute, error) {
+    query := `
+        SELECT id, name, inbound_provider, intermediate_provider, final_provider,
+               load_balance_mode, priority, active, created_at,
+               asr_weight, acd_weight, pdd_weight, dnis_prefix, dnis_pattern, ani_prefix, country, schedule, verify_policy
+        FROM provider_routes
+        WHERE name = ?`
+    
+    route := &models.ProviderRoute{}
+    var scheduleJSON []byte
+    err := db.DB.QueryRow(query, name).Scan(&route.ID, &route.Name, &route.InboundProvider,
+        &route.IntermediateProvider, &route.FinalProvider, &route.LoadBalanceMode,
+        &route.Priority, &route.Active, &route.CreatedAt,
+        &route.ASRWeight, &route.ACDWeight, &route.PDDWeight,
+        &route.DNISPrefix, &route.DNISPattern, &route.ANIPrefix, &route.Country, &scheduleJSON, &route.VerifyPolicy)
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("route %s %w", name, ErrNotFound)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if route.Schedule, err = decodeSchedule(scheduleJSON); err != nil {
+        return nil, err
+    }
+    
+    return route, nil
+}
+
+// DeleteProviderRoute removes a route from the database and the live route table
+func (m *Manager) DeleteProviderRoute(name string) error {
+    result, err := db.DB.Exec("DELETE FROM provider_routes WHERE name = ?", name)
+    if err != nil {
+        return err
+    }
+    
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("route %s %w", name, ErrNotFound)
+    }
+    
+    m.mu.Lock()
+    delete(m.providerRoutes, name)
+    delete(m.routeMatchers, name)
+    m.mu.Unlock()
+    
+    bumpConfigVersion()
+    
+    log.Infof("Provider route %s deleted", name)
+    return nil
+}
+
+// VerifyPolicy returns the verification policy of a loaded route, the log
+// policy if the route is gone
+func (m *Manager) VerifyPolicy(routeName string) string {
     m.mu.RLock()
     defer m.mu.RUnlock()
     
-    // Find route with highest priority for this inbound provider
-    var bestRoute *models.ProviderRoute
-    highestPriority := -1
+    if route, ok := m.providerRoutes[routeName]; ok && route.VerifyPolicy != "" {
+        return route.VerifyPolicy
+    }
+    return VerifyLog
+}
+
+// ActiveRoute returns a route from the live route table by name, whatever its
+// schedule says now. ok is false if the route was deleted or deactivated.
+func (m *Manager) ActiveRoute(name string) (route *models.ProviderRoute, ok bool) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
     
+    route, ok = m.providerRoutes[name]
+    return route, ok
+}
+
+// GetRouteForInbound returns the route for a call from an inbound provider.
+// Of the active routes of the provider whose match criteria hold for ani and
+// dnis and whose schedule allows calls now, the most specific one wins (see
+// routeRank).
+func (m *Manager) GetRouteForInbound(inboundProvider, ani, dnis string) (*models.ProviderRoute, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    
+    ani = strings.TrimPrefix(ani, "+")
+    dnis = strings.TrimPrefix(dnis, "+")
+    now := time.Now()
+    
+    var bestRoute *models.ProviderRoute
     for _, route := range m.providerRoutes {
-        if route.InboundProvider == inboundProvider && route.Active && route.Priority > highestPriority {
+        if route.InboundProvider != inboundProvider || !route.Active {
+            continue
+        }
+        if !m.routeMatchers[route.Name].matches(route, ani, dnis, now) {
+            continue
+        }
+        if bestRoute == nil || routeOutranks(route, bestRoute) {
             bestRoute = route
-            highestPriority = route.Priority
         }
     }
     
     if bestRoute == nil {
-        return nil, fmt.Errorf("no active route found for inbound provider %s", inboundProvider)
+        return nil, fmt.Errorf("no active route found for inbound provider %s and DNIS %s", inboundProvider, dnis)
     }
     
     return bestRoute, nil
@@ -295,7 +600,8 @@ func (m *Manager) GetRouteForInbound(inboundProvider string) (*models.ProviderRo
 
 func (m *Manager) LoadRoutes() error {
     query := `
-        SELECT id, name, inbound_provider, intermediate_provider, final_provider, load_balance_mode, priority, active
+        SELECT id, name, inbound_provider, intermediate_provider, final_provider, load_balance_mode, priority, active,
+               asr_weight, acd_weight, pdd_weight, dnis_prefix, dnis_pattern, ani_prefix, country, schedule, verify_policy
         FROM provider_routes
         WHERE active = TRUE`
     
@@ -306,23 +612,44 @@ func (m *Manager) LoadRoutes() error {
     }
     defer rows.Close()
     
-    m.mu.Lock()
-    defer m.mu.Unlock()
-    
-    m.providerRoutes = make(map[string]*models.ProviderRoute)
+    routes := make(map[string]*models.ProviderRoute)
+    matchers := make(map[string]*routeMatcher)
     
     for rows.Next() {
         route := &models.ProviderRoute{}
-        err := rows.Scan(&route.ID, &route.Name, &route.InboundProvider, &route.IntermediateProvider, &route.FinalProvider, &route.LoadBalanceMode, &route.Priority, &route.Active)
+        var scheduleJSON []byte
+        err := rows.Scan(&route.ID, &route.Name, &route.InboundProvider, &route.IntermediateProvider, &route.FinalProvider, &route.LoadBalanceMode, &route.Priority, &route.Active,
+            &route.ASRWeight, &route.ACDWeight, &route.PDDWeight,
+            &route.DNISPrefix, &route.DNISPattern, &route.ANIPrefix, &route.Country, &scheduleJSON, &route.VerifyPolicy)
+        if err != nil {
+            log.Errorf("Error loading route: %v", err)
+            continue
+        }
+        if route.Schedule, err = decodeSchedule(scheduleJSON); err != nil {
+            log.Errorf("Skipping route %s: %v", route.Name, err)
+            continue
+        }
+        
+        matcher, err := compileRouteMatch(route)
         if err != nil {
-            log.Printf("Error loading route: %v", err)
+            log.Errorf("Skipping route %s: %v", route.Name, err)
             continue
         }
         
-        m.providerRoutes[route.Name] = route
+        routes[route.Name] = route
+        matchers[route.Name] = matcher
     }
     
-    log.Printf("Loaded %d routes", len(m.providerRoutes))
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    m.mu.Lock()
+    m.providerRoutes = routes
+    m.routeMatchers = matchers
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d routes", len(routes))
     return nil
 }
 
@@ -344,7 +671,7 @@ func (m *Manager) GetRouterStats() map[string]interface{} {
     `).Scan(&totalDIDs, &usedDIDs, &availableDIDs)
     
     if err != nil {
-        log.Printf("Error getting DID stats: %v", err)
+        log.Errorf("Error getting DID stats: %v", err)
         totalDIDs, usedDIDs, availableDIDs = 0, 0, 0
     }
     
@@ -0,0 +1,279 @@
+package provider
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Rate deck defaults for CSV columns left empty
+const (
+    DefaultBillingIncrement = 60
+    DefaultCurrency         = "USD"
+)
+
+// rateDeck holds one provider's rates by prefix. The rates of a prefix are
+// sorted by effective date, oldest first.
+type rateDeck map[string][]*models.Rate
+
+// lookup returns the rate of the longest prefix of number that is in effect
+// at the given time
+func (d rateDeck) lookup(number string, at time.Time) *models.Rate {
+    for n := len(number); n > 0; n-- {
+        rates := d[number[:n]]
+        for i := len(rates) - 1; i >= 0; i-- {
+            if !rates[i].EffectiveDate.After(at) {
+                return rates[i]
+            }
+        }
+    }
+    return nil
+}
+
+// ParseRateDeck reads a rate deck in CSV form:
+//
+//     prefix,rate_per_minute,billing_increment,effective_date,currency
+//
+// Only prefix and rate are required. The increment defaults to 60 seconds,
+// the effective date (YYYY-MM-DD) to today and the currency to USD. Empty
+// lines, lines starting with # and a header line are skipped.
+func ParseRateDeck(r io.Reader, providerName string) ([]*models.Rate, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.Comment = '#'
+    reader.TrimLeadingSpace = true
+    
+    today := time.Now().Truncate(24 * time.Hour)
+    
+    var rates []*models.Rate
+    for first := true; ; first = false {
+        fields, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+        }
+        line, _ := reader.FieldPos(0)
+        
+        for i := range fields {
+            fields[i] = strings.TrimSpace(fields[i])
+        }
+        if len(fields) == 0 || fields[0] == "" {
+            continue
+        }
+        if first && strings.EqualFold(fields[0], "prefix") {
+            continue
+        }
+        if len(fields) < 2 {
+            return nil, fmt.Errorf("%w: line %d: prefix and rate are required", ErrInvalid, line)
+        }
+        
+        rate := &models.Rate{
+            ProviderName:     providerName,
+            Prefix:           strings.TrimPrefix(fields[0], "+"),
+            BillingIncrement: DefaultBillingIncrement,
+            EffectiveDate:    today,
+            Currency:         DefaultCurrency,
+        }
+        
+        if rate.RatePerMinute, err = strconv.ParseFloat(fields[1], 64); err != nil || rate.RatePerMinute < 0 {
+            return nil, fmt.Errorf("%w: line %d: invalid rate %q", ErrInvalid, line, fields[1])
+        }
+        if len(fields) > 2 && fields[2] != "" {
+            if rate.BillingIncrement, err = strconv.Atoi(fields[2]); err != nil || rate.BillingIncrement <= 0 {
+                return nil, fmt.Errorf("%w: line %d: invalid billing increment %q", ErrInvalid, line, fields[2])
+            }
+        }
+        if len(fields) > 3 && fields[3] != "" {
+            if rate.EffectiveDate, err = time.Parse("2006-01-02", fields[3]); err != nil {
+                return nil, fmt.Errorf("%w: line %d: invalid effective date %q", ErrInvalid, line, fields[3])
+            }
+        }
+        if len(fields) > 4 && fields[4] != "" {
+            rate.Currency = strings.ToUpper(fields[4])
+        }
+        
+        rates = append(rates, rate)
+    }
+    
+    return rates, nil
+}
+
+// Charge returns what a call of the given length costs at rate. The length
+// is rounded up to the rate's billing increment.
+func Charge(rate *models.Rate, seconds int) float64 {
+    if rate == nil || seconds <= 0 {
+        return 0
+    }
+    
+    increment := rate.BillingIncrement
+    if increment <= 0 {
+        increment = DefaultBillingIncrement
+    }
+    billed := (seconds + increment - 1) / increment * increment
+    return float64(billed) / 60 * rate.RatePerMinute
+}
+
+// ImportRates stores rates in the deck of a provider. A rate for a prefix
+// and effective date that already exists is overwritten. With replace the
+// provider's whole deck is replaced.
+func (m *Manager) ImportRates(providerName string, rates []*models.Rate, replace bool) error {
+    if _, err := m.GetProvider(providerName); err != nil {
+        return fmt.Errorf("%w: provider %s not found", ErrInvalid, providerName)
+    }
+    
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    if replace {
+        if _, err := tx.Exec("DELETE FROM rate_decks WHERE provider_name = ?", providerName); err != nil {
+            return err
+        }
+    }
+    
+    stmt, err := tx.Prepare(`
+        INSERT INTO rate_decks (provider_name, prefix, rate_per_minute, billing_increment, effective_date, currency)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            rate_per_minute = VALUES(rate_per_minute),
+            billing_increment = VALUES(billing_increment),
+            currency = VALUES(currency)`)
+    if err != nil {
+        return err
+    }
+    defer stmt.Close()
+    
+    for _, rate := range rates {
+        if rate.Prefix == "" {
+            return fmt.Errorf("%w: rate prefix is required", ErrInvalid)
+        }
+        _, err := stmt.Exec(providerName, rate.Prefix, rate.RatePerMinute, rate.BillingIncrement,
+            rate.EffectiveDate.Format("2006-01-02"), rate.Currency)
+        if err != nil {
+            return fmt.Errorf("failed to store rate for prefix %s: %v", rate.Prefix, err)
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadRates(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    log.Infof("Imported %d rates for provider %s", len(rates), providerName)
+    return nil
+}
+
+// ListRates returns the rate deck of a provider ordered by prefix and
+// effective date, optionally only the prefixes starting with prefix
+func (m *Manager) ListRates(providerName, prefix string) ([]*models.Rate, error) {
+    query := `
+        SELECT id, provider_name, prefix, rate_per_minute, billing_increment, effective_date, currency
+        FROM rate_decks
+        WHERE provider_name = ?`
+    args := []interface{}{providerName}
+    
+    if prefix != "" {
+        query += " AND prefix LIKE ?"
+        args = append(args, prefix+"%")
+    }
+    query += " ORDER BY prefix, effective_date"
+    
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var rates []*models.Rate
+    for rows.Next() {
+        rate := &models.Rate{}
+        err := rows.Scan(&rate.ID, &rate.ProviderName, &rate.Prefix, &rate.RatePerMinute,
+            &rate.BillingIncrement, &rate.EffectiveDate, &rate.Currency)
+        if err != nil {
+            return nil, err
+        }
+        rates = append(rates, rate)
+    }
+    
+    return rates, rows.Err()
+}
+
+// LookupRate returns the rate a provider charges for calls to number right
+// now, using the longest matching prefix of its deck
+func (m *Manager) LookupRate(providerName, number string) (*models.Rate, error) {
+    number = strings.TrimPrefix(number, "+")
+    
+    m.mu.RLock()
+    deck := m.rates[providerName]
+    m.mu.RUnlock()
+    
+    if rate := deck.lookup(number, time.Now()); rate != nil {
+        return rate, nil
+    }
+    return nil, fmt.Errorf("rate for %s on provider %s %w", number, providerName, ErrNotFound)
+}
+
+// LoadRates reads every rate deck into memory
+func (m *Manager) LoadRates() error {
+    rows, err := db.DB.Query(`
+        SELECT id, provider_name, prefix, rate_per_minute, billing_increment, effective_date, currency
+        FROM rate_decks`)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    
+    decks := make(map[string]rateDeck)
+    count := 0
+    for rows.Next() {
+        rate := &models.Rate{}
+        err := rows.Scan(&rate.ID, &rate.ProviderName, &rate.Prefix, &rate.RatePerMinute,
+            &rate.BillingIncrement, &rate.EffectiveDate, &rate.Currency)
+        if err != nil {
+            log.Errorf("Error loading rate: %v", err)
+            continue
+        }
+        
+        deck, exists := decks[rate.ProviderName]
+        if !exists {
+            deck = make(rateDeck)
+            decks[rate.ProviderName] = deck
+        }
+        deck[rate.Prefix] = append(deck[rate.Prefix], rate)
+        count++
+    }
+    
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    for _, deck := range decks {
+        for _, rates := range deck {
+            sort.Slice(rates, func(i, j int) bool {
+                return rates[i].EffectiveDate.Before(rates[j].EffectiveDate)
+            })
+        }
+    }
+    
+    m.mu.Lock()
+    m.rates = decks
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d rates for %d providers", count, len(decks))
+    return nil
+}
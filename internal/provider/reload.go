@@ -0,0 +1,111 @@
+package provider
+
+import (
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+)
+
+// Reload re-reads providers, groups, routes, rate decks, number lists and
+// translation rules from the database and swaps them in.
+// Calls already in flight keep the provider names they were routed with;
+// providers that disappear stay resolvable through GetProvider so those
+// calls can still be verified when they return.
+func (m *Manager) Reload() error {
+    version, err := currentConfigVersion()
+    if err != nil {
+        log.Errorf("Failed to read config version: %v", err)
+    }
+    
+    if err := m.LoadProviders(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadGroups(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadRoutes(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadRates(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadLists(); err != nil {
+        return err
+    }
+    
+    if err := m.LoadNumberRules(); err != nil {
+        return err
+    }
+    
+    if err == nil {
+        m.mu.Lock()
+        m.configVersion = version
+        m.mu.Unlock()
+    }
+    
+    log.Infof("Configuration reloaded (version %d)", version)
+    return nil
+}
+
+// RequestReload bumps the shared config version, so every running AGI server
+// watching it reloads on its next poll. Used by the CLI, which runs in a
+// separate process from the servers.
+func (m *Manager) RequestReload() error {
+    return incrementConfigVersion()
+}
+
+// WatchConfigVersion polls the config version every interval and reloads
+// when another process has changed providers, routes or DIDs
+func (m *Manager) WatchConfigVersion(interval time.Duration, stop <-chan struct{}) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            version, err := currentConfigVersion()
+            if err != nil {
+                log.Errorf("Failed to read config version: %v", err)
+                continue
+            }
+            
+            m.mu.RLock()
+            changed := version != m.configVersion
+            m.mu.RUnlock()
+            
+            if changed {
+                log.Infof("Config version changed to %d, reloading", version)
+                if err := m.Reload(); err != nil {
+                    log.Errorf("Failed to reload configuration: %v", err)
+                }
+            }
+        }
+    }
+}
+
+func currentConfigVersion() (int64, error) {
+    var version int64
+    err := db.DB.QueryRow("SELECT version FROM config_version WHERE id = 1").Scan(&version)
+    return version, err
+}
+
+// bumpConfigVersion records a configuration change made by this process.
+// The in-memory tables are already up to date, so the local version is not
+// advanced and the watcher of this process reloads once as well, which is
+// harmless and keeps the logic simple.
+func bumpConfigVersion() {
+    if err := incrementConfigVersion(); err != nil {
+        log.Errorf("Failed to bump config version: %v", err)
+    }
+}
+
+func incrementConfigVersion() error {
+    _, err := db.DB.Exec("UPDATE config_version SET version = version + 1 WHERE id = 1")
+    return err
+}
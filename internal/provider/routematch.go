@@ -0,0 +1,96 @@
+package provider
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/numbering"
+)
+
+// routeMatcher holds the compiled match criteria of a route
+type routeMatcher struct {
+    pattern  *regexp.Regexp // DNIS pattern, nil if the route has none
+    schedule *schedule      // nil if the route has none
+}
+
+// compileRouteMatch checks the match criteria of a route, normalizing its
+// prefixes and country, and compiles its DNIS pattern and schedule
+func compileRouteMatch(route *models.ProviderRoute) (*routeMatcher, error) {
+    route.DNISPrefix = strings.TrimPrefix(strings.TrimSpace(route.DNISPrefix), "+")
+    route.ANIPrefix = strings.TrimPrefix(strings.TrimSpace(route.ANIPrefix), "+")
+    route.Country = strings.ToUpper(strings.TrimSpace(route.Country))
+    
+    if route.Country != "" {
+        if _, ok := numbering.CallingCode(route.Country); !ok {
+            return nil, fmt.Errorf("%w: unknown country %s", ErrInvalid, route.Country)
+        }
+    }
+    
+    matcher := &routeMatcher{}
+    if route.DNISPattern != "" {
+        pattern, err := regexp.Compile(route.DNISPattern)
+        if err != nil {
+            return nil, fmt.Errorf("%w: invalid DNIS pattern: %v", ErrInvalid, err)
+        }
+        matcher.pattern = pattern
+    }
+    
+    sched, err := compileSchedule(route.Schedule)
+    if err != nil {
+        return nil, err
+    }
+    matcher.schedule = sched
+    
+    return matcher, nil
+}
+
+// matches reports whether a call from ani to dnis, both without a leading +,
+// meets every match criterion of route at time t. The DNIS pattern is
+// matched against the number without the +.
+func (rm *routeMatcher) matches(route *models.ProviderRoute, ani, dnis string, t time.Time) bool {
+    if !strings.HasPrefix(dnis, route.DNISPrefix) || !strings.HasPrefix(ani, route.ANIPrefix) {
+        return false
+    }
+    if route.Country != "" && numbering.Country(dnis) != route.Country {
+        return false
+    }
+    if rm == nil {
+        return true
+    }
+    if rm.pattern != nil && !rm.pattern.MatchString(dnis) {
+        return false
+    }
+    return rm.schedule.activeAt(t)
+}
+
+// routeRank orders routes from most to least specific. Elements are compared
+// in turn: how the DNIS is matched (pattern, prefix, country, not at all),
+// the length of the DNIS prefix, the length of the ANI prefix and finally the
+// route priority.
+func routeRank(route *models.ProviderRoute) [4]int {
+    dnisMatch := 0
+    switch {
+    case route.DNISPattern != "":
+        dnisMatch = 3
+    case route.DNISPrefix != "":
+        dnisMatch = 2
+    case route.Country != "":
+        dnisMatch = 1
+    }
+    return [4]int{dnisMatch, len(route.DNISPrefix), len(route.ANIPrefix), route.Priority}
+}
+
+// routeOutranks reports whether route a is more specific than route b. Routes
+// that rank the same are ordered by name so the choice is stable.
+func routeOutranks(a, b *models.ProviderRoute) bool {
+    rankA, rankB := routeRank(a), routeRank(b)
+    for i := range rankA {
+        if rankA[i] != rankB[i] {
+            return rankA[i] > rankB[i]
+        }
+    }
+    return a.Name < b.Name
+}
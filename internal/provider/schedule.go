@@ -0,0 +1,282 @@
+package provider
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// maxScheduleLookahead bounds the search for the next active time of a
+// schedule, so a route whose windows all fall on holidays is reported as
+// never active
+const maxScheduleLookahead = 366
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// schedule is a compiled models.RouteSchedule
+type schedule struct {
+    loc      *time.Location
+    windows  []scheduleWindow
+    holidays map[string]bool
+}
+
+type scheduleWindow struct {
+    days       [7]bool // by time.Weekday
+    start, end int     // minutes since midnight, end <= start runs past midnight
+}
+
+// compileSchedule checks a route schedule and compiles it, nil for a route
+// without one
+func compileSchedule(rs *models.RouteSchedule) (*schedule, error) {
+    if rs == nil {
+        return nil, nil
+    }
+    
+    s := &schedule{loc: time.UTC, holidays: make(map[string]bool)}
+    if rs.Timezone != "" {
+        loc, err := time.LoadLocation(rs.Timezone)
+        if err != nil {
+            return nil, fmt.Errorf("%w: unknown timezone %s", ErrInvalid, rs.Timezone)
+        }
+        s.loc = loc
+    }
+    
+    for _, w := range rs.Windows {
+        var sw scheduleWindow
+        if len(w.Days) == 0 {
+            sw.days = [7]bool{true, true, true, true, true, true, true}
+        }
+        for _, day := range w.Days {
+            d := weekdayIndex(day)
+            if d < 0 {
+                return nil, fmt.Errorf("%w: unknown weekday %s", ErrInvalid, day)
+            }
+            sw.days[d] = true
+        }
+        
+        var err error
+        if sw.start, err = parseClock(w.Start); err != nil {
+            return nil, err
+        }
+        if sw.end, err = parseClock(w.End); err != nil {
+            return nil, err
+        }
+        if sw.start == sw.end || sw.start == 24*60 {
+            return nil, fmt.Errorf("%w: empty schedule window %s-%s", ErrInvalid, w.Start, w.End)
+        }
+        s.windows = append(s.windows, sw)
+    }
+    
+    for _, date := range rs.Holidays {
+        if _, err := time.Parse("2006-01-02", date); err != nil {
+            return nil, fmt.Errorf("%w: invalid holiday %q, want YYYY-MM-DD", ErrInvalid, date)
+        }
+        s.holidays[date] = true
+    }
+    
+    return s, nil
+}
+
+// activeAt reports whether the schedule allows calls at t. A nil schedule
+// always does, as does one without windows except on its holidays.
+func (s *schedule) activeAt(t time.Time) bool {
+    if s == nil {
+        return true
+    }
+    
+    t = t.In(s.loc)
+    if s.holidays[t.Format("2006-01-02")] {
+        return false
+    }
+    if len(s.windows) == 0 {
+        return true
+    }
+    
+    minute := t.Hour()*60 + t.Minute()
+    today := t.Weekday()
+    yesterday := (today + 6) % 7
+    for _, w := range s.windows {
+        if w.start < w.end {
+            if w.days[today] && minute >= w.start && minute < w.end {
+                return true
+            }
+            continue
+        }
+        // Window running past midnight
+        if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+            return true
+        }
+    }
+    return false
+}
+
+// nextActive returns the first time at or after from when the schedule
+// allows calls, false if that is more than a year away
+func (s *schedule) nextActive(from time.Time) (time.Time, bool) {
+    if s.activeAt(from) {
+        return from, true
+    }
+    
+    // A schedule can only become active at midnight (the end of a holiday)
+    // or at the start of a window
+    local := from.In(s.loc)
+    day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.loc)
+    for i := 0; i <= maxScheduleLookahead; i++ {
+        var next time.Time
+        candidates := []time.Time{day}
+        for _, w := range s.windows {
+            candidates = append(candidates, time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, s.loc))
+        }
+        for _, c := range candidates {
+            if c.After(from) && s.activeAt(c) && (next.IsZero() || c.Before(next)) {
+                next = c
+            }
+        }
+        if !next.IsZero() {
+            return next, true
+        }
+        day = day.AddDate(0, 0, 1)
+    }
+    return time.Time{}, false
+}
+
+// NextActive returns when a route is next active, from itself if it is
+// active at that time. It is false for inactive routes and for schedules
+// that stay off for more than a year.
+func NextActive(route *models.ProviderRoute, from time.Time) (time.Time, bool, error) {
+    if !route.Active {
+        return time.Time{}, false, nil
+    }
+    
+    s, err := compileSchedule(route.Schedule)
+    if err != nil {
+        return time.Time{}, false, err
+    }
+    if s == nil {
+        return from, true, nil
+    }
+    
+    next, ok := s.nextActive(from)
+    return next, ok, nil
+}
+
+// ParseScheduleWindow parses a window such as "mon-fri 08:00-18:00",
+// "sat,sun 10:00-14:00" or "22:00-06:00" (every day, past midnight)
+func ParseScheduleWindow(spec string) (models.ScheduleWindow, error) {
+    var w models.ScheduleWindow
+    
+    fields := strings.Fields(spec)
+    if len(fields) == 0 || len(fields) > 2 {
+        return w, fmt.Errorf("%w: invalid schedule window %q", ErrInvalid, spec)
+    }
+    
+    times := fields[len(fields)-1]
+    if len(fields) == 2 {
+        for _, part := range strings.Split(strings.ToLower(fields[0]), ",") {
+            from, to, isRange := strings.Cut(part, "-")
+            first, last := weekdayIndex(from), weekdayIndex(to)
+            if !isRange {
+                last = first
+            }
+            if first < 0 || last < 0 {
+                return w, fmt.Errorf("%w: invalid weekdays %q", ErrInvalid, fields[0])
+            }
+            for d := first; ; d = (d + 1) % 7 {
+                w.Days = append(w.Days, weekdays[d])
+                if d == last {
+                    break
+                }
+            }
+        }
+    }
+    
+    var found bool
+    w.Start, w.End, found = strings.Cut(times, "-")
+    if !found {
+        return w, fmt.Errorf("%w: invalid time range %q, want HH:MM-HH:MM", ErrInvalid, times)
+    }
+    if _, err := parseClock(w.Start); err != nil {
+        return w, err
+    }
+    if _, err := parseClock(w.End); err != nil {
+        return w, err
+    }
+    return w, nil
+}
+
+// encodeSchedule returns the provider_routes.schedule column of a schedule
+func encodeSchedule(rs *models.RouteSchedule) (interface{}, error) {
+    if rs == nil {
+        return nil, nil
+    }
+    return json.Marshal(rs)
+}
+
+// decodeSchedule parses the provider_routes.schedule column, NULL being no
+// schedule
+func decodeSchedule(data []byte) (*models.RouteSchedule, error) {
+    if len(data) == 0 {
+        return nil, nil
+    }
+    rs := &models.RouteSchedule{}
+    if err := json.Unmarshal(data, rs); err != nil {
+        return nil, fmt.Errorf("invalid route schedule: %v", err)
+    }
+    return rs, nil
+}
+
+// DescribeSchedule returns a one-line summary of a route schedule
+func DescribeSchedule(rs *models.RouteSchedule) string {
+    if rs == nil {
+        return "always"
+    }
+    
+    var parts []string
+    for _, w := range rs.Windows {
+        if len(w.Days) == 0 {
+            parts = append(parts, w.Start+"-"+w.End)
+        } else {
+            parts = append(parts, strings.Join(w.Days, ",")+" "+w.Start+"-"+w.End)
+        }
+    }
+    if len(parts) == 0 {
+        parts = append(parts, "always")
+    }
+    
+    desc := strings.Join(parts, "; ")
+    if rs.Timezone != "" {
+        desc += " (" + rs.Timezone + ")"
+    }
+    if len(rs.Holidays) > 0 {
+        desc += ", except " + strings.Join(rs.Holidays, ", ")
+    }
+    return desc
+}
+
+// weekdayIndex returns the time.Weekday of a three-letter day name, -1 if
+// it is not one
+func weekdayIndex(day string) int {
+    day = strings.ToLower(strings.TrimSpace(day))
+    for i, name := range weekdays {
+        if day == name {
+            return i
+        }
+    }
+    return -1
+}
+
+// parseClock parses HH:MM into minutes since midnight; 24:00 is the end of
+// the day
+func parseClock(clock string) (int, error) {
+    hh, mm, found := strings.Cut(clock, ":")
+    h, errH := strconv.Atoi(hh)
+    m, errM := strconv.Atoi(mm)
+    if !found || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+        return 0, fmt.Errorf("%w: invalid time %q, want HH:MM", ErrInvalid, clock)
+    }
+    return h*60 + m, nil
+}
@@ -0,0 +1,172 @@
+package provider
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "time"
+    _ "time/tzdata"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestParseScheduleWindow(t *testing.T) {
+    tests := []struct {
+        spec string
+        want models.ScheduleWindow
+    }{
+        {"mon-fri 08:00-18:00", models.ScheduleWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"}},
+        {"sat,sun 10:00-14:00", models.ScheduleWindow{Days: []string{"sat", "sun"}, Start: "10:00", End: "14:00"}},
+        {"fri-mon 22:00-06:00", models.ScheduleWindow{Days: []string{"fri", "sat", "sun", "mon"}, Start: "22:00", End: "06:00"}},
+        {"22:00-06:00", models.ScheduleWindow{Start: "22:00", End: "06:00"}},
+        {"Mon 00:00-24:00", models.ScheduleWindow{Days: []string{"mon"}, Start: "00:00", End: "24:00"}},
+    }
+    for _, tt := range tests {
+        got, err := ParseScheduleWindow(tt.spec)
+        if err != nil {
+            t.Errorf("%q: %v", tt.spec, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%q: got %+v, want %+v", tt.spec, got, tt.want)
+        }
+    }
+    
+    for _, spec := range []string{"", "mon-fri", "xyz 08:00-18:00", "08:00", "25:00-26:00", "08:60-09:00", "mon fri 08:00-18:00"} {
+        if _, err := ParseScheduleWindow(spec); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%q: got %v, want ErrInvalid", spec, err)
+        }
+    }
+}
+
+func TestCompileScheduleErrors(t *testing.T) {
+    tests := []struct {
+        name     string
+        schedule models.RouteSchedule
+    }{
+        {"unknown timezone", models.RouteSchedule{Timezone: "Mars/Olympus"}},
+        {"unknown weekday", models.RouteSchedule{Windows: []models.ScheduleWindow{{Days: []string{"funday"}, Start: "08:00", End: "18:00"}}}},
+        {"empty window", models.RouteSchedule{Windows: []models.ScheduleWindow{{Start: "08:00", End: "08:00"}}}},
+        {"window starting at 24:00", models.RouteSchedule{Windows: []models.ScheduleWindow{{Start: "24:00", End: "06:00"}}}},
+        {"invalid holiday", models.RouteSchedule{Holidays: []string{"25/12/2024"}}},
+    }
+    for _, tt := range tests {
+        if _, err := compileSchedule(&tt.schedule); !errors.Is(err, ErrInvalid) {
+            t.Errorf("%s: got %v, want ErrInvalid", tt.name, err)
+        }
+    }
+}
+
+// testSchedule is open on weekdays during office hours and on Friday
+// nights past midnight, except on Christmas (a Wednesday in 2024)
+func testSchedule(t *testing.T, timezone string) *schedule {
+    t.Helper()
+    s, err := compileSchedule(&models.RouteSchedule{
+        Timezone: timezone,
+        Windows: []models.ScheduleWindow{
+            {Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"},
+            {Days: []string{"fri"}, Start: "22:00", End: "02:00"},
+        },
+        Holidays: []string{"2024-12-25"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s
+}
+
+func TestScheduleActiveAt(t *testing.T) {
+    s := testSchedule(t, "")
+    tests := []struct {
+        at   string
+        want bool
+    }{
+        {"2024-12-23 09:00", true},  // Monday
+        {"2024-12-23 07:59", false}, // before the window
+        {"2024-12-23 17:59", true},
+        {"2024-12-23 18:00", false}, // the end is exclusive
+        {"2024-12-25 10:00", false}, // holiday
+        {"2024-12-27 23:00", true},  // Friday night
+        {"2024-12-28 00:00", true},  // past midnight, into Saturday
+        {"2024-12-28 01:59", true},
+        {"2024-12-28 02:00", false},
+        {"2024-12-28 23:00", false}, // Saturday night is not in the window
+        {"2024-12-29 01:00", false}, // nor is the early Sunday after it
+        {"2024-12-26 23:00", false}, // Thursday night
+    }
+    for _, tt := range tests {
+        at, _ := time.Parse("2006-01-02 15:04", tt.at)
+        if got := s.activeAt(at); got != tt.want {
+            t.Errorf("%s: active %v, want %v", tt.at, got, tt.want)
+        }
+    }
+    
+    var always *schedule
+    if !always.activeAt(time.Now()) {
+        t.Error("a route without a schedule must always be active")
+    }
+}
+
+func TestScheduleMidnightHoliday(t *testing.T) {
+    // The holiday is the day the time falls on: a window that starts the
+    // night before runs into it
+    s := testSchedule(t, "")
+    s.holidays = map[string]bool{"2024-12-28": true}
+    
+    friday, _ := time.Parse("2006-01-02 15:04", "2024-12-27 23:00")
+    saturday, _ := time.Parse("2006-01-02 15:04", "2024-12-28 01:00")
+    if !s.activeAt(friday) || s.activeAt(saturday) {
+        t.Errorf("Friday 23:00 active %v, Saturday 01:00 active %v; want true, false",
+            s.activeAt(friday), s.activeAt(saturday))
+    }
+}
+
+func TestScheduleTimezone(t *testing.T) {
+    s := testSchedule(t, "America/New_York")
+    tests := []struct {
+        at   string // UTC
+        want bool
+    }{
+        {"2024-12-23 13:30", true},  // 08:30 in New York
+        {"2024-12-23 12:30", false}, // 07:30
+        {"2024-12-23 22:59", true},  // 17:59
+        {"2024-12-25 15:00", false}, // 10:00 on the holiday
+        {"2024-12-28 04:00", true},  // 23:00 Friday in New York, Saturday in UTC
+        {"2024-07-01 12:30", true},  // 08:30 in summer time
+    }
+    for _, tt := range tests {
+        at, _ := time.Parse("2006-01-02 15:04", tt.at)
+        if got := s.activeAt(at); got != tt.want {
+            t.Errorf("%s UTC: active %v, want %v", tt.at, got, tt.want)
+        }
+    }
+}
+
+func TestScheduleNextActive(t *testing.T) {
+    s := testSchedule(t, "")
+    holidayOnly, err := compileSchedule(&models.RouteSchedule{Holidays: []string{"2024-12-25"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    tests := []struct {
+        name     string
+        schedule *schedule
+        from     string
+        want     string
+    }{
+        {"already active", s, "2024-12-23 09:00", "2024-12-23 09:00"},
+        {"later the same day", s, "2024-12-23 06:00", "2024-12-23 08:00"},
+        {"over the holiday", s, "2024-12-24 19:00", "2024-12-26 08:00"},
+        {"Friday night", s, "2024-12-27 19:00", "2024-12-27 22:00"},
+        {"over the weekend", s, "2024-12-28 03:00", "2024-12-30 08:00"},
+        {"end of a holiday", holidayOnly, "2024-12-25 10:00", "2024-12-26 00:00"},
+    }
+    for _, tt := range tests {
+        from, _ := time.Parse("2006-01-02 15:04", tt.from)
+        next, ok := tt.schedule.nextActive(from)
+        if !ok || next.UTC().Format("2006-01-02 15:04") != tt.want {
+            t.Errorf("%s: next active %v (%v), want %s", tt.name, next, ok, tt.want)
+        }
+    }
+}
@@ -0,0 +1,247 @@
+package provider
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/numbering"
+)
+
+// Translation rule directions: inbound rules rewrite the numbers of calls
+// received from a provider, outbound rules those of calls sent to it
+const (
+    DirectionInbound  = "inbound"
+    DirectionOutbound = "outbound"
+)
+
+// FieldBoth makes a translation rule rewrite the ANI and the DNIS
+const FieldBoth = "both"
+
+// Translation rule actions
+const (
+    RuleStrip = "strip" // remove the prefix Value
+    RuleAdd   = "add"   // prepend Value
+    RuleRegex = "regex" // replace Pattern with Value
+    RuleE164  = "e164"  // normalize to E.164 for the country Value
+)
+
+// translation keys the rules of one provider and direction
+type translation struct {
+    provider, direction string
+}
+
+// numberRule is a translation rule with its pattern compiled
+type numberRule struct {
+    *models.NumberRule
+    pattern *regexp.Regexp // nil if the rule has none
+}
+
+// applies reports whether the rule rewrites the given field
+func (r *numberRule) applies(field string) bool {
+    return r.Field == FieldBoth || r.Field == field
+}
+
+// apply rewrites one number
+func (r *numberRule) apply(number string) string {
+    if number == "" {
+        return number
+    }
+    if r.Action == RuleRegex {
+        return r.pattern.ReplaceAllString(number, r.Value)
+    }
+    if r.pattern != nil && !r.pattern.MatchString(number) {
+        return number
+    }
+    
+    switch r.Action {
+    case RuleStrip:
+        return strings.TrimPrefix(number, r.Value)
+    case RuleAdd:
+        return r.Value + number
+    case RuleE164:
+        return numbering.E164(number, r.Value)
+    }
+    return number
+}
+
+// compileNumberRule checks a translation rule and compiles its pattern
+func compileNumberRule(rule *models.NumberRule) (*numberRule, error) {
+    if rule.Direction != DirectionInbound && rule.Direction != DirectionOutbound {
+        return nil, fmt.Errorf("%w: direction must be inbound or outbound", ErrInvalid)
+    }
+    if rule.Field == "" {
+        rule.Field = FieldBoth
+    }
+    if rule.Field != FieldANI && rule.Field != FieldDNIS && rule.Field != FieldBoth {
+        return nil, fmt.Errorf("%w: field must be ani, dnis or both", ErrInvalid)
+    }
+    
+    switch rule.Action {
+    case RuleStrip, RuleAdd:
+        if rule.Value == "" {
+            return nil, fmt.Errorf("%w: %s rules need a prefix", ErrInvalid, rule.Action)
+        }
+    case RuleRegex:
+        if rule.Pattern == "" {
+            return nil, fmt.Errorf("%w: regex rules need a pattern", ErrInvalid)
+        }
+    case RuleE164:
+        rule.Value = strings.ToUpper(strings.TrimSpace(rule.Value))
+        if _, ok := numbering.CallingCode(rule.Value); !ok {
+            return nil, fmt.Errorf("%w: unknown country %q", ErrInvalid, rule.Value)
+        }
+    default:
+        return nil, fmt.Errorf("%w: action must be strip, add, regex or e164", ErrInvalid)
+    }
+    
+    compiled := &numberRule{NumberRule: rule}
+    if rule.Pattern != "" {
+        pattern, err := regexp.Compile(rule.Pattern)
+        if err != nil {
+            return nil, fmt.Errorf("%w: invalid pattern: %v", ErrInvalid, err)
+        }
+        compiled.pattern = pattern
+    }
+    return compiled, nil
+}
+
+// Translate rewrites the ANI and DNIS of a call received from (inbound) or
+// sent to (outbound) a provider with its rules for that direction. Numbers
+// are returned unchanged if the provider has none.
+func (m *Manager) Translate(providerName, direction, ani, dnis string) (string, string) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    
+    for _, rule := range m.translations[translation{providerName, direction}] {
+        if rule.applies(FieldANI) {
+            ani = rule.apply(ani)
+        }
+        if rule.applies(FieldDNIS) {
+            dnis = rule.apply(dnis)
+        }
+    }
+    return ani, dnis
+}
+
+// AddNumberRule adds a translation rule to a provider. A rule without a
+// position goes after the provider's other rules for the direction.
+func (m *Manager) AddNumberRule(rule *models.NumberRule) error {
+    if _, err := m.GetProvider(rule.ProviderName); err != nil {
+        return fmt.Errorf("%w: provider %s not found", ErrInvalid, rule.ProviderName)
+    }
+    if _, err := compileNumberRule(rule); err != nil {
+        return err
+    }
+    
+    if rule.Position <= 0 {
+        err := db.DB.QueryRow(`
+            SELECT COALESCE(MAX(position), 0) + 1 FROM number_rules
+            WHERE provider_name = ? AND direction = ?`,
+            rule.ProviderName, rule.Direction).Scan(&rule.Position)
+        if err != nil {
+            return err
+        }
+    }
+    
+    result, err := db.DB.Exec(`
+        INSERT INTO number_rules (provider_name, direction, field, action, pattern, value, position)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        rule.ProviderName, rule.Direction, rule.Field, rule.Action, rule.Pattern, rule.Value, rule.Position)
+    if err != nil {
+        return err
+    }
+    if id, err := result.LastInsertId(); err == nil {
+        rule.ID = int(id)
+    }
+    
+    if err := m.LoadNumberRules(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Added %s %s rule %d for provider %s", rule.Direction, rule.Action, rule.ID, rule.ProviderName)
+    return nil
+}
+
+// DeleteNumberRule removes a translation rule
+func (m *Manager) DeleteNumberRule(id int) error {
+    result, err := db.DB.Exec("DELETE FROM number_rules WHERE id = ?", id)
+    if err != nil {
+        return err
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("translation rule %d %w", id, ErrNotFound)
+    }
+    
+    if err := m.LoadNumberRules(); err != nil {
+        return err
+    }
+    
+    bumpConfigVersion()
+    
+    log.Infof("Deleted translation rule %d", id)
+    return nil
+}
+
+// ListNumberRules returns the translation rules of a provider, or of all
+// providers if providerName is empty, in the order they apply
+func (m *Manager) ListNumberRules(providerName string) ([]*models.NumberRule, error) {
+    query := `
+        SELECT id, provider_name, direction, field, action, pattern, value, position, created_at
+        FROM number_rules`
+    var args []interface{}
+    if providerName != "" {
+        query += " WHERE provider_name = ?"
+        args = append(args, providerName)
+    }
+    query += " ORDER BY provider_name, direction, position, id"
+    
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var rules []*models.NumberRule
+    for rows.Next() {
+        rule := &models.NumberRule{}
+        err := rows.Scan(&rule.ID, &rule.ProviderName, &rule.Direction, &rule.Field, &rule.Action,
+            &rule.Pattern, &rule.Value, &rule.Position, &rule.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+        rules = append(rules, rule)
+    }
+    return rules, rows.Err()
+}
+
+// LoadNumberRules reads the translation rules into memory. Rules that no
+// longer compile are skipped.
+func (m *Manager) LoadNumberRules() error {
+    rules, err := m.ListNumberRules("")
+    if err != nil {
+        return err
+    }
+    
+    translations := make(map[translation][]*numberRule)
+    for _, rule := range rules {
+        compiled, err := compileNumberRule(rule)
+        if err != nil {
+            log.Errorf("Skipping translation rule %d of provider %s: %v", rule.ID, rule.ProviderName, err)
+            continue
+        }
+        key := translation{rule.ProviderName, rule.Direction}
+        translations[key] = append(translations[key], compiled)
+    }
+    
+    m.mu.Lock()
+    m.translations = translations
+    m.mu.Unlock()
+    
+    log.Infof("Loaded %d translation rules", len(rules))
+    return nil
+}
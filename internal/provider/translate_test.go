@@ -0,0 +1,107 @@
+package provider
+
+import (
+    "errors"
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestCompileNumberRule(t *testing.T) {
+    tests := []struct {
+        name string
+        rule models.NumberRule
+        ok   bool
+    }{
+        {"strip", models.NumberRule{Direction: DirectionInbound, Action: RuleStrip, Value: "9"}, true},
+        {"e164 country in lower case", models.NumberRule{Direction: DirectionOutbound, Action: RuleE164, Value: " gb "}, true},
+        {"unknown direction", models.NumberRule{Direction: "both", Action: RuleAdd, Value: "1"}, false},
+        {"unknown field", models.NumberRule{Direction: DirectionInbound, Field: "route", Action: RuleAdd, Value: "1"}, false},
+        {"add without a prefix", models.NumberRule{Direction: DirectionInbound, Action: RuleAdd}, false},
+        {"regex without a pattern", models.NumberRule{Direction: DirectionInbound, Action: RuleRegex, Value: "1"}, false},
+        {"invalid pattern", models.NumberRule{Direction: DirectionInbound, Action: RuleRegex, Pattern: "(["}, false},
+        {"unknown country", models.NumberRule{Direction: DirectionInbound, Action: RuleE164, Value: "ZZ"}, false},
+        {"unknown action", models.NumberRule{Direction: DirectionInbound, Action: "swap"}, false},
+    }
+    
+    for _, tt := range tests {
+        rule := tt.rule
+        _, err := compileNumberRule(&rule)
+        if tt.ok && err != nil {
+            t.Errorf("%s: unexpected error %v", tt.name, err)
+        }
+        if !tt.ok && !errors.Is(err, ErrInvalid) {
+            t.Errorf("%s: got %v, want ErrInvalid", tt.name, err)
+        }
+    }
+    
+    rule := models.NumberRule{Direction: DirectionOutbound, Action: RuleE164, Value: " gb "}
+    if _, err := compileNumberRule(&rule); err != nil || rule.Field != FieldBoth || rule.Value != "GB" {
+        t.Errorf("got field %q, country %q (%v); want both, GB", rule.Field, rule.Value, err)
+    }
+}
+
+func mustCompileNumberRule(t *testing.T, rule models.NumberRule) *numberRule {
+    t.Helper()
+    if rule.Direction == "" {
+        rule.Direction = DirectionInbound
+    }
+    compiled, err := compileNumberRule(&rule)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return compiled
+}
+
+func TestNumberRuleApply(t *testing.T) {
+    tests := []struct {
+        name   string
+        rule   models.NumberRule
+        number string
+        want   string
+    }{
+        {"strip", models.NumberRule{Action: RuleStrip, Value: "9"}, "9442071234567", "442071234567"},
+        {"strip without the prefix", models.NumberRule{Action: RuleStrip, Value: "9"}, "442071234567", "442071234567"},
+        {"add", models.NumberRule{Action: RuleAdd, Value: "44"}, "2071234567", "442071234567"},
+        {"add limited by pattern", models.NumberRule{Action: RuleAdd, Value: "1", Pattern: `^\d{10}$`}, "2125551234", "12125551234"},
+        {"pattern not matched", models.NumberRule{Action: RuleAdd, Value: "1", Pattern: `^\d{10}$`}, "12125551234", "12125551234"},
+        {"regex", models.NumberRule{Action: RuleRegex, Pattern: `^0(\d+)$`, Value: "33$1"}, "0612345678", "33612345678"},
+        {"regex not matched", models.NumberRule{Action: RuleRegex, Pattern: `^0(\d+)$`, Value: "33$1"}, "33612345678", "33612345678"},
+        {"e164", models.NumberRule{Action: RuleE164, Value: "GB"}, "02071234567", "442071234567"},
+        {"e164 plus", models.NumberRule{Action: RuleE164, Value: "US"}, "+442071234567", "442071234567"},
+        {"empty number", models.NumberRule{Action: RuleAdd, Value: "1"}, "", ""},
+    }
+    
+    for _, tt := range tests {
+        if got := mustCompileNumberRule(t, tt.rule).apply(tt.number); got != tt.want {
+            t.Errorf("%s: %q became %q, want %q", tt.name, tt.number, got, tt.want)
+        }
+    }
+}
+
+func TestTranslate(t *testing.T) {
+    m := NewManager()
+    m.translations[translation{"in1", DirectionInbound}] = []*numberRule{
+        mustCompileNumberRule(t, models.NumberRule{Field: FieldDNIS, Action: RuleStrip, Value: "9"}),
+        mustCompileNumberRule(t, models.NumberRule{Action: RuleE164, Value: "GB"}),
+        mustCompileNumberRule(t, models.NumberRule{Field: FieldANI, Action: RuleAdd, Value: "+"}),
+    }
+    
+    tests := []struct {
+        provider, direction string
+        ani, dnis           string
+        wantANI, wantDNIS   string
+    }{
+        // Rules apply in order: the 9 goes before the trunk 0 is replaced
+        {"in1", DirectionInbound, "07700900123", "902071234567", "+447700900123", "442071234567"},
+        {"in1", DirectionOutbound, "07700900123", "902071234567", "07700900123", "902071234567"},
+        {"in2", DirectionInbound, "07700900123", "902071234567", "07700900123", "902071234567"},
+    }
+    
+    for _, tt := range tests {
+        ani, dnis := m.Translate(tt.provider, tt.direction, tt.ani, tt.dnis)
+        if ani != tt.wantANI || dnis != tt.wantDNIS {
+            t.Errorf("%s %s: got %s, %s; want %s, %s", tt.provider, tt.direction, ani, dnis, tt.wantANI, tt.wantDNIS)
+        }
+    }
+}
@@ -0,0 +1,42 @@
+package router
+
+import (
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+)
+
+// ProcessDialResult records the outcome of a Dial towards a provider, as
+// reported by the dialplan after the Dial or from the hangup handler, on the
+// provider's stats and on the call leg. The S3 return leg passes the DID it
+// came in on. timing feeds the provider's quality score. It returns false if
+// DIALSTATUS and HANGUPCAUSE said nothing about the provider (e.g. the caller
+// cancelled); only the leg is closed then.
+func (r *Router) ProcessDialResult(callID, did, providerName, dialStatus, cause string, timing loadbalancer.DialTiming) (loadbalancer.DialOutcome, bool) {
+    outcome, ok := loadbalancer.ClassifyDial(dialStatus, cause)
+    
+    clog := log.WithFields(logger.Fields{
+        "call_id":     callID,
+        "step":        "DIAL",
+        "provider":    providerName,
+        "dial_status": dialStatus,
+        "cause":       cause,
+    })
+    
+    if providerName != "" {
+        r.closeLeg(callID, did, providerName, dialStatus, cause, string(outcome))
+    }
+    
+    if !ok || providerName == "" {
+        clog.Debugf("Dial result not attributable to a provider")
+        return "", false
+    }
+    
+    r.loadBalancer.RecordDialOutcome(providerName, outcome, timing)
+    
+    if outcome.CarrierFailure() {
+        clog.Warnf("Dial failed: %s", outcome)
+    } else {
+        clog.Infof("Dial result: %s", outcome)
+    }
+    return outcome, true
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+    "errors"
+)
+
+var (
+    // ErrDIDPoolExhausted is returned when no free DID is left to assign to a call
+    ErrDIDPoolExhausted = errors.New("DID pool exhausted")
+    
+    // ErrDIDNotFound is returned when a DID is not in the pool at all
+    ErrDIDNotFound = errors.New("not found")
+    
+    // ErrNoRetry is returned when a failed Dial is not retried, because the
+    // failure was not the carrier's, the attempts are used up or no other
+    // provider is left in the pool
+    ErrNoRetry = errors.New("no retry")
+    
+    // ErrChannelLimit is returned when an inbound provider already has its
+    // maximum number of calls in flight
+    ErrChannelLimit = errors.New("channel limit reached")
+    
+    // ErrCPSLimit is returned when an inbound provider sends calls faster
+    // than its calls-per-second limit
+    ErrCPSLimit = errors.New("CPS limit reached")
+    
+    // ErrCallBlocked is returned when a fraud rule or the number lists
+    // block a call
+    ErrCallBlocked = errors.New("call blocked")
+    
+    // ErrVerificationFailed is returned when a return leg fails ANI/DNIS
+    // verification on a route with the reject policy
+    ErrVerificationFailed = errors.New("verification failed")
+)
+
+// RejectCause returns the SIP response and matching Q.850 hangup cause the
+// dialplan should refuse a call or return leg with, for errors that carry one
+func RejectCause(err error) (sipCode, hangupCause int, ok bool) {
+    var limitErr *LimitError
+    if errors.As(err, &limitErr) {
+        return limitErr.SIPCode, limitErr.HangupCause, true
+    }
+    var blockedErr *BlockedError
+    if errors.As(err, &blockedErr) {
+        return blockedErr.SIPCode, blockedErr.HangupCause, true
+    }
+    var verifyErr *VerificationError
+    if errors.As(err, &verifyErr) {
+        return verificationSIPCode, hangupCauses[verificationSIPCode], true
+    }
+    return 0, 0, false
+}
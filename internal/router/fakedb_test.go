@@ -0,0 +1,121 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "io"
+    "strings"
+    "sync"
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+)
+
+// fakeDB stands in for MySQL: it records every statement run and answers
+// queries with the rows set for them. Queries without rows return none.
+type fakeDB struct {
+    mu    sync.Mutex
+    execs []fakeExec
+    rows  map[string]fakeRows // by a substring of the query
+}
+
+type fakeExec struct {
+    query string
+    args  []driver.Value
+}
+
+type fakeRows struct {
+    columns []string
+    values  [][]driver.Value
+}
+
+// useFakeDB points db.DB at a new fakeDB for the length of the test
+func useFakeDB(t *testing.T) *fakeDB {
+    t.Helper()
+    fake := &fakeDB{rows: make(map[string]fakeRows)}
+    old := db.DB
+    db.DB = sql.OpenDB(fake)
+    t.Cleanup(func() {
+        db.DB.Close()
+        db.DB = old
+    })
+    return fake
+}
+
+// execsOf returns the statements run that contain substr
+func (f *fakeDB) execsOf(substr string) []fakeExec {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    
+    var matched []fakeExec
+    for _, exec := range f.execs {
+        if strings.Contains(exec.query, substr) {
+            matched = append(matched, exec)
+        }
+    }
+    return matched
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+    return nil, errors.New("fake database: open through sql.OpenDB")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.db, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+    return nil, errors.New("fake database: transactions not supported")
+}
+
+type fakeStmt struct {
+    db    *fakeDB
+    query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+    s.db.mu.Lock()
+    defer s.db.mu.Unlock()
+    
+    s.db.execs = append(s.db.execs, fakeExec{s.query, args})
+    return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+    s.db.mu.Lock()
+    defer s.db.mu.Unlock()
+    
+    for substr, rows := range s.db.rows {
+        if strings.Contains(s.query, substr) {
+            return &fakeCursor{rows: rows}, nil
+        }
+    }
+    return &fakeCursor{}, nil
+}
+
+type fakeCursor struct {
+    rows fakeRows
+    next int
+}
+
+func (c *fakeCursor) Columns() []string { return c.rows.columns }
+func (c *fakeCursor) Close() error      { return nil }
+
+func (c *fakeCursor) Next(dest []driver.Value) error {
+    if c.next >= len(c.rows.values) {
+        return io.EOF
+    }
+    copy(dest, c.rows.values[c.next])
+    c.next++
+    return nil
+}
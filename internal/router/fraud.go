@@ -0,0 +1,98 @@
+package router
+
+import (
+    "fmt"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/fraud"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// DefaultBlockSIPCode is the SIP response sent for blocked calls
+const DefaultBlockSIPCode = 403
+
+// BlockedError is returned by ProcessIncomingCall for a call refused by a
+// fraud rule or the number lists
+type BlockedError struct {
+    Rule        string
+    Reason      string
+    SIPCode     int // SIP response the dialplan should reject with
+    HangupCause int // Q.850 cause passed to Hangup() to get SIPCode
+}
+
+func (e *BlockedError) Error() string {
+    return fmt.Sprintf("call blocked by rule %s: %s", e.Rule, e.Reason)
+}
+
+func (e *BlockedError) Unwrap() error {
+    return ErrCallBlocked
+}
+
+// screenCall runs a new call through the fraud rules. Alerts are logged;
+// the first blocking rule rejects the call, which is stored in
+// blocked_calls. Caller must hold r.mu.
+func (r *Router) screenCall(callID, ani, dnis, inboundProvider string, clog *logger.Entry) error {
+    if r.fraud == nil {
+        return nil
+    }
+    
+    var blocked *fraud.Hit
+    for _, hit := range r.fraud.Check(fraud.Call{ANI: ani, DNIS: dnis, Provider: inboundProvider}) {
+        hit := hit
+        hlog := clog.WithFields(logger.Fields{"rule": hit.Rule, "ani": ani, "dnis": dnis})
+        if hit.Action == fraud.ActionBlock {
+            hlog.Warnf("Fraud rule blocked call: %s", hit.Reason)
+            if blocked == nil {
+                blocked = &hit
+            }
+        } else {
+            hlog.Warnf("Fraud alert: %s", hit.Reason)
+        }
+    }
+    if blocked == nil {
+        return nil
+    }
+    return r.blockCall(callID, ani, dnis, inboundProvider, blocked.Rule, blocked.Reason, clog)
+}
+
+// screenNumbers refuses a call whose ANI or DNIS is on a blocklist, or
+// missing from an allowlist, of its inbound provider or route
+func (r *Router) screenNumbers(callID, ani, dnis, inboundProvider, routeName string, clog *logger.Entry) error {
+    refusal := r.providerMgr.ScreenNumbers(inboundProvider, routeName, ani, dnis)
+    if refusal == nil {
+        return nil
+    }
+    clog.WithFields(logger.Fields{"ani": ani, "dnis": dnis}).Warnf("Call refused by %s: %s", refusal.Rule(), refusal.Reason())
+    return r.blockCall(callID, ani, dnis, inboundProvider, refusal.Rule(), refusal.Reason(), clog)
+}
+
+// blockCall stores a refused call in blocked_calls and returns its error
+func (r *Router) blockCall(callID, ani, dnis, inboundProvider, rule, reason string, clog *logger.Entry) error {
+    if _, err := db.DB.Exec(`
+        INSERT INTO blocked_calls (call_id, ani, dnis, inbound_provider, rule_name, reason, node_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        callID, ani, dnis, inboundProvider, rule, reason, r.nodeID); err != nil {
+        clog.Errorf("Failed to store blocked call: %v", err)
+    }
+    
+    return &BlockedError{
+        Rule:        rule,
+        Reason:      reason,
+        SIPCode:     r.blockSIPCode,
+        HangupCause: hangupCauses[r.blockSIPCode],
+    }
+}
+
+// callEnded feeds the length of an answered call to the fraud rules
+func (r *Router) callEnded(record *models.CallRecord) {
+    if r.fraud == nil {
+        return
+    }
+    r.fraud.CallEnded(fraud.Call{
+        ANI:      record.OriginalANI,
+        DNIS:     record.OriginalDNIS,
+        Provider: record.InboundProvider,
+    }, time.Duration(record.Duration)*time.Second)
+}
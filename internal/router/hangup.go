@@ -0,0 +1,166 @@
+package router
+
+import (
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Final call_records statuses set from a hangup
+const (
+    StatusCompleted = "COMPLETED"
+    StatusFailed    = "FAILED"
+    StatusNoAnswer  = "NO_ANSWER"
+    StatusBusy      = "BUSY"
+    StatusCancelled = "CANCELLED"
+)
+
+// Q.850 hangup causes used to classify a hangup when DIALSTATUS is missing
+const (
+    causeNormalClearing = "16"
+    causeUserBusy       = "17"
+    causeNoUserResponse = "18"
+    causeNoAnswer       = "19"
+)
+
+// ProcessHangup closes an in-flight call when one of its channels hangs up.
+// callID is the UNIQUEID of the S1 leg; the S3 return leg reports the DID it
+// was dialled on instead. cause is HANGUPCAUSE and dialStatus the DIALSTATUS
+// of the last Dial on that channel, and talk its ANSWEREDTIME, which the call
+// is rated on. Calls that already completed are ignored.
+func (r *Router) ProcessHangup(callID, did, cause, dialStatus string, talk time.Duration) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    
+    record, err := r.store.Get(callID)
+    if err == callstate.ErrNotFound && did != "" {
+        record, err = r.store.GetByDID(did)
+    }
+    if err == callstate.ErrNotFound {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    
+    // Claim the call; another node or the final leg may have closed it already
+    if err := r.store.Delete(record.CallID); err != nil {
+        if err == callstate.ErrNotFound {
+            return nil
+        }
+        return err
+    }
+    
+    status := hangupStatus(dialStatus, cause)
+    duration := time.Since(record.StartTime)
+    
+    // A call that never came back from S3 failed on the intermediate
+    // provider, one that did failed on the final provider. The provider's
+    // success and failure counts come from the Dial outcome (ProcessDialResult),
+    // or from failUnreportedLegs if none was reported.
+    failedProvider := record.IntermediateProvider
+    if record.CurrentStep != "S1_TO_S2" {
+        failedProvider = record.FinalProvider
+    }
+    
+    clog := log.WithFields(logger.Fields{
+        "call_id":  record.CallID,
+        "step":     record.CurrentStep,
+        "provider": failedProvider,
+    })
+    
+    if status == StatusCompleted {
+        r.loadBalancer.RecordCallDuration(record.IntermediateProvider, duration)
+        r.loadBalancer.RecordCallDuration(record.FinalProvider, duration)
+    }
+    r.countActiveCall(record, -1)
+    
+    if status != StatusCompleted {
+        r.failUnreportedLegs(record, cause, clog)
+    }
+    
+    if err := r.releaseDID(record.AssignedDID); err != nil {
+        clog.Errorf("Failed to release DID %s: %v", record.AssignedDID, err)
+    }
+    
+    r.closeCallRecord(record, status, cause, duration, talk)
+    
+    clog.WithFields(logger.Fields{
+        "status":      status,
+        "cause":       cause,
+        "dial_status": dialStatus,
+    }).Infof("Call closed by hangup")
+    return nil
+}
+
+// failUnreportedLegs counts the Dials of a failed call that never reported
+// a result, e.g. because the channel died during the Dial or the AGI call
+// failed, against their providers. The hangup cause decides the outcome if
+// it can; otherwise the provider never answered and it is a carrier failure.
+func (r *Router) failUnreportedLegs(record *models.CallRecord, cause string, clog *logger.Entry) {
+    providers, err := r.unreportedLegs(record.CallID)
+    if err != nil {
+        clog.Errorf("Failed to load call legs: %v", err)
+        return
+    }
+    
+    outcome, ok := loadbalancer.ClassifyDial("", cause)
+    if !ok {
+        outcome = loadbalancer.OutcomeChanUnavail
+    }
+    
+    for _, providerName := range providers {
+        r.loadBalancer.RecordDialOutcome(providerName, outcome, loadbalancer.DialTiming{})
+        r.closeLeg(record.CallID, record.AssignedDID, providerName, "", cause, string(outcome))
+        clog.WithField("provider", providerName).Warnf("No Dial result reported, recorded as %s", outcome)
+    }
+}
+
+// closeCallRecord writes the final status of a call. The current step is
+// left as the step the call reached.
+func (r *Router) closeCallRecord(record *models.CallRecord, status, cause string, duration, talk time.Duration) {
+    now := time.Now()
+    record.Status = status
+    record.HangupCause = cause
+    record.EndTime = &now
+    record.Duration = int(duration.Seconds())
+    record.Billsec = int(talk.Seconds())
+    if status == StatusCompleted {
+        r.rateCall(record)
+        r.callEnded(record)
+    }
+    
+    if err := r.updateCallRecord(record); err != nil {
+        log.WithField("call_id", record.CallID).Errorf("Failed to update call record: %v", err)
+    }
+}
+
+// hangupStatus maps Asterisk's DIALSTATUS, falling back to the Q.850 cause,
+// onto a call_records status
+func hangupStatus(dialStatus, cause string) string {
+    switch dialStatus {
+    case "ANSWER":
+        return StatusCompleted
+    case "BUSY":
+        return StatusBusy
+    case "NOANSWER":
+        return StatusNoAnswer
+    case "CANCEL":
+        return StatusCancelled
+    case "CHANUNAVAIL", "CONGESTION", "INVALIDARGS", "DONTCALL", "TORTURE":
+        return StatusFailed
+    }
+    
+    switch cause {
+    case causeUserBusy:
+        return StatusBusy
+    case causeNoUserResponse, causeNoAnswer:
+        return StatusNoAnswer
+    case causeNormalClearing:
+        return StatusCompleted
+    }
+    return StatusFailed
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+    "database/sql"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Outbound legs of a call
+const (
+    legToS3 = "S2_TO_S3"
+    legToS4 = "S2_TO_S4"
+)
+
+// openLeg records a Dial attempt towards a provider
+func (r *Router) openLeg(callID, step, providerName, did string) {
+    _, err := db.DB.Exec(`
+        INSERT INTO call_legs (call_id, leg_number, step, provider, did)
+        SELECT ?, COALESCE(MAX(leg_number), 0) + 1, ?, ?, ?
+        FROM call_legs WHERE call_id = ?`,
+        callID, step, providerName, did, callID)
+    if err != nil {
+        log.WithFields(logger.Fields{"call_id": callID, "step": step, "provider": providerName}).Errorf("Failed to record call leg: %v", err)
+    }
+}
+
+// closeLeg stores the Dial result on the newest open leg towards the
+// provider. The S3 return channel does not know the call ID, so its S4 leg
+// is found by the DID the call came back on.
+func (r *Router) closeLeg(callID, did, providerName, dialStatus, cause, outcome string) {
+    _, err := db.DB.Exec(`
+        UPDATE call_legs
+        SET dial_status = ?, hangup_cause = ?, outcome = ?, end_time = NOW()
+        WHERE (call_id = ? OR (did = ? AND step = ?))
+          AND provider = ? AND end_time IS NULL
+        ORDER BY id DESC LIMIT 1`,
+        dialStatus, cause, outcome, callID, did, legToS4, providerName)
+    if err != nil {
+        log.WithFields(logger.Fields{"call_id": callID, "provider": providerName}).Errorf("Failed to close call leg: %v", err)
+    }
+}
+
+// triedProviders returns the providers a call has already dialled on a leg
+func (r *Router) triedProviders(callID, step string) (map[string]bool, error) {
+    rows, err := db.DB.Query(`SELECT provider FROM call_legs WHERE call_id = ? AND step = ?`, callID, step)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    tried := make(map[string]bool)
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, err
+        }
+        tried[name] = true
+    }
+    return tried, rows.Err()
+}
+
+// unreportedLegs returns the providers of a call's legs that have no Dial
+// result yet
+func (r *Router) unreportedLegs(callID string) ([]string, error) {
+    rows, err := db.DB.Query(`SELECT provider FROM call_legs WHERE call_id = ? AND end_time IS NULL`, callID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var providers []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, err
+        }
+        providers = append(providers, name)
+    }
+    return providers, rows.Err()
+}
+
+// ListCallLegs returns the Dial attempts of a call in order
+func (r *Router) ListCallLegs(callID string) ([]*models.CallLeg, error) {
+    rows, err := db.DB.Query(`
+        SELECT id, call_id, leg_number, step, provider, did, dial_status,
+               hangup_cause, outcome, start_time, end_time
+        FROM call_legs
+        WHERE call_id = ?
+        ORDER BY leg_number`, callID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var legs []*models.CallLeg
+    for rows.Next() {
+        var did, dialStatus, cause, outcome sql.NullString
+        var endTime sql.NullTime
+        leg := &models.CallLeg{}
+        
+        err := rows.Scan(&leg.ID, &leg.CallID, &leg.LegNumber, &leg.Step, &leg.Provider,
+            &did, &dialStatus, &cause, &outcome, &leg.StartTime, &endTime)
+        if err != nil {
+            return nil, err
+        }
+        
+        leg.DID = did.String
+        leg.DialStatus = dialStatus.String
+        leg.HangupCause = cause.String
+        leg.Outcome = outcome.String
+        if endTime.Valid {
+            leg.EndTime = &endTime.Time
+        }
+        legs = append(legs, leg)
+    }
+    
+    return legs, rows.Err()
+}
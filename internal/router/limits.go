@@ -0,0 +1,211 @@
+package router
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// Inbound limits a call can be rejected by
+const (
+    LimitChannels = "channels"
+    LimitCPS      = "cps"
+)
+
+// DefaultRejectSIPCode is the SIP response sent for calls over an inbound limit
+const DefaultRejectSIPCode = 503
+
+// hangupCauses maps the SIP responses a rejected call may get to the
+// Q.850 cause chan_pjsip turns into that response on Hangup()
+var hangupCauses = map[int]int{
+    403: 21, // Call rejected
+    404: 1,  // Unallocated number
+    480: 19, // No answer
+    486: 17, // User busy
+    503: 34, // No circuit available
+}
+
+// LimitError is returned by ProcessIncomingCall when the inbound provider
+// is at its channel or calls-per-second limit
+type LimitError struct {
+    Provider    string
+    Limit       string // LimitChannels or LimitCPS
+    Max         int
+    SIPCode     int // SIP response the dialplan should reject with
+    HangupCause int // Q.850 cause passed to Hangup() to get SIPCode
+}
+
+func (e *LimitError) Error() string {
+    return fmt.Sprintf("inbound provider %s is at its %s limit of %d", e.Provider, e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+    if e.Limit == LimitCPS {
+        return ErrCPSLimit
+    }
+    return ErrChannelLimit
+}
+
+// inboundLimits enforces the channel and CPS limits of inbound providers
+// and counts the calls they reject
+type inboundLimits struct {
+    mu         sync.Mutex
+    sipCodes   map[string]int
+    arrivals   map[string][]time.Time // accepted calls of the last second
+    rejections map[string]map[string]int64
+}
+
+func newInboundLimits(channelsSIPCode, cpsSIPCode int) *inboundLimits {
+    return &inboundLimits{
+        sipCodes: map[string]int{
+            LimitChannels: rejectSIPCode("channel limit", channelsSIPCode, DefaultRejectSIPCode),
+            LimitCPS:      rejectSIPCode("CPS limit", cpsSIPCode, DefaultRejectSIPCode),
+        },
+        arrivals:   make(map[string][]time.Time),
+        rejections: make(map[string]map[string]int64),
+    }
+}
+
+// rejectSIPCode checks a configured SIP response, falling back to def for
+// ones Asterisk cannot be made to send
+func rejectSIPCode(what string, code, def int) int {
+    if code == 0 {
+        return def
+    }
+    if _, ok := hangupCauses[code]; !ok {
+        log.Warnf("Unsupported SIP code %d for the %s, using %d", code, what, def)
+        return def
+    }
+    return code
+}
+
+// admit checks a new call of an inbound provider that already has active
+// calls in flight. The call only counts towards the CPS limit once it is
+// accepted (see arrived), so calls refused later on do not use up the limit.
+func (l *inboundLimits) admit(p *models.Provider, active int, now time.Time) error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    
+    if p.MaxChannels > 0 && active >= p.MaxChannels {
+        return l.reject(p.Name, LimitChannels, p.MaxChannels)
+    }
+    
+    if p.MaxCPS > 0 && len(l.window(p.Name, now)) >= p.MaxCPS {
+        return l.reject(p.Name, LimitCPS, p.MaxCPS)
+    }
+    
+    return nil
+}
+
+// arrived counts an accepted call of an inbound provider towards its CPS limit
+func (l *inboundLimits) arrived(provider string, now time.Time) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    
+    l.arrivals[provider] = append(l.window(provider, now), now)
+}
+
+// window returns the accepted calls of a provider in the second before now.
+// Caller must hold l.mu.
+func (l *inboundLimits) window(provider string, now time.Time) []time.Time {
+    window := l.arrivals[provider]
+    cutoff := now.Add(-time.Second)
+    for len(window) > 0 && !window[0].After(cutoff) {
+        window = window[1:]
+    }
+    l.arrivals[provider] = window
+    return window
+}
+
+// reject counts a rejected call and builds its error. Caller must hold l.mu.
+func (l *inboundLimits) reject(provider, limit string, max int) error {
+    if l.rejections[provider] == nil {
+        l.rejections[provider] = make(map[string]int64)
+    }
+    l.rejections[provider][limit]++
+    
+    // provider_stats keeps the total across restarts and cluster nodes
+    if _, err := db.DB.Exec(`
+        INSERT INTO provider_stats (provider_name, rejected_calls)
+        VALUES (?, 1)
+        ON DUPLICATE KEY UPDATE rejected_calls = rejected_calls + 1`, provider); err != nil {
+        log.Errorf("Failed to count rejected call of %s: %v", provider, err)
+    }
+    
+    code := l.sipCodes[limit]
+    return &LimitError{
+        Provider:    provider,
+        Limit:       limit,
+        Max:         max,
+        SIPCode:     code,
+        HangupCause: hangupCauses[code],
+    }
+}
+
+// snapshot returns the rejected calls by inbound provider and limit
+func (l *inboundLimits) snapshot() map[string]map[string]int64 {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    
+    out := make(map[string]map[string]int64, len(l.rejections))
+    for provider, counts := range l.rejections {
+        out[provider] = make(map[string]int64, len(counts))
+        for limit, n := range counts {
+            out[provider][limit] = n
+        }
+    }
+    return out
+}
+
+func (l *inboundLimits) collect(w *metrics.Writer) {
+    rejections := l.snapshot()
+    providers := make([]string, 0, len(rejections))
+    for provider := range rejections {
+        providers = append(providers, provider)
+    }
+    sort.Strings(providers)
+    
+    w.Header("router_calls_rejected_total", "Inbound calls rejected by a provider channel or CPS limit", "counter")
+    for _, provider := range providers {
+        for _, limit := range []string{LimitChannels, LimitCPS} {
+            if n, ok := rejections[provider][limit]; ok {
+                w.Sample("router_calls_rejected_total", float64(n),
+                    metrics.L("provider", provider), metrics.L("limit", limit))
+            }
+        }
+    }
+}
+
+// countInboundCalls returns the calls in flight from an inbound provider
+// with a channel limit, and 0 for providers without one. Channels are
+// counted in the call store, so with a shared store the limit holds across
+// the cluster. The count queries the store and runs before taking r.mu.
+func (r *Router) countInboundCalls(inboundProvider string) (int, error) {
+    p, err := r.providerMgr.GetProvider(inboundProvider)
+    if err != nil || p.MaxChannels == 0 {
+        return 0, nil
+    }
+    
+    active, err := r.store.CountByInbound(inboundProvider)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count active calls: %v", err)
+    }
+    return active, nil
+}
+
+// checkInboundLimits rejects a call when its inbound provider is at its
+// channel or CPS limit, given the calls countInboundCalls found in flight.
+// CPS is counted per node. Caller must hold r.mu.
+func (r *Router) checkInboundLimits(inboundProvider string, active int) error {
+    p, err := r.providerMgr.GetProvider(inboundProvider)
+    if err != nil || (p.MaxChannels == 0 && p.MaxCPS == 0) {
+        return nil
+    }
+    
+    return r.limits.admit(p, active, time.Now())
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/metrics"
+)
+
+// Routing steps reported in the latency metrics
+const (
+    stepIncoming = "incoming"
+    stepReturn   = "return"
+    stepFinal    = "final"
+)
+
+var (
+    stepLatency = metrics.NewHistogramVec("router_step_duration_seconds",
+        "Time spent routing one step of a call", "step", metrics.DefaultBuckets)
+    stepErrors = metrics.NewCounterVec("router_step_errors_total",
+        "Routing steps that returned an error", "step")
+)
+
+func observeStep(step string, start time.Time, err error) {
+    stepLatency.Observe(step, time.Since(start).Seconds())
+    if err != nil {
+        stepErrors.Inc(step)
+    }
+}
+
+// Collect exports router state, DID pool utilization and routing latency
+func (r *Router) Collect(w *metrics.Writer) {
+    records, err := r.store.List()
+    if err != nil {
+        log.Errorf("Failed to list active calls for metrics: %v", err)
+    }
+    
+    w.Header("router_active_calls", "Calls currently in flight", "gauge")
+    w.Sample("router_active_calls", float64(len(records)))
+    
+    r.collectDIDPools(w)
+    
+    stepLatency.Collect(w)
+    stepErrors.Collect(w)
+    r.limits.collect(w)
+    if r.fraud != nil {
+        r.fraud.Collect(w)
+    }
+    
+    r.loadBalancer.Collect(w)
+}
+
+func (r *Router) collectDIDPools(w *metrics.Writer) {
+    rows, err := db.DB.Query(`
+        SELECT COALESCE(provider_name, ''), COUNT(*), SUM(CASE WHEN in_use = 1 THEN 1 ELSE 0 END)
+        FROM dids
+        GROUP BY provider_name
+        ORDER BY provider_name`)
+    if err != nil {
+        log.Errorf("Failed to query DID pools for metrics: %v", err)
+        return
+    }
+    defer rows.Close()
+    
+    type pool struct {
+        provider    string
+        total, used float64
+    }
+    var pools []pool
+    for rows.Next() {
+        var p pool
+        if err := rows.Scan(&p.provider, &p.total, &p.used); err != nil {
+            continue
+        }
+        pools = append(pools, p)
+    }
+    
+    w.Header("router_did_pool_size", "DIDs assigned to the provider", "gauge")
+    for _, p := range pools {
+        w.Sample("router_did_pool_size", p.total, metrics.L("provider", p.provider))
+    }
+    
+    w.Header("router_did_pool_in_use", "DIDs of the provider currently held by a call", "gauge")
+    for _, p := range pools {
+        w.Sample("router_did_pool_in_use", p.used, metrics.L("provider", p.provider))
+    }
+    
+    w.Header("router_did_pool_utilization", "Share of the provider's DIDs in use (0-1)", "gauge")
+    for _, p := range pools {
+        utilization := 0.0
+        if p.total > 0 {
+            utilization = p.used / p.total
+        }
+        w.Sample("router_did_pool_utilization", utilization, metrics.L("provider", p.provider))
+    }
+}
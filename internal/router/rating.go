@@ -0,0 +1,63 @@
+package router
+
+import (
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
+)
+
+// rateCall works out the cost, revenue and margin of a completed call from
+// its answered time (Billsec), so ring time and calls that were never
+// answered are not charged. The S3 leg is charged at the intermediate
+// provider's rate and the S4 leg, if the call got that far, at the final
+// provider's rate, both as stored when the providers were chosen. Revenue is
+// charged at the inbound provider's rate for the original DNIS. Legs without
+// a rate count as free. A call whose rates are in different currencies is
+// left unrated.
+func (r *Router) rateCall(record *models.CallRecord) {
+    record.InboundRate = r.rateFor(record.InboundProvider, record.OriginalDNIS)
+    
+    rates := []*models.Rate{record.InboundRate, record.IntermediateRate}
+    if record.CurrentStep != "S1_TO_S2" {
+        rates = append(rates, record.FinalRate)
+    }
+    currency, ok := ratesCurrency(rates)
+    if !ok {
+        log.WithFields(logger.Fields{
+            "call_id": record.CallID,
+            "dnis":    record.OriginalDNIS,
+        }).Errorf("Call not rated: its rates are in different currencies")
+        return
+    }
+    record.Currency = currency
+    
+    record.Cost = provider.Charge(record.IntermediateRate, record.Billsec)
+    if record.CurrentStep != "S1_TO_S2" {
+        record.Cost += provider.Charge(record.FinalRate, record.Billsec)
+    }
+    record.Revenue = provider.Charge(record.InboundRate, record.Billsec)
+    record.Margin = record.Revenue - record.Cost
+    
+    if record.InboundRate == nil || record.IntermediateRate == nil || record.FinalRate == nil {
+        log.WithFields(logger.Fields{
+            "call_id": record.CallID,
+            "dnis":    record.OriginalDNIS,
+        }).Debugf("Call rated with missing rates (inbound %t, intermediate %t, final %t)",
+            record.InboundRate != nil, record.IntermediateRate != nil, record.FinalRate != nil)
+    }
+}
+
+// ratesCurrency returns the currency the given rates share, ignoring missing
+// ones. ok is false if they are in more than one currency.
+func ratesCurrency(rates []*models.Rate) (currency string, ok bool) {
+    for _, rate := range rates {
+        if rate == nil {
+            continue
+        }
+        if currency != "" && rate.Currency != currency {
+            return "", false
+        }
+        currency = rate.Currency
+    }
+    return currency, true
+}
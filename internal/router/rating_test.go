@@ -0,0 +1,64 @@
+package router
+
+import (
+    "database/sql/driver"
+    "math"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestHangupRatesAnsweredTime(t *testing.T) {
+    tests := []struct {
+        name       string
+        dialStatus string
+        talk       time.Duration
+        cost       float64
+        revenue    float64
+    }{
+        // 90 seconds of ringing before the answer are not billed
+        {"answered", "ANSWER", 30 * time.Second, 0.6 + 0.3, 1.2},
+        {"answered without talk time", "ANSWER", 0, 0, 0},
+        {"not answered", "NOANSWER", 0, 0, 0},
+    }
+    
+    for _, tt := range tests {
+        fake := useFakeDB(t)
+        fake.rows["FROM rate_decks"] = fakeRows{
+            columns: []string{"id", "provider_name", "prefix", "rate_per_minute", "billing_increment", "effective_date", "currency"},
+            values:  [][]driver.Value{{int64(1), "s1", "44", 2.4, int64(1), time.Now().AddDate(0, -1, 0), "USD"}},
+        }
+        
+        r := newTestRouter(callstate.NewMemoryStore(), false)
+        if err := r.providerMgr.LoadRates(); err != nil {
+            t.Fatal(err)
+        }
+        r.store.Put(&models.CallRecord{CallID: "c1", OriginalDNIS: "442071234567", AssignedDID: "100",
+            InboundProvider: "s1", IntermediateProvider: "s3a", FinalProvider: "s4a", CurrentStep: "S3_TO_S2",
+            StartTime: time.Now().Add(-2 * time.Minute), NodeID: testNode,
+            IntermediateRate: &models.Rate{RatePerMinute: 1.2, BillingIncrement: 1, Currency: "USD"},
+            FinalRate:        &models.Rate{RatePerMinute: 0.6, BillingIncrement: 1, Currency: "USD"}})
+        
+        if err := r.ProcessHangup("c1", "", "16", tt.dialStatus, tt.talk); err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        
+        updates := fake.execsOf("UPDATE call_records")
+        if len(updates) != 1 {
+            t.Fatalf("%s: %d call record updates, want 1", tt.name, len(updates))
+        }
+        args := updates[0].args
+        if duration := args[3].(int64); duration < 120 {
+            t.Errorf("%s: duration %ds, want the whole call", tt.name, duration)
+        }
+        if billsec := args[4].(int64); billsec != int64(tt.talk.Seconds()) {
+            t.Errorf("%s: billsec %d, want %d", tt.name, billsec, int64(tt.talk.Seconds()))
+        }
+        cost, revenue := args[8].(float64), args[9].(float64)
+        if math.Abs(cost-tt.cost) > 1e-9 || math.Abs(revenue-tt.revenue) > 1e-9 {
+            t.Errorf("%s: cost %.4f, revenue %.4f; want %.4f, %.4f", tt.name, cost, revenue, tt.cost, tt.revenue)
+        }
+    }
+}
@@ -0,0 +1,215 @@
+package router
+
+import (
+    "errors"
+    "fmt"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+// DefaultMaxAttempts is how many providers a leg is dialled on before giving up
+const DefaultMaxAttempts = 3
+
+// ProcessRetry picks the next provider after a failed Dial. callID is the
+// UNIQUEID of the S1 leg; the S3 return leg passes the DID it came in on.
+// The channel asking decides the leg: a failed Dial on the S1 leg is retried
+// on another intermediate provider with a fresh DID, as long as the call has
+// not come back from S3 yet, one on the return leg on another final provider.
+// Only carrier failures (congestion, unavailable) are retried.
+func (r *Router) ProcessRetry(callID, did, dialStatus, cause string) (*models.CallResponse, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    
+    record, err := r.store.Get(callID)
+    if err == callstate.ErrNotFound && did != "" {
+        record, err = r.store.GetByDID(did)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("no active call to retry: %v", err)
+    }
+    
+    step := legToS3
+    if did != "" {
+        step = legToS4
+    }
+    
+    clog := log.WithFields(logger.Fields{"call_id": record.CallID, "step": step})
+    
+    returned := record.CurrentStep != "S1_TO_S2"
+    if step == legToS3 && returned {
+        return nil, fmt.Errorf("%w: the call already came back from S3", ErrNoRetry)
+    }
+    if step == legToS4 && !returned {
+        return nil, fmt.Errorf("%w: the call has not come back from S3", ErrNoRetry)
+    }
+    
+    outcome, ok := loadbalancer.ClassifyDial(dialStatus, cause)
+    if !ok || !outcome.CarrierFailure() {
+        return nil, fmt.Errorf("%w: dial status %s is not a carrier failure", ErrNoRetry, dialStatus)
+    }
+    
+    tried, err := r.triedProviders(record.CallID, step)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load call legs: %v", err)
+    }
+    if len(tried) >= r.maxAttempts {
+        return nil, fmt.Errorf("%w: %d attempts used", ErrNoRetry, len(tried))
+    }
+    
+    // Retry within the route of the first attempt, even if a schedule change
+    // or reload would pick another one for a new call now
+    route, ok := r.providerMgr.ActiveRoute(record.RouteName)
+    if !ok {
+        clog.Warnf("Route %s of the call is gone, matching the call again", record.RouteName)
+        route, err = r.providerMgr.GetRouteForInbound(record.InboundProvider, record.OriginalANI, record.OriginalDNIS)
+        if err != nil {
+            return nil, fmt.Errorf("no route for inbound provider %s: %v", record.InboundProvider, err)
+        }
+    }
+    
+    poolName := route.IntermediateProvider
+    if step == legToS4 {
+        poolName = route.FinalProvider
+    }
+    
+    pool, err := r.providerMgr.GetProvidersByName(poolName)
+    if err != nil {
+        return nil, err
+    }
+    
+    var candidates []*models.Provider
+    for _, p := range pool {
+        if !tried[p.Name] {
+            candidates = append(candidates, p)
+        }
+    }
+    
+    if step == legToS3 {
+        return r.retryIntermediate(record, candidates, r.routeSelection(route, record.OriginalDNIS, candidates), clog)
+    }
+    return r.retryFinal(record, candidates, r.routeSelection(route, record.OriginalDNIS, candidates), clog)
+}
+
+// retryIntermediate moves the call to another S3 provider with a DID from
+// that provider's pool. Providers without a free DID are skipped.
+func (r *Router) retryIntermediate(record *models.CallRecord, candidates []*models.Provider, sel loadbalancer.Selection, clog *logger.Entry) (*models.CallResponse, error) {
+    for len(candidates) > 0 {
+        next, err := r.loadBalancer.Select(candidates, sel)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrNoRetry, err)
+        }
+        
+        did, err := r.reserveDID(next.Name, record.OriginalDNIS)
+        if errors.Is(err, ErrDIDPoolExhausted) {
+            clog.WithField("provider", next.Name).Warnf("Skipping retry candidate: %v", err)
+            candidates = withoutProvider(candidates, next.Name)
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        
+        oldDID, oldProvider := record.AssignedDID, record.IntermediateProvider
+        record.AssignedDID = did
+        record.IntermediateProvider = next.Name
+        record.IntermediateRate = r.rateFor(next.Name, record.OriginalDNIS)
+        
+        if err := r.store.Put(record); err != nil {
+            r.releaseDID(did)
+            return nil, fmt.Errorf("failed to store call state: %v", err)
+        }
+        
+        if err := r.releaseDID(oldDID); err != nil {
+            clog.Errorf("Failed to release DID %s: %v", oldDID, err)
+        }
+        if r.ownsCall(record) {
+            r.loadBalancer.IncrementActiveCalls(oldProvider, -1)
+            r.loadBalancer.IncrementActiveCalls(next.Name, 1)
+        }
+        r.updateCallRoute(record)
+        r.openLeg(record.CallID, legToS3, next.Name, did)
+        
+        clog.WithFields(logger.Fields{"provider": next.Name, "did": did}).Infof("Retrying on next intermediate provider after %s failed", oldProvider)
+        
+        response := &models.CallResponse{
+            Status:      "success",
+            DIDAssigned: did,
+            NextHop:     fmt.Sprintf("endpoint-%s", next.Name),
+            ANIToSend:   record.OriginalDNIS, // ANI-2 = DNIS-1
+            DNISToSend:  did,
+        }
+        r.translateOut(next.Name, response)
+        return response, nil
+    }
+    
+    return nil, fmt.Errorf("%w: no other intermediate provider available", ErrNoRetry)
+}
+
+// retryFinal moves the call to another S4 provider; the DID stays the same
+func (r *Router) retryFinal(record *models.CallRecord, candidates []*models.Provider, sel loadbalancer.Selection, clog *logger.Entry) (*models.CallResponse, error) {
+    if len(candidates) == 0 {
+        return nil, fmt.Errorf("%w: no other final provider available", ErrNoRetry)
+    }
+    
+    next, err := r.loadBalancer.Select(candidates, sel)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrNoRetry, err)
+    }
+    
+    oldProvider := record.FinalProvider
+    record.FinalProvider = next.Name
+    record.FinalRate = r.rateFor(next.Name, record.OriginalDNIS)
+    
+    if err := r.store.Put(record); err != nil {
+        return nil, fmt.Errorf("failed to store call state: %v", err)
+    }
+    
+    if r.ownsCall(record) {
+        r.loadBalancer.IncrementActiveCalls(oldProvider, -1)
+        r.loadBalancer.IncrementActiveCalls(next.Name, 1)
+    }
+    r.updateCallRoute(record)
+    r.openLeg(record.CallID, legToS4, next.Name, record.AssignedDID)
+    
+    clog.WithField("provider", next.Name).Infof("Retrying on next final provider after %s failed", oldProvider)
+    
+    response := &models.CallResponse{
+        Status:     "success",
+        NextHop:    fmt.Sprintf("endpoint-%s", next.Name),
+        ANIToSend:  record.OriginalANI,  // Restore ANI-1
+        DNISToSend: record.OriginalDNIS, // Restore DNIS-1
+    }
+    r.translateOut(next.Name, response)
+    return response, nil
+}
+
+// updateCallRoute stores the providers, rates and DID a call is currently using
+func (r *Router) updateCallRoute(record *models.CallRecord) {
+    intermediateRateID, intermediateRate := rateColumns(record.IntermediateRate)
+    finalRateID, finalRate := rateColumns(record.FinalRate)
+    
+    _, err := db.DB.Exec(`
+        UPDATE call_records
+        SET assigned_did = ?, intermediate_provider = ?, final_provider = ?,
+            intermediate_rate_id = ?, intermediate_rate = ?, final_rate_id = ?, final_rate = ?
+        WHERE call_id = ?`,
+        record.AssignedDID, record.IntermediateProvider, record.FinalProvider,
+        intermediateRateID, intermediateRate, finalRateID, finalRate, record.CallID)
+    if err != nil {
+        log.WithField("call_id", record.CallID).Errorf("Failed to update call record: %v", err)
+    }
+}
+
+func withoutProvider(providers []*models.Provider, name string) []*models.Provider {
+    var out []*models.Provider
+    for _, p := range providers {
+        if p.Name != name {
+            out = append(out, p)
+        }
+    }
+    return out
+}
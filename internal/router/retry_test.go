@@ -0,0 +1,45 @@
+package router
+
+import (
+    "errors"
+    "testing"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+func TestRetryLegOfChannel(t *testing.T) {
+    fake := useFakeDB(t)
+    store := callstate.NewMemoryStore()
+    store.Put(&models.CallRecord{CallID: "waiting", AssignedDID: "100", CurrentStep: "S1_TO_S2",
+        IntermediateProvider: "s3a", FinalProvider: "s4a"})
+    store.Put(&models.CallRecord{CallID: "returned", AssignedDID: "200", CurrentStep: "RETURNED_FROM_S3",
+        IntermediateProvider: "s3a", FinalProvider: "s4a"})
+    r := newTestRouter(store, false)
+    
+    tests := []struct {
+        name        string
+        callID, did string
+    }{
+        // The S1 channel of a call back from S3 must not skip S3
+        {"S1 leg of a returned call", "returned", ""},
+        // Only the return channel of a returned call asks with a DID
+        {"return leg of a waiting call", "return-channel", "100"},
+    }
+    
+    for _, tt := range tests {
+        response, err := r.ProcessRetry(tt.callID, tt.did, "CONGESTION", "34")
+        if !errors.Is(err, ErrNoRetry) {
+            t.Errorf("%s: got %v, %v; want ErrNoRetry", tt.name, response, err)
+        }
+    }
+    
+    if execs := fake.execsOf(""); len(execs) != 0 {
+        t.Errorf("refused retries changed the database: %v", execs)
+    }
+    for callID, step := range map[string]string{"waiting": "S1_TO_S2", "returned": "RETURNED_FROM_S3"} {
+        if record, _ := store.Get(callID); record.CurrentStep != step || record.FinalProvider != "s4a" {
+            t.Errorf("%s changed to %+v", callID, record)
+        }
+    }
+}
@@ -3,59 +3,282 @@ package router
 import (
     "database/sql"
     "fmt"
-    "log"
+    "net"
+    "os"
     "strings"
     "sync"
     "time"
     
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
     "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/fraud"
     "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
     "github.com/hamzaKhattat/asterisk-router-production/internal/models"
     "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
 )
 
+var log = logger.Component("router")
+
+// lcrCallSeconds is the call length the lcr mode compares providers on, so
+// that a coarse billing increment counts against a cheap rate
+const lcrCallSeconds = 90
+
 type Router struct {
     providerMgr  *provider.Manager
     loadBalancer *loadbalancer.LoadBalancer
     mu           sync.RWMutex
-    activeCalls  map[string]*models.CallRecord
-    didToCall    map[string]string // DID -> CallID mapping
+    store        callstate.Store
+    nodeID       string
+    clustered    bool
+    maxAttempts  int
+    limits       *inboundLimits
+    fraud        *fraud.Detector
+    blockSIPCode int
+}
+
+// Config controls how a Router keeps its in-flight call state
+type Config struct {
+    // Store holds in-flight calls. Defaults to a process-local MemoryStore.
+    Store callstate.Store
+    
+    // NodeID identifies this router in a cluster. Defaults to the hostname.
+    NodeID string
+    
+    // Clustered means Store is shared with other router nodes, so DIDs
+    // leased by other nodes must be left alone during recovery
+    Clustered bool
+    
+    // MaxAttempts is how many providers each leg may be dialled on.
+    // Defaults to DefaultMaxAttempts.
+    MaxAttempts int
+    
+    // ChannelLimitSIPCode and CPSLimitSIPCode are the SIP responses for
+    // calls rejected by an inbound provider's limits. Default to
+    // DefaultRejectSIPCode.
+    ChannelLimitSIPCode int
+    CPSLimitSIPCode     int
+    
+    // Fraud screens inbound calls. Nil disables fraud checks.
+    Fraud *fraud.Detector
+    
+    // BlockSIPCode is the SIP response for calls a fraud rule blocks.
+    // Defaults to DefaultBlockSIPCode.
+    BlockSIPCode int
 }
 
 func NewRouter(providerMgr *provider.Manager) *Router {
+    return NewRouterWithConfig(providerMgr, Config{})
+}
+
+func NewRouterWithConfig(providerMgr *provider.Manager, cfg Config) *Router {
+    if cfg.Store == nil {
+        cfg.Store = callstate.NewMemoryStore()
+    }
+    
+    if cfg.NodeID == "" {
+        cfg.NodeID, _ = os.Hostname()
+    }
+    
+    if cfg.MaxAttempts <= 0 {
+        cfg.MaxAttempts = DefaultMaxAttempts
+    }
+    
     r := &Router{
         providerMgr:  providerMgr,
         loadBalancer: loadbalancer.New(),
-        activeCalls:  make(map[string]*models.CallRecord),
-        didToCall:    make(map[string]string),
+        store:        cfg.Store,
+        nodeID:       cfg.NodeID,
+        clustered:    cfg.Clustered,
+        maxAttempts:  cfg.MaxAttempts,
+        limits:       newInboundLimits(cfg.ChannelLimitSIPCode, cfg.CPSLimitSIPCode),
+        fraud:        cfg.Fraud,
+        blockSIPCode: rejectSIPCode("blocked calls", cfg.BlockSIPCode, DefaultBlockSIPCode),
     }
     
-    // Start load balancer health monitor
-    r.loadBalancer.StartHealthMonitor()
+    log.WithFields(logger.Fields{"node_id": r.nodeID, "clustered": r.clustered}).Infof("Router started")
+    
+    // Rebuild in-flight state left behind by a previous process
+    if err := r.recoverActiveCalls(); err != nil {
+        log.Warnf("Failed to recover active calls: %v", err)
+    }
     
     go r.cleanupRoutine()
     return r
 }
 
+// recoverActiveCalls reloads calls that were still in flight when the
+// previous AGI process stopped and reconciles dids.in_use against them.
+// In cluster mode the shared store already holds the calls of every node,
+// so only calls missing from it are restored from call_records.
+func (r *Router) recoverActiveCalls() error {
+    query := `
+        SELECT call_id, original_ani, original_dnis, transformed_ani, assigned_did,
+               inbound_provider, intermediate_provider, final_provider, status,
+               current_step, start_time, recording_path
+        FROM call_records
+        WHERE status IN ('ACTIVE', 'RETURNED_FROM_S3')`
+    
+    rows, err := db.DB.Query(query)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+    
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    
+    for rows.Next() {
+        var transformedANI, assignedDID, inbound, intermediate, final, step, recording sql.NullString
+        record := &models.CallRecord{}
+        
+        err := rows.Scan(&record.CallID, &record.OriginalANI, &record.OriginalDNIS,
+            &transformedANI, &assignedDID, &inbound, &intermediate, &final,
+            &record.Status, &step, &record.StartTime, &recording)
+        if err != nil {
+            log.Errorf("Error loading call record: %v", err)
+            continue
+        }
+        
+        record.TransformedANI = transformedANI.String
+        record.AssignedDID = assignedDID.String
+        record.InboundProvider = inbound.String
+        record.IntermediateProvider = intermediate.String
+        record.FinalProvider = final.String
+        record.CurrentStep = step.String
+        record.RecordingPath = recording.String
+        
+        if _, err := r.store.Get(record.CallID); err == nil {
+            continue
+        }
+        
+        record.NodeID = r.nodeID
+        if err := r.store.Put(record); err != nil {
+            log.WithField("call_id", record.CallID).Errorf("Failed to restore call: %v", err)
+        }
+    }
+    
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    
+    records, err := r.store.List()
+    if err != nil {
+        return err
+    }
+    
+    // Active call counters are node-local, count only the calls this node owns
+    recovered := 0
+    for _, record := range records {
+        if !r.ownsCall(record) {
+            continue
+        }
+        r.countActiveCall(record, 1)
+        recovered++
+    }
+    
+    log.Infof("Recovered %d active calls", recovered)
+    
+    return r.reconcileDIDs(records)
+}
+
+// reconcileDIDs makes dids.in_use match the recovered in-flight calls:
+// DIDs held by a recovered call stay locked, every other DID is freed.
+// In cluster mode only DIDs leased by this node are considered, a DID
+// another node has just reserved may not have its call stored yet.
+// Caller must hold r.mu.
+func (r *Router) reconcileDIDs(records []*models.CallRecord) error {
+    held := []interface{}{}
+    for _, record := range records {
+        if record.AssignedDID == "" {
+            continue
+        }
+        held = append(held, record.AssignedDID)
+        
+        if !r.ownsCall(record) {
+            continue
+        }
+        if err := r.markDIDInUse(record.AssignedDID, record.OriginalDNIS); err != nil {
+            log.WithFields(logger.Fields{"call_id": record.CallID, "did": record.AssignedDID}).Errorf("Failed to re-lock DID: %v", err)
+        }
+    }
+    
+    query := `UPDATE dids SET in_use = 0, destination = NULL, leased_by = NULL, updated_at = NOW() WHERE in_use = 1`
+    args := []interface{}{}
+    
+    if r.clustered {
+        query += " AND (leased_by = ? OR leased_by IS NULL)"
+        args = append(args, r.nodeID)
+    }
+    
+    if len(held) > 0 {
+        query += " AND number NOT IN (?" + strings.Repeat(", ?", len(held)-1) + ")"
+        args = append(args, held...)
+    }
+    
+    result, err := db.DB.Exec(query, args...)
+    if err != nil {
+        return fmt.Errorf("failed to release orphaned DIDs: %v", err)
+    }
+    
+    if released, _ := result.RowsAffected(); released > 0 {
+        log.Infof("Released %d orphaned DIDs", released)
+    }
+    
+    return nil
+}
+
 // ProcessIncomingCall handles call from S1 to S2 (Step 1 in UML)
 func (r *Router) ProcessIncomingCall(callID, ani, dnis, inboundProvider string) (*models.CallResponse, error) {
+    start := time.Now()
+    response, err := r.processIncomingCall(callID, ani, dnis, inboundProvider)
+    observeStep(stepIncoming, start, err)
+    return response, err
+}
+
+func (r *Router) processIncomingCall(callID, ani, dnis, inboundProvider string) (*models.CallResponse, error) {
+    clog := log.WithFields(logger.Fields{
+        "call_id":  callID,
+        "step":     "S1_TO_S2",
+        "provider": inboundProvider,
+    })
+    clog.WithFields(logger.Fields{"ani": ani, "dnis": dnis}).Infof("Incoming call")
+    
+    ani, dnis = r.translateIn(inboundProvider, ani, dnis, clog)
+    
+    // Counted outside the lock so a store query does not hold up other calls
+    active, err := r.countInboundCalls(inboundProvider)
+    if err != nil {
+        clog.Warnf("Rejecting call: %v", err)
+        return nil, err
+    }
+    
     r.mu.Lock()
     defer r.mu.Unlock()
     
-    log.Printf("[ROUTER] ========== INCOMING CALL ==========")
-    log.Printf("[ROUTER] CallID: %s", callID)
-    log.Printf("[ROUTER] ANI-1: %s", ani)
-    log.Printf("[ROUTER] DNIS-1: %s", dnis)
-    log.Printf("[ROUTER] Inbound Provider: %s", inboundProvider)
-    log.Printf("[ROUTER] ===================================")
+    if err := r.checkInboundLimits(inboundProvider, active); err != nil {
+        clog.Warnf("Rejecting call: %v", err)
+        return nil, err
+    }
     
-    // Get route for this inbound provider
-    route, err := r.providerMgr.GetRouteForInbound(inboundProvider)
+    // Get the route for this inbound provider and destination
+    route, err := r.providerMgr.GetRouteForInbound(inboundProvider, ani, dnis)
     if err != nil {
         return nil, fmt.Errorf("no route for inbound provider %s: %v", inboundProvider, err)
     }
     
-    log.Printf("[ROUTER] Using route: %s", route.Name)
+    clog = clog.WithField("route", route.Name)
+    clog.Debugf("Using route %s", route.Name)
+    
+    // Number lists go first so that listed numbers do not fill the fraud
+    // rate windows
+    if err := r.screenNumbers(callID, ani, dnis, inboundProvider, route.Name, clog); err != nil {
+        return nil, err
+    }
+    
+    if err := r.screenCall(callID, ani, dnis, inboundProvider, clog); err != nil {
+        return nil, err
+    }
     
     // Select intermediate provider using load balancing
     intermediateProviders, err := r.providerMgr.GetProvidersByName(route.IntermediateProvider)
@@ -63,12 +286,12 @@ func (r *Router) ProcessIncomingCall(callID, ani, dnis, inboundProvider string)
         return nil, err
     }
     
-    intermediateProvider, err := r.loadBalancer.SelectProvider(intermediateProviders, route.LoadBalanceMode)
+    intermediateProvider, err := r.loadBalancer.Select(intermediateProviders, r.routeSelection(route, dnis, intermediateProviders))
     if err != nil {
         return nil, err
     }
     
-    log.Printf("[ROUTER] Selected intermediate provider: %s (Mode: %s)", intermediateProvider.Name, route.LoadBalanceMode)
+    clog.WithField("intermediate_provider", intermediateProvider.Name).Debugf("Selected intermediate provider (mode: %s)", route.LoadBalanceMode)
     
     // Select final provider
     finalProviders, err := r.providerMgr.GetProvidersByName(route.FinalProvider)
@@ -76,25 +299,20 @@ func (r *Router) ProcessIncomingCall(callID, ani, dnis, inboundProvider string)
         return nil, err
     }
     
-    finalProvider, err := r.loadBalancer.SelectProvider(finalProviders, route.LoadBalanceMode)
+    finalProvider, err := r.loadBalancer.Select(finalProviders, r.routeSelection(route, dnis, finalProviders))
     if err != nil {
         return nil, err
     }
     
-    log.Printf("[ROUTER] Selected final provider: %s", finalProvider.Name)
+    clog.WithField("final_provider", finalProvider.Name).Debugf("Selected final provider")
     
-    // Get available DID for the intermediate provider
-    did, err := r.getAvailableDID(intermediateProvider.Name)
+    // Reserve a DID for the intermediate provider with destination DNIS-1
+    did, err := r.reserveDID(intermediateProvider.Name, dnis)
     if err != nil {
-        return nil, fmt.Errorf("no available DIDs for provider %s: %v", intermediateProvider.Name, err)
+        return nil, fmt.Errorf("no available DIDs for provider %s: %w", intermediateProvider.Name, err)
     }
     
-    log.Printf("[ROUTER] Assigned DID: %s", did)
-    
-    // Mark DID as in use with destination DNIS-1
-    if err := r.markDIDInUse(did, dnis); err != nil {
-        return nil, err
-    }
+    clog = clog.WithField("did", did)
     
     // Create call record
     record := &models.CallRecord{
@@ -106,28 +324,36 @@ func (r *Router) ProcessIncomingCall(callID, ani, dnis, inboundProvider string)
         InboundProvider:      inboundProvider,
         IntermediateProvider: intermediateProvider.Name,
         FinalProvider:        finalProvider.Name,
+        RouteName:            route.Name,
         Status:               "ACTIVE",
         CurrentStep:          "S1_TO_S2",
         StartTime:            time.Now(),
         RecordingPath:        fmt.Sprintf("/var/spool/asterisk/monitor/%s.wav", callID),
+        NodeID:               r.nodeID,
+        IntermediateRate:     r.rateFor(intermediateProvider.Name, dnis),
+        FinalRate:            r.rateFor(finalProvider.Name, dnis),
     }
     
-    r.activeCalls[callID] = record
-    r.didToCall[did] = callID
+    if err := r.store.Put(record); err != nil {
+        r.releaseDID(did)
+        return nil, fmt.Errorf("failed to store call state: %v", err)
+    }
+    r.limits.arrived(inboundProvider, time.Now())
     
     // Store in database
     if err := r.storeCallRecord(record); err != nil {
-        log.Printf("Failed to store call record: %v", err)
+        clog.Errorf("Failed to store call record: %v", err)
     }
+    r.openLeg(callID, legToS3, intermediateProvider.Name, did)
     
     // Store verification record
-    r.storeVerificationRecord(callID, "S1_TO_S2", map[string]string{
+    r.storeVerificationRecord(callID, "S1_TO_S2", inboundProvider, map[string]string{
         "ani": ani,
         "dnis": dnis,
     }, map[string]string{
         "ani": ani,
         "dnis": dnis,
-    }, "", true)
+    }, "", "", "")
     
     // Update load balancer stats
     r.loadBalancer.IncrementActiveCalls(intermediateProvider.Name, 1)
@@ -141,41 +367,52 @@ func (r *Router) ProcessIncomingCall(callID, ani, dnis, inboundProvider string)
         ANIToSend:   dnis,  // ANI-2 = DNIS-1
         DNISToSend:  did,   // DID
     }
+    r.translateOut(intermediateProvider.Name, response)
     
-    log.Printf("[ROUTER] Routing to S3:")
-    log.Printf("[ROUTER]   ANI-2: %s (was DNIS-1)", response.ANIToSend)
-    log.Printf("[ROUTER]   DID: %s", response.DNISToSend)
-    log.Printf("[ROUTER]   Next Hop: %s", response.NextHop)
+    clog.WithFields(logger.Fields{
+        "ani":      response.ANIToSend,
+        "dnis":     response.DNISToSend,
+        "next_hop": response.NextHop,
+    }).Infof("Routing to S3")
     
     return response, nil
 }
 
 // ProcessReturnCall handles call returning from S3 (Step 3 in UML)
 func (r *Router) ProcessReturnCall(ani2, did, provider, sourceIP string) (*models.CallResponse, error) {
+    start := time.Now()
+    response, err := r.processReturnCall(ani2, did, provider, sourceIP)
+    observeStep(stepReturn, start, err)
+    return response, err
+}
+
+func (r *Router) processReturnCall(ani2, did, providerName, sourceIP string) (*models.CallResponse, error) {
     r.mu.Lock()
     defer r.mu.Unlock()
     
-    log.Printf("[ROUTER] ========== RETURN CALL FROM S3 ==========")
-    log.Printf("[ROUTER] ANI-2: %s", ani2)
-    log.Printf("[ROUTER] DID: %s", did)
-    log.Printf("[ROUTER] Provider: %s", provider)
-    log.Printf("[ROUTER] Source IP: %s", sourceIP)
-    log.Printf("[ROUTER] ========================================")
+    clog := log.WithFields(logger.Fields{
+        "step":      "S3_TO_S2",
+        "provider":  providerName,
+        "did":       did,
+        "source_ip": sourceIP,
+    })
+    clog.WithField("ani", ani2).Infof("Return call from S3")
+    
+    ani2, did = r.translateIn(providerName, ani2, did, clog)
     
     // Find call by DID
-    callID, exists := r.didToCall[did]
-    if !exists {
-        log.Printf("[ROUTER] ERROR: No active call for DID %s", did)
+    record, err := r.store.GetByDID(did)
+    if err == callstate.ErrNotFound {
+        clog.Errorf("No active call for DID %s", did)
         return nil, fmt.Errorf("no active call for DID %s", did)
     }
-    
-    record := r.activeCalls[callID]
-    if record == nil {
-        log.Printf("[ROUTER] ERROR: No call record for CallID %s", callID)
-        return nil, fmt.Errorf("no call record found")
+    if err != nil {
+        clog.Errorf("Failed to look up call for DID %s: %v", did, err)
+        return nil, fmt.Errorf("failed to look up call for DID %s: %v", did, err)
     }
     
-    log.Printf("[ROUTER] Found call record: CallID=%s", callID)
+    callID := record.CallID
+    clog = clog.WithFields(logger.Fields{"call_id": callID, "provider": record.IntermediateProvider})
     
     // Verify source IP matches intermediate provider
     intermediateProvider, err := r.providerMgr.GetProvider(record.IntermediateProvider)
@@ -184,39 +421,55 @@ func (r *Router) ProcessReturnCall(ani2, did, provider, sourceIP string) (*model
     }
     
     if err := r.verifyProviderIP(intermediateProvider, sourceIP); err != nil {
-        log.Printf("[ROUTER] ERROR: IP verification failed for %s: %v", record.IntermediateProvider, err)
-        r.storeVerificationRecord(callID, "S3_TO_S2", map[string]string{
+        clog.Errorf("IP verification failed: %v", err)
+        r.storeVerificationRecord(callID, "S3_TO_S2", intermediateProvider.Name, map[string]string{
             "ani": ani2,
             "dnis": did,
-            "expected_ip": intermediateProvider.Host,
+            "expected_ip": strings.Join(provider.SourceAddresses(intermediateProvider), ","),
         }, map[string]string{
             "ani": ani2,
             "dnis": did,
             "actual_ip": sourceIP,
-        }, sourceIP, false)
-        return nil, fmt.Errorf("unauthorized source IP: %s", sourceIP)
+        }, sourceIP, ReasonIPMismatch, ipMismatchPolicy)
+        return nil, &VerificationError{Step: "S3_TO_S2", Reason: ReasonIPMismatch, Detail: err.Error()}
     }
     
-    log.Printf("[ROUTER] IP verification passed for %s", record.IntermediateProvider)
+    clog.Debugf("IP verification passed")
     
-    // Verify ANI-2 matches original DNIS-1
-    if ani2 != record.OriginalDNIS {
-        log.Printf("[ROUTER] WARNING: ANI mismatch: expected %s, got %s", record.OriginalDNIS, ani2)
+    // Verify ANI-2 matches original DNIS-1; the route's policy decides
+    // what happens to the call if not
+    reason := numbersMismatch(record.OriginalDNIS, did, ani2, did)
+    action := ""
+    if reason != "" {
+        action, err = r.enforceVerification(record, "S3_TO_S2", reason,
+            fmt.Sprintf("ANI mismatch: expected %s, got %s", record.OriginalDNIS, ani2), clog)
     }
     
     // Store verification record
-    r.storeVerificationRecord(callID, "S3_TO_S2", map[string]string{
+    r.storeVerificationRecord(callID, "S3_TO_S2", intermediateProvider.Name, map[string]string{
         "ani": record.OriginalDNIS,
         "dnis": did,
     }, map[string]string{
         "ani": ani2,
         "dnis": did,
-    }, sourceIP, true)
+    }, sourceIP, reason, action)
+    if err != nil {
+        return nil, err
+    }
     
     // Update call state
     record.CurrentStep = "S3_TO_S2"
     record.Status = "RETURNED_FROM_S3"
     
+    if err := r.store.Put(record); err != nil {
+        return nil, fmt.Errorf("failed to store call state: %v", err)
+    }
+    
+    if err := r.updateCallRecord(record); err != nil {
+        clog.Errorf("Failed to update call record: %v", err)
+    }
+    r.openLeg(callID, legToS4, record.FinalProvider, did)
+    
     // Build response for routing to S4
     response := &models.CallResponse{
         Status:     "success",
@@ -224,46 +477,51 @@ func (r *Router) ProcessReturnCall(ani2, did, provider, sourceIP string) (*model
         ANIToSend:  record.OriginalANI,   // Restore ANI-1
         DNISToSend: record.OriginalDNIS,  // Restore DNIS-1
     }
+    r.translateOut(record.FinalProvider, response)
     
-    log.Printf("[ROUTER] Routing to S4:")
-    log.Printf("[ROUTER]   ANI-1: %s (restored)", response.ANIToSend)
-    log.Printf("[ROUTER]   DNIS-1: %s (restored)", response.DNISToSend)
-    log.Printf("[ROUTER]   Next Hop: %s", response.NextHop)
+    clog.WithFields(logger.Fields{
+        "ani":      response.ANIToSend,
+        "dnis":     response.DNISToSend,
+        "next_hop": response.NextHop,
+    }).Infof("Routing to S4")
     
     return response, nil
 }
 
 // ProcessFinalCall handles the final call from S4 (Step 5 in UML)
 func (r *Router) ProcessFinalCall(callID, ani, dnis, provider, sourceIP string) error {
+    start := time.Now()
+    err := r.processFinalCall(callID, ani, dnis, provider, sourceIP)
+    observeStep(stepFinal, start, err)
+    return err
+}
+
+func (r *Router) processFinalCall(callID, ani, dnis, providerName, sourceIP string) error {
     r.mu.Lock()
     defer r.mu.Unlock()
     
-    log.Printf("[ROUTER] ========== FINAL CALL FROM S4 ==========")
-    log.Printf("[ROUTER] CallID: %s", callID)
-    log.Printf("[ROUTER] ANI: %s", ani)
-    log.Printf("[ROUTER] DNIS: %s", dnis)
-    log.Printf("[ROUTER] Provider: %s", provider)
-    log.Printf("[ROUTER] Source IP: %s", sourceIP)
-    log.Printf("[ROUTER] ========================================")
+    clog := log.WithFields(logger.Fields{
+        "call_id":   callID,
+        "step":      "S4_TO_S2",
+        "provider":  providerName,
+        "source_ip": sourceIP,
+    })
+    clog.WithFields(logger.Fields{"ani": ani, "dnis": dnis}).Infof("Final call from S4")
+    
+    ani, dnis = r.translateIn(providerName, ani, dnis, clog)
     
     // Find call record
-    record, exists := r.activeCalls[callID]
-    if !exists {
+    record, err := r.store.Get(callID)
+    if err == callstate.ErrNotFound {
         // Try to find by ANI/DNIS combination
-        for cid, rec := range r.activeCalls {
-            if rec.OriginalANI == ani && rec.OriginalDNIS == dnis {
-                record = rec
-                callID = cid
-                break
-            }
-        }
-        if record == nil {
-            log.Printf("[ROUTER] ERROR: Call not found for CallID=%s, ANI=%s, DNIS=%s", callID, ani, dnis)
-            return fmt.Errorf("call not found")
-        }
+        record, err = r.store.FindByNumbers(ani, dnis)
     }
-    
-    log.Printf("[ROUTER] Found call record: CallID=%s", callID)
+    if err != nil {
+        clog.Errorf("Call not found for ANI=%s, DNIS=%s: %v", ani, dnis, err)
+        return fmt.Errorf("call not found")
+    }
+    callID = record.CallID
+    clog = clog.WithFields(logger.Fields{"call_id": callID, "provider": record.FinalProvider})
     
     // Verify source IP matches final provider
     finalProvider, err := r.providerMgr.GetProvider(record.FinalProvider)
@@ -272,45 +530,51 @@ func (r *Router) ProcessFinalCall(callID, ani, dnis, provider, sourceIP string)
     }
     
     if err := r.verifyProviderIP(finalProvider, sourceIP); err != nil {
-        log.Printf("[ROUTER] ERROR: IP verification failed for %s: %v", record.FinalProvider, err)
-        r.storeVerificationRecord(callID, "S4_TO_S2", map[string]string{
+        clog.Errorf("IP verification failed: %v", err)
+        r.storeVerificationRecord(callID, "S4_TO_S2", finalProvider.Name, map[string]string{
             "ani": ani,
             "dnis": dnis,
-            "expected_ip": finalProvider.Host,
+            "expected_ip": strings.Join(provider.SourceAddresses(finalProvider), ","),
         }, map[string]string{
             "ani": ani,
             "dnis": dnis,
             "actual_ip": sourceIP,
-        }, sourceIP, false)
-        return fmt.Errorf("unauthorized source IP: %s", sourceIP)
+        }, sourceIP, ReasonIPMismatch, ipMismatchPolicy)
+        return &VerificationError{Step: "S4_TO_S2", Reason: ReasonIPMismatch, Detail: err.Error()}
     }
     
-    log.Printf("[ROUTER] IP verification passed for %s", record.FinalProvider)
+    clog.Debugf("IP verification passed")
     
-    // Verify ANI and DNIS match original values
-    if ani != record.OriginalANI || dnis != record.OriginalDNIS {
-        log.Printf("[ROUTER] WARNING: Call parameters mismatch")
-        log.Printf("[ROUTER]   Expected ANI: %s, Got: %s", record.OriginalANI, ani)
-        log.Printf("[ROUTER]   Expected DNIS: %s, Got: %s", record.OriginalDNIS, dnis)
+    // Verify ANI and DNIS match original values; the route's policy
+    // decides what happens to the call if not
+    reason := numbersMismatch(record.OriginalANI, record.OriginalDNIS, ani, dnis)
+    action := ""
+    if reason != "" {
+        action, err = r.enforceVerification(record, "S4_TO_S2", reason,
+            fmt.Sprintf("Call parameters mismatch: expected ANI %s DNIS %s, got ANI %s DNIS %s",
+                record.OriginalANI, record.OriginalDNIS, ani, dnis), clog)
     }
     
     // Store verification record
-    r.storeVerificationRecord(callID, "S4_TO_S2", map[string]string{
+    r.storeVerificationRecord(callID, "S4_TO_S2", finalProvider.Name, map[string]string{
         "ani": record.OriginalANI,
         "dnis": record.OriginalDNIS,
     }, map[string]string{
         "ani": ani,
         "dnis": dnis,
-    }, sourceIP, true)
+    }, sourceIP, reason, action)
+    if err != nil {
+        return err
+    }
     
     // Calculate call duration
     duration := time.Since(record.StartTime)
     
     // Update load balancer stats
-    r.loadBalancer.UpdateStats(record.IntermediateProvider, true, duration)
-    r.loadBalancer.UpdateStats(record.FinalProvider, true, duration)
-    r.loadBalancer.IncrementActiveCalls(record.IntermediateProvider, -1)
-    r.loadBalancer.IncrementActiveCalls(record.FinalProvider, -1)
+    // Success and failure are counted from the Dial outcomes
+    r.loadBalancer.RecordCallDuration(record.IntermediateProvider, duration)
+    r.loadBalancer.RecordCallDuration(record.FinalProvider, duration)
+    r.countActiveCall(record, -1)
     
     // Update call record
     record.Status = "COMPLETED"
@@ -318,29 +582,97 @@ func (r *Router) ProcessFinalCall(callID, ani, dnis, provider, sourceIP string)
     now := time.Now()
     record.EndTime = &now
     record.Duration = int(duration.Seconds())
+    // The S4 callback is verified but never answered, so it has no talk
+    // time and Billsec stays 0
+    r.rateCall(record)
+    r.callEnded(record)
     
     // Release DID
     if err := r.releaseDID(record.AssignedDID); err != nil {
-        log.Printf("Failed to release DID: %v", err)
+        clog.Errorf("Failed to release DID %s: %v", record.AssignedDID, err)
     }
     
-    log.Printf("[ROUTER] Released DID: %s", record.AssignedDID)
-    
     // Update database
     if err := r.updateCallRecord(record); err != nil {
-        log.Printf("Failed to update call record: %v", err)
+        clog.Errorf("Failed to update call record: %v", err)
     }
     
     // Clean up
-    delete(r.activeCalls, callID)
-    delete(r.didToCall, record.AssignedDID)
+    if err := r.store.Delete(callID); err != nil {
+        clog.Errorf("Failed to remove call state: %v", err)
+    }
     
-    log.Printf("[ROUTER] Call %s completed successfully (Duration: %v)", callID, duration)
+    clog.WithFields(logger.Fields{
+        "duration": duration.String(),
+        "cost":     record.Cost,
+        "revenue":  record.Revenue,
+        "margin":   record.Margin,
+        "currency": record.Currency,
+    }).Infof("Call completed")
     return nil
 }
 
 // Helper functions
-func (r *Router) getAvailableDID(providerName string) (string, error) {
+// routeSelection returns what the load balancer needs to know about a route
+// to pick one of candidates for a call to dnis
+func (r *Router) routeSelection(route *models.ProviderRoute, dnis string, candidates []*models.Provider) loadbalancer.Selection {
+    sel := loadbalancer.Selection{
+        Mode: route.LoadBalanceMode,
+        Quality: loadbalancer.QualityWeights{
+            ASR: route.ASRWeight,
+            ACD: route.ACDWeight,
+            PDD: route.PDDWeight,
+        },
+    }
+    
+    if sel.Mode == "lcr" {
+        sel.Costs = r.lcrCosts(route, dnis, candidates)
+    }
+    return sel
+}
+
+// lcrCosts returns what a call of lcrCallSeconds to dnis costs with each
+// candidate that has a rate for it. Costs in different currencies cannot be
+// compared, so a pool whose rates mix currencies is not ranked on cost at all.
+func (r *Router) lcrCosts(route *models.ProviderRoute, dnis string, candidates []*models.Provider) map[string]float64 {
+    costs := make(map[string]float64)
+    currency := ""
+    for _, p := range candidates {
+        rate := r.rateFor(p.Name, dnis)
+        if rate == nil {
+            continue
+        }
+        if currency != "" && rate.Currency != currency {
+            log.WithFields(logger.Fields{"route": route.Name, "dnis": dnis}).
+                Errorf("Rates are in %s and %s, not ranking providers on cost", currency, rate.Currency)
+            return nil
+        }
+        currency = rate.Currency
+        costs[p.Name] = provider.Charge(rate, lcrCallSeconds)
+    }
+    return costs
+}
+
+// rateFor returns the provider's rate for calls to dnis, nil if its rate
+// deck has none
+func (r *Router) rateFor(providerName, dnis string) *models.Rate {
+    rate, err := r.providerMgr.LookupRate(providerName, dnis)
+    if err != nil {
+        return nil
+    }
+    return rate
+}
+
+// reserveDID picks a free DID and marks it in use in a single transaction.
+// The row lock taken by SELECT ... FOR UPDATE is held until commit, so two
+// routers (or a concurrent CLI release) can never hand out the same DID.
+func (r *Router) reserveDID(providerName, destination string) (string, error) {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return "", fmt.Errorf("failed to begin DID reservation: %v", err)
+    }
+    defer tx.Rollback()
+    
     query := `
         SELECT number FROM dids 
         WHERE in_use = 0 AND provider_name = ? 
@@ -349,88 +681,166 @@ func (r *Router) getAvailableDID(providerName string) (string, error) {
         FOR UPDATE`
     
     var did string
-    err := db.DB.QueryRow(query, providerName).Scan(&did)
+    err = tx.QueryRow(query, providerName).Scan(&did)
     if err == sql.ErrNoRows {
         // Try any available DID if provider-specific DID not found
-        err = db.DB.QueryRow("SELECT number FROM dids WHERE in_use = 0 ORDER BY RAND() LIMIT 1 FOR UPDATE").Scan(&did)
+        err = tx.QueryRow("SELECT number FROM dids WHERE in_use = 0 ORDER BY RAND() LIMIT 1 FOR UPDATE").Scan(&did)
     }
     
+    if err == sql.ErrNoRows {
+        return "", ErrDIDPoolExhausted
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to select DID: %v", err)
+    }
+    
+    result, err := tx.Exec(`UPDATE dids SET in_use = 1, destination = ?, leased_by = ?, updated_at = NOW() WHERE number = ? AND in_use = 0`,
+        destination, r.nodeID, did)
     if err != nil {
-        return "", fmt.Errorf("no available DIDs: %v", err)
+        return "", fmt.Errorf("failed to mark DID %s in use: %v", did, err)
+    }
+    
+    if affected, _ := result.RowsAffected(); affected != 1 {
+        return "", fmt.Errorf("DID %s was taken by another call", did)
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return "", fmt.Errorf("failed to commit DID reservation: %v", err)
     }
     
     return did, nil
 }
 
 func (r *Router) markDIDInUse(did, destination string) error {
-    query := `UPDATE dids SET in_use = 1, destination = ?, updated_at = NOW() WHERE number = ?`
-    _, err := db.DB.Exec(query, destination, did)
+    query := `UPDATE dids SET in_use = 1, destination = ?, leased_by = ?, updated_at = NOW() WHERE number = ?`
+    _, err := db.DB.Exec(query, destination, r.nodeID, did)
     return err
 }
 
 func (r *Router) releaseDID(did string) error {
-    query := `UPDATE dids SET in_use = 0, destination = NULL, updated_at = NOW() WHERE number = ?`
+    query := `UPDATE dids SET in_use = 0, destination = NULL, leased_by = NULL, updated_at = NOW() WHERE number = ?`
     _, err := db.DB.Exec(query, did)
     return err
 }
 
-func (r *Router) verifyProviderIP(provider *models.Provider, sourceIP string) error {
-    // Extract IP from source (remove port if present)
-    parts := strings.Split(sourceIP, ":")
-    ip := parts[0]
-    
-    // For IP-based auth, verify the source IP
-    if provider.AuthType == "ip" || provider.AuthType == "both" {
-        if provider.Host != ip {
-            return fmt.Errorf("IP mismatch: expected %s, got %s", provider.Host, ip)
-        }
+// translateIn applies the inbound translation rules of the provider a call
+// came from, so its numbers compare with the ones the router stored
+func (r *Router) translateIn(providerName, ani, dnis string, clog *logger.Entry) (string, string) {
+    newANI, newDNIS := r.providerMgr.Translate(providerName, provider.DirectionInbound, ani, dnis)
+    if newANI != ani || newDNIS != dnis {
+        clog.WithFields(logger.Fields{"ani": newANI, "dnis": newDNIS}).Debugf("Translated numbers from %s", providerName)
+    }
+    return newANI, newDNIS
+}
+
+// ReturnDID translates the DID an intermediate provider's return call was
+// dialled on as ProcessReturnCall does, so the hangup, retry and Dial result
+// of that channel find the call under the DID the router stored
+func (r *Router) ReturnDID(providerName, did string) string {
+    if did == "" {
+        return did
+    }
+    _, did = r.providerMgr.Translate(providerName, provider.DirectionInbound, "", did)
+    return did
+}
+
+// translateOut applies the outbound translation rules of the provider a
+// response routes the call to
+func (r *Router) translateOut(providerName string, response *models.CallResponse) {
+    response.ANIToSend, response.DNISToSend = r.providerMgr.Translate(providerName, provider.DirectionOutbound,
+        response.ANIToSend, response.DNISToSend)
+}
+
+// verifyProviderIP checks that a call from an IP-authenticated provider
+// came from one of its allowed addresses
+func (r *Router) verifyProviderIP(p *models.Provider, sourceIP string) error {
+    if p.AuthType != "ip" && p.AuthType != "both" {
+        return nil
     }
     
+    ip := sourceAddress(sourceIP)
+    if ip == nil || !r.providerMgr.SourceAllowed(p, ip) {
+        return fmt.Errorf("IP mismatch: expected %s, got %s",
+            strings.Join(provider.SourceAddresses(p), ", "), sourceIP)
+    }
     return nil
 }
 
+// sourceAddress returns the IP of a SIP source address, which may carry a
+// port: 192.0.2.1:5060, [2001:db8::1]:5060 or the address alone
+func sourceAddress(sourceIP string) net.IP {
+    host := sourceIP
+    if h, _, err := net.SplitHostPort(sourceIP); err == nil {
+        host = h
+    }
+    return net.ParseIP(strings.Trim(host, "[]"))
+}
+
 func (r *Router) storeCallRecord(record *models.CallRecord) error {
     query := `
         INSERT INTO call_records 
         (call_id, original_ani, original_dnis, transformed_ani, assigned_did, 
-         inbound_provider, intermediate_provider, final_provider, status, 
-         current_step, start_time, recording_path)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+         inbound_provider, intermediate_provider, final_provider, route_name, status, 
+         current_step, start_time, recording_path,
+         intermediate_rate_id, intermediate_rate, final_rate_id, final_rate)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+    
+    intermediateRateID, intermediateRate := rateColumns(record.IntermediateRate)
+    finalRateID, finalRate := rateColumns(record.FinalRate)
     
     _, err := db.DB.Exec(query, 
         record.CallID, record.OriginalANI, record.OriginalDNIS,
         record.TransformedANI, record.AssignedDID, record.InboundProvider, 
-        record.IntermediateProvider, record.FinalProvider, record.Status, 
-        record.CurrentStep, record.StartTime, record.RecordingPath)
+        record.IntermediateProvider, record.FinalProvider, record.RouteName, record.Status, 
+        record.CurrentStep, record.StartTime, record.RecordingPath,
+        intermediateRateID, intermediateRate, finalRateID, finalRate)
     
     return err
 }
 
+// rateColumns returns the call_records rate id and rate of a chosen
+// provider, NULL when it had no rate
+func rateColumns(rate *models.Rate) (sql.NullInt64, sql.NullFloat64) {
+    if rate == nil {
+        return sql.NullInt64{}, sql.NullFloat64{}
+    }
+    return sql.NullInt64{Int64: int64(rate.ID), Valid: true}, sql.NullFloat64{Float64: rate.RatePerMinute, Valid: true}
+}
+
 func (r *Router) updateCallRecord(record *models.CallRecord) error {
     query := `
         UPDATE call_records 
-        SET status = ?, current_step = ?, end_time = ?, duration = ?
+        SET status = ?, current_step = ?, end_time = ?, duration = ?, billsec = ?, hangup_cause = ?,
+            inbound_rate_id = ?, inbound_rate = ?, cost = ?, revenue = ?, margin = ?, currency = ?
         WHERE call_id = ?`
     
+    inboundRateID, inboundRate := rateColumns(record.InboundRate)
+    
     _, err := db.DB.Exec(query, record.Status, record.CurrentStep, 
-        record.EndTime, record.Duration, record.CallID)
+        record.EndTime, record.Duration, record.Billsec, record.HangupCause,
+        inboundRateID, inboundRate, record.Cost, record.Revenue, record.Margin,
+        sql.NullString{String: record.Currency, Valid: record.Currency != ""},
+        record.CallID)
     return err
 }
 
-func (r *Router) storeVerificationRecord(callID string, step string, expected, received map[string]string, sourceIP string, verified bool) {
+// storeVerificationRecord stores the check of one leg of a call against the
+// provider it came from. reason is why the leg failed, "" if it verified,
+// and action the verification policy applied to the failure.
+func (r *Router) storeVerificationRecord(callID string, step string, providerName string, expected, received map[string]string, sourceIP string, reason, action string) {
     query := `
         INSERT INTO call_verifications 
         (call_id, verification_step, expected_ani, expected_dnis, 
-         received_ani, received_dnis, source_ip, verified)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+         received_ani, received_dnis, source_ip, provider_name, verified, failure_reason, policy_action)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
     
     _, err := db.DB.Exec(query, callID, step,
         expected["ani"], expected["dnis"],
         received["ani"], received["dnis"],
-        sourceIP, verified)
+        sourceIP, providerName, reason == "", reason, action)
     
     if err != nil {
-        log.Printf("Failed to store verification record: %v", err)
+        log.WithFields(logger.Fields{"call_id": callID, "step": step}).Errorf("Failed to store verification record: %v", err)
     }
 }
 
@@ -447,40 +857,180 @@ func (r *Router) cleanupStaleCalls() {
     r.mu.Lock()
     defer r.mu.Unlock()
     
+    records, err := r.store.List()
+    if err != nil {
+        log.Errorf("Failed to list active calls: %v", err)
+        return
+    }
+    
+    // Each node reaps only its own calls, whose counters it keeps
     now := time.Now()
-    for callID, record := range r.activeCalls {
+    active := make(map[string]int64)
+    for _, record := range records {
+        callID := record.CallID
+        if !r.ownsCall(record) {
+            continue
+        }
         if now.Sub(record.StartTime) > 30*time.Minute {
-            log.Printf("Cleaning up stale call %s", callID)
-            
-            // Release DID
-            r.releaseDID(record.AssignedDID)
-            
-            // Update stats
-            r.loadBalancer.UpdateStats(record.IntermediateProvider, false, 0)
-            r.loadBalancer.UpdateStats(record.FinalProvider, false, 0)
-            r.loadBalancer.IncrementActiveCalls(record.IntermediateProvider, -1)
-            r.loadBalancer.IncrementActiveCalls(record.FinalProvider, -1)
-            
-            // Update call record
-            record.Status = "ABANDONED"
-            record.CurrentStep = "CLEANUP"
-            endTime := time.Now()
-            record.EndTime = &endTime
-            r.updateCallRecord(record)
+            // Whoever removes the call from the store owns the cleanup
+            if err := r.store.Delete(callID); err != nil {
+                continue
+            }
             
-            // Remove from maps
-            delete(r.activeCalls, callID)
-            delete(r.didToCall, record.AssignedDID)
+            log.WithFields(logger.Fields{
+                "call_id":  callID,
+                "step":     record.CurrentStep,
+                "provider": record.IntermediateProvider,
+            }).Warnf("Cleaning up stale call")
+            r.abandonCall(record, "CLEANUP")
+            continue
         }
+        active[record.IntermediateProvider]++
+        active[record.FinalProvider]++
+    }
+    
+    // Calls this node took may have been closed by another node, which
+    // leaves them in this node's counters: count them again from the store
+    if r.clustered {
+        r.loadBalancer.SetActiveCalls(active)
+    }
+}
+
+// abandonCall releases everything held by a call that will never complete.
+// The call must already be removed from the store. Caller must hold r.mu.
+func (r *Router) abandonCall(record *models.CallRecord, step string) {
+    // Release DID
+    r.releaseDID(record.AssignedDID)
+    
+    // Update stats
+    r.loadBalancer.UpdateStats(record.IntermediateProvider, false, 0)
+    r.loadBalancer.UpdateStats(record.FinalProvider, false, 0)
+    r.countActiveCall(record, -1)
+    
+    // Update call record
+    record.Status = "ABANDONED"
+    record.CurrentStep = step
+    endTime := time.Now()
+    record.EndTime = &endTime
+    r.updateCallRecord(record)
+}
+
+// ownsCall reports whether this node took the call, and so keeps it in its
+// active call counters. Without a cluster every stored call is this node's.
+func (r *Router) ownsCall(record *models.CallRecord) bool {
+    return !r.clustered || record.NodeID == r.nodeID
+}
+
+// countActiveCall adds delta to the active call counters of both providers
+// of a call. Counters are node-local, so calls another node took are left
+// to that node.
+func (r *Router) countActiveCall(record *models.CallRecord, delta int64) {
+    if !r.ownsCall(record) {
+        return
     }
+    r.loadBalancer.IncrementActiveCalls(record.IntermediateProvider, delta)
+    r.loadBalancer.IncrementActiveCalls(record.FinalProvider, delta)
+}
+
+// ReleaseDID frees a DID by hand. If an in-flight call still holds the DID,
+// that call is abandoned so the live state matches the database.
+func (r *Router) ReleaseDID(number string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    
+    record, err := r.store.GetByDID(number)
+    if err == nil {
+        if err := r.store.Delete(record.CallID); err == nil {
+            log.WithFields(logger.Fields{"call_id": record.CallID, "did": number}).Warnf("Abandoning call holding released DID")
+            r.abandonCall(record, "RELEASED")
+            return nil
+        }
+    } else if err != callstate.ErrNotFound {
+        return err
+    }
+    
+    result, err := db.DB.Exec(`UPDATE dids SET in_use = 0, destination = NULL, leased_by = NULL, updated_at = NOW() WHERE number = ?`, number)
+    if err != nil {
+        return err
+    }
+    
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return fmt.Errorf("DID %s %w", number, ErrDIDNotFound)
+    }
+    
+    return nil
+}
+
+// ListCallRecords returns the most recent call records, optionally filtered by status
+func (r *Router) ListCallRecords(status string, limit int) ([]*models.CallRecord, error) {
+    query := `
+        SELECT call_id, original_ani, original_dnis, transformed_ani, assigned_did,
+               inbound_provider, intermediate_provider, final_provider, status,
+               current_step, start_time, end_time, duration, recording_path, hangup_cause,
+               route_name, cost, revenue, margin, currency
+        FROM call_records
+        WHERE 1=1`
+    args := []interface{}{}
+    
+    if status != "" {
+        query += " AND status = ?"
+        args = append(args, status)
+    }
+    
+    query += " ORDER BY start_time DESC LIMIT ?"
+    args = append(args, limit)
+    
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var records []*models.CallRecord
+    for rows.Next() {
+        var transformedANI, assignedDID, inbound, intermediate, final, step, recording, cause, route, currency sql.NullString
+        var endTime sql.NullTime
+        record := &models.CallRecord{}
+        
+        err := rows.Scan(&record.CallID, &record.OriginalANI, &record.OriginalDNIS,
+            &transformedANI, &assignedDID, &inbound, &intermediate, &final,
+            &record.Status, &step, &record.StartTime, &endTime, &record.Duration, &recording, &cause,
+            &route, &record.Cost, &record.Revenue, &record.Margin, &currency)
+        if err != nil {
+            return nil, err
+        }
+        
+        record.TransformedANI = transformedANI.String
+        record.AssignedDID = assignedDID.String
+        record.InboundProvider = inbound.String
+        record.IntermediateProvider = intermediate.String
+        record.FinalProvider = final.String
+        record.CurrentStep = step.String
+        record.RecordingPath = recording.String
+        record.HangupCause = cause.String
+        record.RouteName = route.String
+        record.Currency = currency.String
+        if endTime.Valid {
+            record.EndTime = &endTime.Time
+        }
+        records = append(records, record)
+    }
+    
+    return records, rows.Err()
 }
 
 func (r *Router) GetStatistics() map[string]interface{} {
     r.mu.RLock()
     defer r.mu.RUnlock()
     
+    records, err := r.store.List()
+    if err != nil {
+        log.Errorf("Failed to list active calls: %v", err)
+    }
+    
     stats := make(map[string]interface{})
-    stats["active_calls"] = len(r.activeCalls)
+    stats["active_calls"] = len(records)
+    stats["node_id"] = r.nodeID
     
     // Get DID statistics
     var totalDIDs, usedDIDs int
@@ -492,7 +1042,7 @@ func (r *Router) GetStatistics() map[string]interface{} {
     
     // Get call statistics by provider
     providerStats := make(map[string]map[string]int)
-    for _, record := range r.activeCalls {
+    for _, record := range records {
         if _, exists := providerStats[record.InboundProvider]; !exists {
             providerStats[record.InboundProvider] = make(map[string]int)
         }
@@ -510,6 +1060,10 @@ func (r *Router) GetStatistics() map[string]interface{} {
     }
     
     stats["provider_stats"] = providerStats
+    stats["rejected_calls"] = r.limits.snapshot()
+    if r.fraud != nil {
+        stats["fraud_hits"] = r.fraud.Stats()
+    }
     
     return stats
 }
@@ -1,7 +1,13 @@
 package router
 import (
 	"github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+	"github.com/hamzaKhattat/asterisk-router-production/internal/models"
 )
+// ActiveCalls returns a snapshot of the calls currently in flight
+func (r *Router) ActiveCalls() ([]*models.CallRecord, error) {
+    return r.store.List()
+}
+
 // GetLoadBalancer returns the router's load balancer instance
 func (r *Router) GetLoadBalancer() *loadbalancer.LoadBalancer {
     return r.loadBalancer
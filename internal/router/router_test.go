@@ -0,0 +1,248 @@
+package router
+
+import (
+    "database/sql/driver"
+    "net"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/callstate"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
+)
+
+const testNode = "node1"
+
+// newTestRouter builds a router on store without recovering calls or
+// starting the cleanup routine
+func newTestRouter(store callstate.Store, clustered bool) *Router {
+    return &Router{
+        providerMgr:  provider.NewManager(),
+        loadBalancer: loadbalancer.New(),
+        store:        store,
+        nodeID:       testNode,
+        clustered:    clustered,
+        maxAttempts:  DefaultMaxAttempts,
+        limits:       newInboundLimits(0, 0),
+    }
+}
+
+// activeCalls returns the active call counter of each provider
+func activeCalls(r *Router, providers ...string) map[string]int64 {
+    counts := make(map[string]int64)
+    for _, name := range providers {
+        counts[name] = r.loadBalancer.GetProviderStats(name).ActiveCalls
+    }
+    return counts
+}
+
+// callRecordRows answers the recovery query of call_records
+func callRecordRows(records ...*models.CallRecord) fakeRows {
+    rows := fakeRows{columns: []string{"call_id", "original_ani", "original_dnis", "transformed_ani",
+        "assigned_did", "inbound_provider", "intermediate_provider", "final_provider", "status",
+        "current_step", "start_time", "recording_path"}}
+    for _, record := range records {
+        var did driver.Value
+        if record.AssignedDID != "" {
+            did = record.AssignedDID
+        }
+        rows.values = append(rows.values, []driver.Value{record.CallID, record.OriginalANI,
+            record.OriginalDNIS, record.OriginalDNIS, did, "s1", record.IntermediateProvider,
+            record.FinalProvider, record.Status, record.CurrentStep, record.StartTime, nil})
+    }
+    return rows
+}
+
+func TestRecoverActiveCalls(t *testing.T) {
+    fake := useFakeDB(t)
+    start := time.Now().Add(-time.Minute)
+    fake.rows["FROM call_records"] = callRecordRows(
+        &models.CallRecord{CallID: "c1", OriginalANI: "1555", OriginalDNIS: "4420", AssignedDID: "100",
+            IntermediateProvider: "s3a", FinalProvider: "s4a", Status: "ACTIVE", CurrentStep: "S1_TO_S2", StartTime: start},
+        &models.CallRecord{CallID: "c2", OriginalANI: "1666", OriginalDNIS: "4421",
+            IntermediateProvider: "s3b", FinalProvider: "s4b", Status: "ACTIVE", CurrentStep: "S1_TO_S2", StartTime: start},
+    )
+    
+    r := newTestRouter(callstate.NewMemoryStore(), false)
+    if err := r.recoverActiveCalls(); err != nil {
+        t.Fatal(err)
+    }
+    
+    for _, callID := range []string{"c1", "c2"} {
+        record, err := r.store.Get(callID)
+        if err != nil {
+            t.Fatalf("%s not restored: %v", callID, err)
+        }
+        if record.NodeID != testNode {
+            t.Errorf("%s restored for node %q, want %s", callID, record.NodeID, testNode)
+        }
+    }
+    if record, _ := r.store.GetByDID("100"); record == nil || record.CallID != "c1" {
+        t.Errorf("DID 100 finds %v, want c1", record)
+    }
+    
+    want := map[string]int64{"s3a": 1, "s4a": 1, "s3b": 1, "s4b": 1}
+    for name, n := range activeCalls(r, "s3a", "s4a", "s3b", "s4b") {
+        if n != want[name] {
+            t.Errorf("%s has %d active calls, want %d", name, n, want[name])
+        }
+    }
+    
+    locks := fake.execsOf("SET in_use = 1")
+    if len(locks) != 1 || locks[0].args[2] != "100" {
+        t.Errorf("re-locked DIDs %v, want only 100", locks)
+    }
+    releases := fake.execsOf("SET in_use = 0")
+    if len(releases) != 1 {
+        t.Fatalf("%d orphaned DID releases, want 1", len(releases))
+    }
+    if len(releases[0].args) != 1 || releases[0].args[0] != "100" {
+        t.Errorf("released every DID but %v, want all but 100", releases[0].args)
+    }
+}
+
+func TestRecoverActiveCallsClustered(t *testing.T) {
+    fake := useFakeDB(t)
+    start := time.Now().Add(-time.Minute)
+    own := &models.CallRecord{CallID: "c1", OriginalANI: "1555", OriginalDNIS: "4420", AssignedDID: "100",
+        IntermediateProvider: "s3a", FinalProvider: "s4a", Status: "ACTIVE", CurrentStep: "S1_TO_S2", StartTime: start}
+    other := &models.CallRecord{CallID: "c2", OriginalANI: "1666", OriginalDNIS: "4421", AssignedDID: "200",
+        IntermediateProvider: "s3a", FinalProvider: "s4a", Status: "ACTIVE", CurrentStep: "S1_TO_S2", StartTime: start,
+        NodeID: "node2"}
+    fake.rows["FROM call_records"] = callRecordRows(own, other)
+    
+    // The shared store already holds the other node's call
+    store := callstate.NewMemoryStore()
+    store.Put(other)
+    
+    r := newTestRouter(store, true)
+    if err := r.recoverActiveCalls(); err != nil {
+        t.Fatal(err)
+    }
+    
+    if record, _ := store.Get("c2"); record == nil || record.NodeID != "node2" {
+        t.Errorf("other node's call became %v, want it left to node2", record)
+    }
+    if record, _ := store.Get("c1"); record == nil || record.NodeID != testNode {
+        t.Errorf("own call restored as %v", record)
+    }
+    
+    // Only the own call counts on this node
+    for name, n := range activeCalls(r, "s3a", "s4a") {
+        if n != 1 {
+            t.Errorf("%s has %d active calls, want 1", name, n)
+        }
+    }
+    
+    locks := fake.execsOf("SET in_use = 1")
+    if len(locks) != 1 || locks[0].args[2] != "100" {
+        t.Errorf("re-locked DIDs %v, want only 100", locks)
+    }
+    
+    // Only DIDs this node leased are released, and neither held DID
+    releases := fake.execsOf("SET in_use = 0")
+    if len(releases) != 1 {
+        t.Fatalf("%d orphaned DID releases, want 1", len(releases))
+    }
+    args := releases[0].args
+    held := map[driver.Value]bool{}
+    for _, arg := range args[1:] {
+        held[arg] = true
+    }
+    if len(args) != 3 || args[0] != testNode || !held["100"] || !held["200"] {
+        t.Errorf("released with %v, want node %s keeping 100 and 200", args, testNode)
+    }
+}
+
+func TestCleanupStaleCallsOwnCallsOnly(t *testing.T) {
+    useFakeDB(t)
+    stale := time.Now().Add(-time.Hour)
+    store := callstate.NewMemoryStore()
+    store.Put(&models.CallRecord{CallID: "own-stale", AssignedDID: "100", IntermediateProvider: "s3a",
+        FinalProvider: "s4a", StartTime: stale, NodeID: testNode})
+    store.Put(&models.CallRecord{CallID: "own-fresh", AssignedDID: "101", IntermediateProvider: "s3b",
+        FinalProvider: "s4b", StartTime: time.Now(), NodeID: testNode})
+    store.Put(&models.CallRecord{CallID: "other-stale", AssignedDID: "200", IntermediateProvider: "s3b",
+        FinalProvider: "s4b", StartTime: stale, NodeID: "node2"})
+    
+    r := newTestRouter(store, true)
+    r.loadBalancer.IncrementActiveCalls("s3a", 1)
+    r.loadBalancer.IncrementActiveCalls("s4a", 1)
+    r.loadBalancer.IncrementActiveCalls("s3b", 1)
+    r.loadBalancer.IncrementActiveCalls("s4b", 1)
+    // A call this node took that another node has since closed
+    r.loadBalancer.IncrementActiveCalls("s3c", 1)
+    
+    r.cleanupStaleCalls()
+    
+    for callID, want := range map[string]bool{"own-stale": false, "own-fresh": true, "other-stale": true} {
+        if _, err := store.Get(callID); (err == nil) != want {
+            t.Errorf("%s in the store %v, want %v", callID, err == nil, want)
+        }
+    }
+    
+    want := map[string]int64{"s3a": 0, "s4a": 0, "s3b": 1, "s4b": 1, "s3c": 0}
+    for name, n := range activeCalls(r, "s3a", "s4a", "s3b", "s4b", "s3c") {
+        if n != want[name] {
+            t.Errorf("%s has %d active calls, want %d", name, n, want[name])
+        }
+    }
+}
+
+func TestHangupCountsOwnCallsOnly(t *testing.T) {
+    useFakeDB(t)
+    store := callstate.NewMemoryStore()
+    store.Put(&models.CallRecord{CallID: "own", AssignedDID: "100", IntermediateProvider: "s3a",
+        FinalProvider: "s4a", CurrentStep: "S1_TO_S2", StartTime: time.Now(), NodeID: testNode})
+    store.Put(&models.CallRecord{CallID: "other", AssignedDID: "200", IntermediateProvider: "s3a",
+        FinalProvider: "s4a", CurrentStep: "S1_TO_S2", StartTime: time.Now(), NodeID: "node2"})
+    
+    r := newTestRouter(store, true)
+    r.loadBalancer.IncrementActiveCalls("s3a", 1)
+    r.loadBalancer.IncrementActiveCalls("s4a", 1)
+    
+    // The other node took its call and keeps its own count
+    if err := r.ProcessHangup("other", "", "16", "ANSWER", time.Minute); err != nil {
+        t.Fatal(err)
+    }
+    if n := activeCalls(r, "s3a")["s3a"]; n != 1 {
+        t.Errorf("s3a has %d active calls after another node's hangup, want 1", n)
+    }
+    
+    if err := r.ProcessHangup("own", "", "16", "ANSWER", time.Minute); err != nil {
+        t.Fatal(err)
+    }
+    if n := activeCalls(r, "s3a")["s3a"]; n != 0 {
+        t.Errorf("s3a has %d active calls after the own hangup, want 0", n)
+    }
+}
+
+func TestSourceAddress(t *testing.T) {
+    tests := []struct {
+        source string
+        want   string // "" for no address
+    }{
+        {"192.0.2.1", "192.0.2.1"},
+        {"192.0.2.1:5060", "192.0.2.1"},
+        {"2001:db8::1", "2001:db8::1"},
+        {"[2001:db8::1]", "2001:db8::1"},
+        {"[2001:db8::1]:5060", "2001:db8::1"},
+        {"host:port:extra", ""},
+        {"sip.example.com:5060", ""},
+        {"", ""},
+    }
+    
+    for _, tt := range tests {
+        got := sourceAddress(tt.source)
+        if tt.want == "" {
+            if got != nil {
+                t.Errorf("sourceAddress(%q) = %v, want none", tt.source, got)
+            }
+            continue
+        }
+        if !got.Equal(net.ParseIP(tt.want)) {
+            t.Errorf("sourceAddress(%q) = %v, want %s", tt.source, got, tt.want)
+        }
+    }
+}
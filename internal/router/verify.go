@@ -0,0 +1,80 @@
+package router
+
+import (
+    "fmt"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/db"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/provider"
+)
+
+// Why a leg failed verification, as stored in call_verifications
+const (
+    ReasonIPMismatch      = "ip_mismatch"
+    ReasonANIMismatch     = "ani_mismatch"
+    ReasonDNISMismatch    = "dnis_mismatch"
+    ReasonANIDNISMismatch = "ani_dnis_mismatch"
+)
+
+// ipMismatchPolicy is applied to every leg from an unexpected source IP,
+// whatever the route's policy
+const ipMismatchPolicy = provider.VerifyReject
+
+// verificationSIPCode is the SIP response a leg refused by verification is
+// rejected with
+const verificationSIPCode = 403
+
+// VerificationError is returned by ProcessReturnCall and ProcessFinalCall
+// for a leg refused because it failed verification
+type VerificationError struct {
+    Step   string
+    Reason string
+    Detail string
+}
+
+func (e *VerificationError) Error() string {
+    return fmt.Sprintf("%s verification failed (%s): %s", e.Step, e.Reason, e.Detail)
+}
+
+func (e *VerificationError) Unwrap() error {
+    return ErrVerificationFailed
+}
+
+// numbersMismatch returns why the received ANI and DNIS of a leg differ
+// from the expected ones, "" if they match
+func numbersMismatch(expectedANI, expectedDNIS, ani, dnis string) string {
+    switch {
+    case ani != expectedANI && dnis != expectedDNIS:
+        return ReasonANIDNISMismatch
+    case ani != expectedANI:
+        return ReasonANIMismatch
+    case dnis != expectedDNIS:
+        return ReasonDNISMismatch
+    }
+    return ""
+}
+
+// enforceVerification applies the verification policy of a call's route to
+// a leg whose numbers did not match, and returns the policy applied. The
+// error is set when the policy refuses the leg.
+func (r *Router) enforceVerification(record *models.CallRecord, step, reason, detail string, clog *logger.Entry) (string, error) {
+    policy := r.providerMgr.VerifyPolicy(record.RouteName)
+    clog = clog.WithFields(logger.Fields{"reason": reason, "policy": policy})
+    
+    switch policy {
+    case provider.VerifyReject:
+        clog.Errorf("Rejecting call: %s", detail)
+        return policy, &VerificationError{Step: step, Reason: reason, Detail: detail}
+    
+    case provider.VerifyQuarantine:
+        clog.Warnf("Quarantining call: %s", detail)
+        if _, err := db.DB.Exec("UPDATE call_records SET quarantined = TRUE WHERE call_id = ?", record.CallID); err != nil {
+            clog.Errorf("Failed to quarantine call record: %v", err)
+        }
+    
+    default:
+        clog.Warnf("%s", detail)
+    }
+    return policy, nil
+}
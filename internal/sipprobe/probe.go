@@ -0,0 +1,218 @@
+package sipprobe
+
+import (
+    "bufio"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Supported transports
+const (
+    TransportUDP = "udp"
+    TransportTCP = "tcp"
+)
+
+// UDP retransmission starts at T1 and doubles, as in RFC 3261 section 17.1.2
+const t1 = 500 * time.Millisecond
+
+// ErrTimeout is returned when the provider did not answer in time
+var ErrTimeout = errors.New("no response")
+
+// Result is the outcome of one OPTIONS probe
+type Result struct {
+    Up         bool
+    StatusCode int
+    Latency    time.Duration
+    Err        error
+}
+
+// Probe sends a SIP OPTIONS request to host:port and waits for the final
+// response. Any response below 500 means the provider's SIP stack is alive;
+// 401/403/404/405 are common answers to OPTIONS from an unknown peer.
+func Probe(transport, host string, port int, timeout time.Duration) Result {
+    addr := net.JoinHostPort(host, strconv.Itoa(port))
+    start := time.Now()
+    
+    var code int
+    var err error
+    switch transport {
+    case TransportTCP:
+        code, err = probeTCP(addr, timeout)
+    default:
+        code, err = probeUDP(addr, timeout)
+    }
+    
+    result := Result{StatusCode: code, Latency: time.Since(start), Err: err}
+    if err == nil {
+        result.Up = code < 500
+        if !result.Up {
+            result.Err = fmt.Errorf("SIP %d", code)
+        }
+    }
+    return result
+}
+
+func probeUDP(addr string, timeout time.Duration) (int, error) {
+    conn, err := net.DialTimeout("udp", addr, timeout)
+    if err != nil {
+        return 0, err
+    }
+    defer conn.Close()
+    
+    request := buildOptions(TransportUDP, addr, conn.LocalAddr())
+    deadline := time.Now().Add(timeout)
+    interval := t1
+    buf := make([]byte, 65535)
+    
+    for {
+        if _, err := conn.Write(request); err != nil {
+            return 0, err
+        }
+        
+        wait := time.Now().Add(interval)
+        if wait.After(deadline) {
+            wait = deadline
+        }
+        conn.SetReadDeadline(wait)
+        
+        for {
+            n, err := conn.Read(buf)
+            if err != nil {
+                var netErr net.Error
+                if errors.As(err, &netErr) && netErr.Timeout() {
+                    break
+                }
+                return 0, err
+            }
+            
+            code, err := parseStatus(buf[:n])
+            if err != nil {
+                continue
+            }
+            if code >= 200 {
+                return code, nil
+            }
+            // Provisional response; keep waiting for the final one
+        }
+        
+        if !time.Now().Before(deadline) {
+            return 0, ErrTimeout
+        }
+        interval *= 2
+    }
+}
+
+func probeTCP(addr string, timeout time.Duration) (int, error) {
+    conn, err := net.DialTimeout("tcp", addr, timeout)
+    if err != nil {
+        return 0, err
+    }
+    defer conn.Close()
+    
+    conn.SetDeadline(time.Now().Add(timeout))
+    if _, err := conn.Write(buildOptions(TransportTCP, addr, conn.LocalAddr())); err != nil {
+        return 0, err
+    }
+    
+    reader := bufio.NewReader(conn)
+    for {
+        head, err := readMessageHead(reader)
+        if err != nil {
+            var netErr net.Error
+            if errors.As(err, &netErr) && netErr.Timeout() {
+                return 0, ErrTimeout
+            }
+            return 0, err
+        }
+        
+        code, err := parseStatus(head)
+        if err != nil {
+            return 0, err
+        }
+        if code >= 200 {
+            return code, nil
+        }
+    }
+}
+
+// readMessageHead reads one SIP message from a stream and returns its
+// start line and headers. The body, if any, is discarded.
+func readMessageHead(reader *bufio.Reader) ([]byte, error) {
+    var head []byte
+    contentLength := 0
+    
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        head = append(head, line...)
+        
+        trimmed := strings.TrimSpace(line)
+        if trimmed == "" {
+            break
+        }
+        if name, value, ok := strings.Cut(trimmed, ":"); ok {
+            name = strings.ToLower(strings.TrimSpace(name))
+            if name == "content-length" || name == "l" {
+                contentLength, _ = strconv.Atoi(strings.TrimSpace(value))
+            }
+        }
+    }
+    
+    if contentLength > 0 {
+        if _, err := reader.Discard(contentLength); err != nil {
+            return nil, err
+        }
+    }
+    return head, nil
+}
+
+// parseStatus returns the status code of a SIP response
+func parseStatus(msg []byte) (int, error) {
+    line := string(msg)
+    if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+        line = line[:i]
+    }
+    
+    parts := strings.SplitN(line, " ", 3)
+    if len(parts) < 2 || parts[0] != "SIP/2.0" {
+        return 0, fmt.Errorf("not a SIP response: %q", line)
+    }
+    
+    code, err := strconv.Atoi(parts[1])
+    if err != nil {
+        return 0, fmt.Errorf("invalid status code in %q", line)
+    }
+    return code, nil
+}
+
+func buildOptions(transport, target string, local net.Addr) []byte {
+    uri := "sip:" + target
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, "OPTIONS %s SIP/2.0\r\n", uri)
+    fmt.Fprintf(&b, "Via: SIP/2.0/%s %s;branch=z9hG4bK%s;rport\r\n", strings.ToUpper(transport), local, randomToken())
+    b.WriteString("Max-Forwards: 70\r\n")
+    fmt.Fprintf(&b, "From: <sip:router@%s>;tag=%s\r\n", local, randomToken())
+    fmt.Fprintf(&b, "To: <%s>\r\n", uri)
+    fmt.Fprintf(&b, "Call-ID: %s@asterisk-router\r\n", randomToken())
+    b.WriteString("CSeq: 1 OPTIONS\r\n")
+    fmt.Fprintf(&b, "Contact: <sip:router@%s>\r\n", local)
+    b.WriteString("Accept: application/sdp\r\n")
+    b.WriteString("User-Agent: asterisk-router\r\n")
+    b.WriteString("Content-Length: 0\r\n\r\n")
+    return []byte(b.String())
+}
+
+func randomToken() string {
+    buf := make([]byte, 8)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
@@ -0,0 +1,135 @@
+package sipprobe
+
+import (
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/logger"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+var log = logger.Component("sipprobe")
+
+// Config controls the active prober
+type Config struct {
+    Interval  time.Duration
+    Timeout   time.Duration
+    Transport string // "udp" or "tcp"
+    
+    // DownAfter failed probes in a row mark a provider down. One successful
+    // probe marks it up again.
+    DownAfter int
+}
+
+// Defaults for Config fields left at zero
+const (
+    DefaultInterval  = 30 * time.Second
+    DefaultTimeout   = 2 * time.Second
+    DefaultDownAfter = 2
+)
+
+// Prober periodically sends SIP OPTIONS to every active provider and
+// reports reachability and latency to the load balancer
+type Prober struct {
+    cfg       Config
+    lb        *loadbalancer.LoadBalancer
+    providers func() []*models.Provider
+    
+    mu       sync.Mutex
+    failures map[string]int
+}
+
+// NewProber creates a prober. providers is called before every round, so
+// providers added or removed by a reload are picked up.
+func NewProber(lb *loadbalancer.LoadBalancer, providers func() []*models.Provider, cfg Config) *Prober {
+    if cfg.Interval <= 0 {
+        cfg.Interval = DefaultInterval
+    }
+    if cfg.Timeout <= 0 {
+        cfg.Timeout = DefaultTimeout
+    }
+    if cfg.Transport != TransportTCP {
+        cfg.Transport = TransportUDP
+    }
+    if cfg.DownAfter <= 0 {
+        cfg.DownAfter = DefaultDownAfter
+    }
+    
+    return &Prober{
+        cfg:       cfg,
+        lb:        lb,
+        providers: providers,
+        failures:  make(map[string]int),
+    }
+}
+
+// Run probes all providers every Interval until stop is closed
+func (p *Prober) Run(stop <-chan struct{}) {
+    log.Infof("Probing providers with SIP OPTIONS over %s every %v", p.cfg.Transport, p.cfg.Interval)
+    
+    ticker := time.NewTicker(p.cfg.Interval)
+    defer ticker.Stop()
+    
+    p.ProbeAll()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+            p.ProbeAll()
+        }
+    }
+}
+
+// ProbeAll probes every active provider concurrently and waits for the results
+func (p *Prober) ProbeAll() {
+    var wg sync.WaitGroup
+    for _, provider := range p.providers() {
+        if !provider.Active || provider.Host == "" {
+            continue
+        }
+        
+        wg.Add(1)
+        go func(provider *models.Provider) {
+            defer wg.Done()
+            p.probeProvider(provider)
+        }(provider)
+    }
+    wg.Wait()
+}
+
+func (p *Prober) probeProvider(provider *models.Provider) {
+    port := provider.Port
+    if port == 0 {
+        port = 5060
+    }
+    
+    result := Probe(p.cfg.Transport, provider.Host, port, p.cfg.Timeout)
+    plog := log.WithFields(logger.Fields{"provider": provider.Name, "latency": result.Latency.String()})
+    
+    p.mu.Lock()
+    if result.Up {
+        p.failures[provider.Name] = 0
+    } else {
+        p.failures[provider.Name]++
+    }
+    failures := p.failures[provider.Name]
+    p.mu.Unlock()
+    
+    if result.Up {
+        if p.lb.SetReachable(provider.Name, true, result.Latency) {
+            plog.Infof("Provider is reachable again (SIP %d)", result.StatusCode)
+        } else {
+            plog.Debugf("OPTIONS answered with SIP %d", result.StatusCode)
+        }
+        return
+    }
+    
+    plog.Debugf("OPTIONS probe failed (%d in a row): %v", failures, result.Err)
+    if failures >= p.cfg.DownAfter {
+        if p.lb.SetReachable(provider.Name, false, 0) {
+            plog.Warnf("Provider unreachable after %d failed OPTIONS probes: %v", failures, result.Err)
+        }
+    }
+}
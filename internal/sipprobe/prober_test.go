@@ -0,0 +1,159 @@
+package sipprobe
+
+import (
+    "errors"
+    "net"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/asterisk-router-production/internal/loadbalancer"
+    "github.com/hamzaKhattat/asterisk-router-production/internal/models"
+)
+
+var transports = []string{TransportUDP, TransportTCP}
+
+func newResponder(t *testing.T, statusCode int) *Responder {
+    t.Helper()
+    r, err := NewResponder(statusCode)
+    if err != nil {
+        t.Fatalf("NewResponder: %v", err)
+    }
+    t.Cleanup(r.Close)
+    return r
+}
+
+func TestProbeStatus(t *testing.T) {
+    tests := []struct {
+        code int
+        up   bool
+    }{
+        {200, true},
+        {403, true},
+        {404, true},
+        {503, false},
+    }
+    
+    for _, transport := range transports {
+        for _, tt := range tests {
+            r := newResponder(t, tt.code)
+            result := Probe(transport, r.Host(), r.Port(), time.Second)
+            
+            if result.Up != tt.up || result.StatusCode != tt.code {
+                t.Errorf("%s SIP %d: got up=%v code=%d (%v), want up=%v",
+                    transport, tt.code, result.Up, result.StatusCode, result.Err, tt.up)
+            }
+            if tt.up && result.Err != nil {
+                t.Errorf("%s SIP %d: unexpected error %v", transport, tt.code, result.Err)
+            }
+            if !tt.up && result.Err == nil {
+                t.Errorf("%s SIP %d: expected an error", transport, tt.code)
+            }
+            if r.Requests() == 0 {
+                t.Errorf("%s SIP %d: responder saw no OPTIONS", transport, tt.code)
+            }
+        }
+    }
+}
+
+func TestProbeLatency(t *testing.T) {
+    const delay = 100 * time.Millisecond
+    
+    for _, transport := range transports {
+        r := newResponder(t, 200)
+        r.SetDelay(delay)
+        
+        result := Probe(transport, r.Host(), r.Port(), time.Second)
+        if !result.Up {
+            t.Fatalf("%s: probe failed: %v", transport, result.Err)
+        }
+        if result.Latency < delay || result.Latency > time.Second {
+            t.Errorf("%s: latency %v, want between %v and 1s", transport, result.Latency, delay)
+        }
+    }
+}
+
+func TestProbeTimeoutUDP(t *testing.T) {
+    // A socket that receives the OPTIONS but never answers
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    
+    port := conn.LocalAddr().(*net.UDPAddr).Port
+    result := Probe(TransportUDP, "127.0.0.1", port, 300*time.Millisecond)
+    if result.Up || !errors.Is(result.Err, ErrTimeout) {
+        t.Errorf("got up=%v err=%v, want a timeout", result.Up, result.Err)
+    }
+}
+
+func TestProbeTimeoutTCP(t *testing.T) {
+    // A listener that accepts the connection but never answers
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            defer conn.Close() // held open until the listener closes
+        }
+    }()
+    
+    port := listener.Addr().(*net.TCPAddr).Port
+    result := Probe(TransportTCP, "127.0.0.1", port, 300*time.Millisecond)
+    if result.Up || !errors.Is(result.Err, ErrTimeout) {
+        t.Errorf("got up=%v err=%v, want a timeout", result.Up, result.Err)
+    }
+}
+
+func TestProberDownAfter(t *testing.T) {
+    for _, transport := range transports {
+        r := newResponder(t, 200)
+        lb := loadbalancer.New()
+        provider := &models.Provider{Name: "carrier", Host: r.Host(), Port: r.Port(), Active: true}
+        
+        prober := NewProber(lb, func() []*models.Provider {
+            return []*models.Provider{provider}
+        }, Config{Timeout: time.Second, Transport: transport, DownAfter: 3})
+        
+        prober.ProbeAll()
+        stats := lb.GetProviderStats(provider.Name)
+        if stats.ProbeDown || stats.ProbeLatency <= 0 {
+            t.Fatalf("%s: after a good probe got down=%v latency=%v", transport, stats.ProbeDown, stats.ProbeLatency)
+        }
+        
+        r.SetStatusCode(503)
+        for i := 1; i <= 3; i++ {
+            prober.ProbeAll()
+            down := lb.GetProviderStats(provider.Name).ProbeDown
+            if want := i >= 3; down != want {
+                t.Errorf("%s: after %d failed probes down=%v, want %v", transport, i, down, want)
+            }
+        }
+        
+        r.SetStatusCode(200)
+        prober.ProbeAll()
+        if lb.GetProviderStats(provider.Name).ProbeDown {
+            t.Errorf("%s: provider still down after a good probe", transport)
+        }
+    }
+}
+
+func TestProberSkipsInactive(t *testing.T) {
+    r := newResponder(t, 200)
+    provider := &models.Provider{Name: "carrier", Host: r.Host(), Port: r.Port()}
+    
+    NewProber(loadbalancer.New(), func() []*models.Provider {
+        return []*models.Provider{provider}
+    }, Config{Timeout: time.Second}).ProbeAll()
+    
+    if r.Requests() != 0 {
+        t.Errorf("inactive provider was probed %d times", r.Requests())
+    }
+}
@@ -0,0 +1,170 @@
+package sipprobe
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Responder is a minimal SIP endpoint that answers OPTIONS with a fixed
+// status code. It lets the prober be exercised without a real carrier, e.g.
+// in unit tests.
+type Responder struct {
+    udp      net.PacketConn
+    tcp      net.Listener
+    wg       sync.WaitGroup
+    mu         sync.Mutex
+    statusCode int
+    delay      time.Duration
+    requests   int
+}
+
+// NewResponder listens on a random local port for both UDP and TCP
+func NewResponder(statusCode int) (*Responder, error) {
+    if statusCode == 0 {
+        statusCode = 200
+    }
+    
+    udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        return nil, err
+    }
+    
+    port := udp.LocalAddr().(*net.UDPAddr).Port
+    tcp, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+    if err != nil {
+        udp.Close()
+        return nil, err
+    }
+    
+    r := &Responder{statusCode: statusCode, udp: udp, tcp: tcp}
+    
+    r.wg.Add(2)
+    go r.serveUDP()
+    go r.serveTCP()
+    return r, nil
+}
+
+// Host and Port of the responder, to be used as a provider's Host and Port
+func (r *Responder) Host() string { return "127.0.0.1" }
+func (r *Responder) Port() int    { return r.udp.LocalAddr().(*net.UDPAddr).Port }
+
+// SetStatusCode changes the status code sent in reply to OPTIONS, e.g. 503
+// to simulate a provider going down
+func (r *Responder) SetStatusCode(code int) {
+    r.mu.Lock()
+    r.statusCode = code
+    r.mu.Unlock()
+}
+
+// SetDelay makes the responder wait before answering, to simulate a
+// provider's latency
+func (r *Responder) SetDelay(delay time.Duration) {
+    r.mu.Lock()
+    r.delay = delay
+    r.mu.Unlock()
+}
+
+// Requests returns how many OPTIONS requests were answered
+func (r *Responder) Requests() int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.requests
+}
+
+// Close stops the responder
+func (r *Responder) Close() {
+    r.udp.Close()
+    r.tcp.Close()
+    r.wg.Wait()
+}
+
+func (r *Responder) serveUDP() {
+    defer r.wg.Done()
+    
+    buf := make([]byte, 65535)
+    for {
+        n, addr, err := r.udp.ReadFrom(buf)
+        if err != nil {
+            return
+        }
+        if response := r.respond(buf[:n]); response != nil {
+            r.udp.WriteTo(response, addr)
+        }
+    }
+}
+
+func (r *Responder) serveTCP() {
+    defer r.wg.Done()
+    
+    for {
+        conn, err := r.tcp.Accept()
+        if err != nil {
+            return
+        }
+        
+        go func(conn net.Conn) {
+            defer conn.Close()
+            reader := bufio.NewReader(conn)
+            for {
+                head, err := readMessageHead(reader)
+                if err != nil {
+                    return
+                }
+                if response := r.respond(head); response != nil {
+                    conn.Write(response)
+                }
+            }
+        }(conn)
+    }
+}
+
+// respond builds the reply to a request, copying the headers that tie a
+// response to its transaction
+func (r *Responder) respond(request []byte) []byte {
+    if !bytes.HasPrefix(request, []byte("OPTIONS ")) {
+        return nil
+    }
+    
+    r.mu.Lock()
+    r.requests++
+    code, delay := r.statusCode, r.delay
+    r.mu.Unlock()
+    
+    time.Sleep(delay)
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, "SIP/2.0 %d %s\r\n", code, reasonPhrase(code))
+    for _, line := range strings.Split(string(request), "\r\n") {
+        name, _, ok := strings.Cut(line, ":")
+        if !ok {
+            continue
+        }
+        switch strings.ToLower(strings.TrimSpace(name)) {
+        case "via", "from", "to", "call-id", "cseq":
+            b.WriteString(line + "\r\n")
+        }
+    }
+    b.WriteString("Allow: INVITE, ACK, CANCEL, BYE, OPTIONS\r\n")
+    b.WriteString("Content-Length: 0\r\n\r\n")
+    return []byte(b.String())
+}
+
+func reasonPhrase(code int) string {
+    switch code {
+    case 200:
+        return "OK"
+    case 403:
+        return "Forbidden"
+    case 404:
+        return "Not Found"
+    case 503:
+        return "Service Unavailable"
+    default:
+        return "Response"
+    }
+}
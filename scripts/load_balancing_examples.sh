@@ -49,4 +49,8 @@ Load Balancing Modes Explained:
 - weighted: Calls distributed based on provider weight values
 - priority: Always use highest priority provider first
 - failover: Use backup providers only when primary fails
+- least_connections: Use the provider with the fewest active calls
+- least_utilization: Use the provider with the lowest active/max channels ratio
+- quality: Favour providers with the best ASR, ACD and post-dial delay
+- lcr: Use the provider with the cheapest rate for the called number
 "